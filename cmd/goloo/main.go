@@ -2,10 +2,17 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/emergingrobotics/goloo/internal/cloudinit"
 	"github.com/emergingrobotics/goloo/internal/config"
@@ -13,17 +20,32 @@ import (
 	"github.com/emergingrobotics/goloo/internal/provider"
 	awsprovider "github.com/emergingrobotics/goloo/internal/provider/aws"
 	"github.com/emergingrobotics/goloo/internal/provider/multipass"
+	"github.com/emergingrobotics/goloo/internal/sshconfig"
+	"github.com/emergingrobotics/goloo/internal/store"
+	"gopkg.in/yaml.v3"
 )
 
 var version = "dev"
 
 func main() {
 	if err := run(os.Args[1:]); err != nil {
+		var exitErr *remoteExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
+type remoteExitError struct {
+	code int
+}
+
+func (e *remoteExitError) Error() string {
+	return fmt.Sprintf("remote command exited with status %d", e.code)
+}
+
 type Command struct {
 	Action       string
 	VMName       string
@@ -32,8 +54,28 @@ type Command struct {
 	Users        []string
 	Verbose      bool
 	NoHosts      bool
+	NoSSHConfig  bool
+	RefreshKeys  bool
+	OlderThan    string
+	DryRun       bool
+	All          bool
+	Output       string
+	Wait         bool
+	Timeout      string
+	RemoteArgs   []string
+	CopySource   string
+	CopyDest     string
+	FirewallRule config.FirewallRule
+	ExtendBy     string
+	SnapshotName string
 }
 
+const (
+	defaultWaitTimeout = "20m"
+	waitPollInterval   = 5 * time.Second
+	idleStatusTimeout  = 15 * time.Second
+)
+
 var verboseEnabled bool
 
 func verboseLog(format string, arguments ...interface{}) {
@@ -74,6 +116,38 @@ func run(args []string) error {
 		return cmdStart(ctx, command)
 	case "dns-swap":
 		return cmdDNSSwap(ctx, command)
+	case "hosts-check":
+		return cmdHostsCheck(ctx, command)
+	case "firewall-allow", "firewall-revoke":
+		return cmdFirewall(ctx, command)
+	case "reap":
+		return cmdReap(ctx, command)
+	case "extend":
+		return cmdExtend(command)
+	case "wait":
+		return cmdWait(ctx, command)
+	case "exec":
+		return cmdExec(ctx, command)
+	case "cp":
+		return cmdCopy(ctx, command)
+	case "migrate":
+		return cmdMigrate(command)
+	case "snapshot-create":
+		return cmdSnapshotCreate(ctx, command)
+	case "snapshot-list":
+		return cmdSnapshotList(command)
+	case "snapshot-restore":
+		return cmdSnapshotRestore(ctx, command)
+	case "snapshot-delete":
+		return cmdSnapshotDelete(ctx, command)
+	case "archive-list":
+		return cmdArchiveList(command)
+	case "archive-clean":
+		return cmdArchiveClean(command)
+	case "archive-delete":
+		return cmdArchiveDelete(command)
+	case "archive-restore":
+		return cmdArchiveRestore(command)
 	default:
 		return fmt.Errorf("unknown command %q\nRun 'goloo help' for usage", command.Action)
 	}
@@ -82,7 +156,11 @@ func run(args []string) error {
 func ParseArgs(args []string) (*Command, error) {
 	verbose := false
 	filtered := make([]string, 0, len(args))
-	for _, arg := range args {
+	for i, arg := range args {
+		if arg == "--" {
+			filtered = append(filtered, args[i:]...)
+			break
+		}
 		if arg == "--verbose" || arg == "-v" {
 			verbose = true
 		} else {
@@ -92,7 +170,7 @@ func ParseArgs(args []string) (*Command, error) {
 	args = filtered
 
 	if len(args) == 0 {
-		return nil, fmt.Errorf("no command provided\n\nUsage: goloo <command> <name> [flags]\nCommands: create, destroy, list, ssh, status, stop, start, dns swap\n\nRun 'goloo help' for details")
+		return nil, fmt.Errorf("no command provided\n\nUsage: goloo <command> <name> [flags]\nCommands: create, destroy, list, ssh, exec, cp, status, stop, start, wait, dns swap, hosts check, firewall, snapshot, reap, extend, archive, migrate\n\nRun 'goloo help' for details")
 	}
 
 	first := args[0]
@@ -130,21 +208,329 @@ func ParseArgs(args []string) (*Command, error) {
 		remaining = remaining[1:]
 	}
 
-	if command.Action == "list" {
+	if command.Action == "archive" {
+		return parseArchiveArgs(command, remaining)
+	}
+
+	if command.Action == "snapshot" {
+		return parseSnapshotArgs(command, remaining)
+	}
+
+	if command.Action == "firewall" {
+		if len(remaining) == 0 || (remaining[0] != "allow" && remaining[0] != "revoke") {
+			return nil, fmt.Errorf("usage: goloo firewall allow|revoke <name> --port PORT[-PORT] [--protocol tcp|udp|icmp|all] [--cidr CIDR|my-ip]")
+		}
+		command.Action = "firewall-" + remaining[0]
+		return parseFirewallArgs(command, remaining[1:])
+	}
+
+	if command.Action == "hosts" {
+		if len(remaining) == 0 || remaining[0] != "check" {
+			return nil, fmt.Errorf("usage: goloo hosts check")
+		}
+		if len(remaining) > 1 {
+			return nil, fmt.Errorf("unknown argument %q for hosts check", remaining[1])
+		}
+		command.Action = "hosts-check"
+		return command, nil
+	}
+
+	if command.Action == "reap" {
 		for _, arg := range remaining {
+			if arg != "--dry-run" {
+				return nil, fmt.Errorf("unknown argument %q for reap command", arg)
+			}
+			command.DryRun = true
+		}
+		return command, nil
+	}
+
+	if command.Action == "extend" {
+		if len(remaining) != 2 || strings.HasPrefix(remaining[0], "-") {
+			return nil, fmt.Errorf("usage: goloo extend <name> <duration>")
+		}
+		command.VMName = remaining[0]
+		command.ExtendBy = remaining[1]
+		if duration, err := config.ParseDuration(command.ExtendBy); err != nil {
+			return nil, err
+		} else if duration == 0 {
+			return nil, fmt.Errorf("invalid duration %q: must be greater than zero", command.ExtendBy)
+		}
+		return command, nil
+	}
+
+	if command.Action == "migrate" {
+		for i := 0; i < len(remaining); i++ {
+			switch remaining[i] {
+			case "--folder", "-f":
+				if i+1 >= len(remaining) {
+					return nil, fmt.Errorf("%s requires a path argument", remaining[i])
+				}
+				i++
+				command.FolderPath = remaining[i]
+			case "--dry-run":
+				command.DryRun = true
+			default:
+				return nil, fmt.Errorf("unknown flag %q for migrate command", remaining[i])
+			}
+		}
+		return command, nil
+	}
+
+	if command.Action == "exec" || command.Action == "ssh" {
+		separator := -1
+		for i, arg := range remaining {
+			if arg == "--" {
+				separator = i
+				break
+			}
+		}
+		if separator >= 0 {
+			command.RemoteArgs = remaining[separator+1:]
+			remaining = remaining[:separator]
+		}
+		if command.Action == "exec" && len(command.RemoteArgs) == 0 {
+			return nil, fmt.Errorf("usage: goloo exec <name> -- <command> [args...]")
+		}
+	}
+
+	if command.Action == "cp" {
+		return parseCopyArgs(command, remaining)
+	}
+
+	if command.Action == "list" {
+		for i := 0; i < len(remaining); i++ {
+			arg := remaining[i]
 			switch arg {
 			case "--aws":
 				command.ProviderFlag = "aws"
 			case "--local":
 				command.ProviderFlag = "local"
+			case "--all":
+				command.All = true
+			case "--output", "-o":
+				if i+1 >= len(remaining) {
+					return nil, fmt.Errorf("%s requires a format: table, json or yaml", arg)
+				}
+				i++
+				command.Output = remaining[i]
 			default:
 				return nil, fmt.Errorf("unknown flag %q for list command", arg)
 			}
 		}
+		return command, validateOutputFormat(command)
+	}
+
+	if _, err := parseNameAndFlags(command, remaining); err != nil {
+		return nil, err
+	}
+	return command, validateOutputFormat(command)
+}
+
+func parseCopyArgs(command *Command, remaining []string) (*Command, error) {
+	var paths []string
+	for i := 0; i < len(remaining); i++ {
+		arg := remaining[i]
+		switch {
+		case arg == "--aws":
+			command.ProviderFlag = "aws"
+		case arg == "--local":
+			command.ProviderFlag = "local"
+		case arg == "--folder" || arg == "-f":
+			if i+1 >= len(remaining) {
+				return nil, fmt.Errorf("%s requires a path argument", arg)
+			}
+			i++
+			command.FolderPath = remaining[i]
+		case strings.HasPrefix(arg, "-"):
+			return nil, fmt.Errorf("unknown flag %q for cp command", arg)
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) != 2 {
+		return nil, fmt.Errorf("usage: goloo cp <name>:<remote-path> <local-path> or goloo cp <local-path> <name>:<remote-path>")
+	}
+
+	sourceName, _, sourceRemote := splitRemotePath(paths[0])
+	destName, _, destRemote := splitRemotePath(paths[1])
+	switch {
+	case sourceRemote && destRemote:
+		return nil, fmt.Errorf("cp copies between this machine and a VM: only one side can be <name>:<path>")
+	case sourceRemote:
+		command.VMName = sourceName
+	case destRemote:
+		command.VMName = destName
+	default:
+		return nil, fmt.Errorf("cp needs one side in the form <name>:<path>")
+	}
+	command.CopySource = paths[0]
+	command.CopyDest = paths[1]
+	return command, nil
+}
+
+func parseFirewallArgs(command *Command, remaining []string) (*Command, error) {
+	command.FirewallRule.CIDR = awsprovider.MyIP
+	for i := 0; i < len(remaining); i++ {
+		arg := remaining[i]
+		switch {
+		case arg == "--port" || arg == "--protocol" || arg == "--cidr" || arg == "--description" || arg == "--folder" || arg == "-f":
+			if i+1 >= len(remaining) {
+				return nil, fmt.Errorf("%s requires a value", arg)
+			}
+			i++
+			value := remaining[i]
+			switch arg {
+			case "--port":
+				from, to, err := parsePortRange(value)
+				if err != nil {
+					return nil, err
+				}
+				command.FirewallRule.Port = from
+				command.FirewallRule.ToPort = to
+			case "--protocol":
+				command.FirewallRule.Protocol = value
+			case "--cidr":
+				command.FirewallRule.CIDR = value
+			case "--description":
+				command.FirewallRule.Description = value
+			default:
+				command.FolderPath = value
+			}
+		case strings.HasPrefix(arg, "-"):
+			return nil, fmt.Errorf("unknown flag %q for firewall command", arg)
+		case command.VMName == "":
+			command.VMName = arg
+		default:
+			return nil, fmt.Errorf("unexpected argument %q: firewall takes one VM name", arg)
+		}
+	}
+	if command.VMName == "" {
+		return nil, fmt.Errorf("usage: goloo firewall allow|revoke <name> --port PORT[-PORT] [--protocol tcp|udp|icmp|all] [--cidr CIDR|my-ip]")
+	}
+	if err := config.ValidateFirewallRule(command.FirewallRule); err != nil {
+		return nil, err
+	}
+	return command, nil
+}
+
+func parsePortRange(value string) (int, int, error) {
+	from, to, isRange := strings.Cut(value, "-")
+	fromPort, err := strconv.Atoi(from)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port %q: use a number like 443 or a range like 8000-8100", value)
+	}
+	if !isRange {
+		return fromPort, 0, nil
+	}
+	toPort, err := strconv.Atoi(to)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port %q: use a number like 443 or a range like 8000-8100", value)
+	}
+	return fromPort, toPort, nil
+}
+
+func splitRemotePath(path string) (string, string, bool) {
+	index := strings.Index(path, ":")
+	if index <= 0 || strings.Contains(path[:index], "/") {
+		return "", path, false
+	}
+	return path[:index], path[index+1:], true
+}
+
+func parseArchiveArgs(command *Command, remaining []string) (*Command, error) {
+	if len(remaining) == 0 {
+		return nil, fmt.Errorf("usage: goloo archive list|clean|delete|restore")
+	}
+
+	subcommand := remaining[0]
+	remaining = remaining[1:]
+	command.Action = "archive-" + subcommand
+
+	switch subcommand {
+	case "list":
+		if len(remaining) > 0 {
+			return nil, fmt.Errorf("unexpected argument %q for archive list", remaining[0])
+		}
+		return command, nil
+	case "clean":
+		for i := 0; i < len(remaining); i++ {
+			switch remaining[i] {
+			case "--older-than":
+				if i+1 >= len(remaining) {
+					return nil, fmt.Errorf("--older-than requires a duration like 30d")
+				}
+				i++
+				command.OlderThan = remaining[i]
+			default:
+				return nil, fmt.Errorf("unknown flag %q for archive clean", remaining[i])
+			}
+		}
 		return command, nil
+	case "delete", "restore":
+		if len(remaining) == 0 {
+			return nil, fmt.Errorf("usage: goloo archive %s <entry>", subcommand)
+		}
+		return parseNameAndFlags(command, remaining)
+	default:
+		return nil, fmt.Errorf("unknown archive subcommand %q: use list, clean, delete or restore", subcommand)
+	}
+}
+
+func parseSnapshotArgs(command *Command, remaining []string) (*Command, error) {
+	if len(remaining) == 0 {
+		return nil, fmt.Errorf("usage: goloo snapshot create|list|restore|delete <name> [snapshot]")
+	}
+
+	subcommand := remaining[0]
+	remaining = remaining[1:]
+	command.Action = "snapshot-" + subcommand
+
+	switch subcommand {
+	case "create", "list", "restore", "delete":
+	default:
+		return nil, fmt.Errorf("unknown snapshot subcommand %q: use create, list, restore or delete", subcommand)
+	}
+	if len(remaining) == 0 || strings.HasPrefix(remaining[0], "-") {
+		return nil, fmt.Errorf("usage: goloo snapshot %s <name>%s", subcommand, snapshotNameUsage(subcommand))
+	}
+
+	flags := remaining
+	if subcommand != "list" && len(remaining) > 1 && !strings.HasPrefix(remaining[1], "-") {
+		command.SnapshotName = remaining[1]
+		flags = append([]string{remaining[0]}, remaining[2:]...)
+	}
+	if command.SnapshotName == "" && (subcommand == "restore" || subcommand == "delete") {
+		return nil, fmt.Errorf("usage: goloo snapshot %s <name>%s", subcommand, snapshotNameUsage(subcommand))
+	}
+	if command.SnapshotName != "" {
+		if err := config.ValidateSnapshotName(command.SnapshotName); err != nil {
+			return nil, err
+		}
+	}
+	return parseNameAndFlags(command, flags)
+}
+
+func snapshotNameUsage(subcommand string) string {
+	switch subcommand {
+	case "create":
+		return " [snapshot]"
+	case "list":
+		return ""
 	}
+	return " <snapshot>"
+}
 
-	return parseNameAndFlags(command, remaining)
+func validateOutputFormat(command *Command) error {
+	switch command.Output {
+	case "", "table", "json", "yaml":
+	default:
+		return fmt.Errorf("unknown output format %q: use table, json or yaml", command.Output)
+	}
+	if command.Output != "" && command.Action != "list" && command.Action != "status" && command.Action != "create" {
+		return fmt.Errorf("--output is only supported by list, status and create")
+	}
+	return nil
 }
 
 func isLegacyInvocation(args []string) bool {
@@ -219,6 +605,24 @@ func parseNameAndFlags(command *Command, remaining []string) (*Command, error) {
 			}
 		case arg == "--no-hosts":
 			command.NoHosts = true
+		case arg == "--no-ssh-config":
+			command.NoSSHConfig = true
+		case arg == "--refresh-keys":
+			command.RefreshKeys = true
+		case arg == "--wait":
+			command.Wait = true
+		case arg == "--timeout":
+			if i+1 >= len(remaining) {
+				return nil, fmt.Errorf("--timeout requires a duration like 20m")
+			}
+			i++
+			command.Timeout = remaining[i]
+		case arg == "--output" || arg == "-o":
+			if i+1 >= len(remaining) {
+				return nil, fmt.Errorf("%s requires a format: table, json or yaml", arg)
+			}
+			i++
+			command.Output = remaining[i]
 		case strings.HasPrefix(arg, "-"):
 			return nil, fmt.Errorf("unknown flag %q\nRun 'goloo help' for usage", arg)
 		default:
@@ -261,6 +665,36 @@ func DetectProviderForState(providerFlag, stackFolder, vmName string) string {
 	return "multipass"
 }
 
+func resolveProvider(stateStore *store.Store, command *Command) string {
+	if command.ProviderFlag == "" && stateStore.Exists(command.VMName) {
+		state, err := stateStore.LoadState(command.VMName)
+		if err == nil {
+			return state.Provider
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	providerName := DetectProviderForState(command.ProviderFlag, resolveStackFolder(command), command.VMName)
+	migrateLegacyState(stateStore, command, providerName)
+	return providerName
+}
+
+func migrateLegacyState(stateStore *store.Store, command *Command, providerName string) {
+	stackFolder := resolveStackFolder(command)
+	if stateStore.Exists(command.VMName) || !config.HasState(stackFolder, command.VMName, providerDirName(providerName)) {
+		return
+	}
+	result, err := stateStore.ImportLegacy(stackFolder, command.VMName, providerName)
+	if err != nil {
+		verboseLog("legacy state for %s not migrated: %v", command.VMName, err)
+		return
+	}
+	if result.Status == store.MigrationImported {
+		verboseLog("migrated legacy state %s into %s", result.StatePath, stateStore.ActiveDir(command.VMName))
+	} else {
+		verboseLog("legacy state %s not migrated: %s %s", result.StatePath, result.Status, result.Reason)
+	}
+}
+
 func providerDirName(providerName string) string {
 	if providerName == "multipass" {
 		return "local"
@@ -307,6 +741,63 @@ func loadConfig(command *Command) (*config.Config, string, error) {
 	return config.LoadFromPath(filepath.Join(stackDir, "config.json"))
 }
 
+const (
+	stateSourceStore  = "store"
+	stateSourceLegacy = "legacy"
+	stateSourceConfig = "config"
+)
+
+func loadManagedConfig(stateStore *store.Store, command *Command, providerName string) (*config.Config, string, error) {
+	if stateStore.Exists(command.VMName) {
+		state, err := stateStore.LoadState(command.VMName)
+		if err != nil {
+			return nil, "", err
+		}
+		if state.Provider == providerName {
+			configuration, _, err := stateStore.LoadConfig(command.VMName)
+			if err != nil {
+				return nil, "", err
+			}
+			return configuration, stateSourceStore, nil
+		}
+	}
+
+	stackFolder := resolveStackFolder(command)
+	dirName := providerDirName(providerName)
+	if config.HasState(stackFolder, command.VMName, dirName) {
+		configuration, _, err := config.LoadState(stackFolder, command.VMName, dirName)
+		if err != nil {
+			return nil, "", err
+		}
+		return configuration, stateSourceLegacy, nil
+	}
+
+	configuration, _, err := loadConfig(command)
+	if err != nil {
+		return nil, "", err
+	}
+	return configuration, stateSourceConfig, nil
+}
+
+func saveManagedState(stateStore *store.Store, command *Command, providerName string, source string, configuration *config.Config) error {
+	switch source {
+	case stateSourceStore:
+		if err := stateStore.UpdateState(command.VMName, configuration); err != nil {
+			return err
+		}
+		stackFolder := resolveStackFolder(command)
+		dirName := providerDirName(providerName)
+		if config.HasState(stackFolder, command.VMName, dirName) {
+			return config.SaveState(stackFolder, command.VMName, dirName, configuration)
+		}
+		return nil
+	case stateSourceLegacy:
+		return config.SaveState(resolveStackFolder(command), command.VMName, providerDirName(providerName), configuration)
+	default:
+		return nil
+	}
+}
+
 func resolveCloudInitPath(command *Command) string {
 	stackDir := resolveStackDir(command)
 	path := filepath.Join(stackDir, "cloud-init.yaml")
@@ -316,6 +807,14 @@ func resolveCloudInitPath(command *Command) string {
 	return path
 }
 
+func sourceConfigDir(configPath string) string {
+	directory := filepath.Dir(configPath)
+	if absolutePath, err := filepath.Abs(directory); err == nil {
+		return absolutePath
+	}
+	return directory
+}
+
 func cmdCreate(ctx context.Context, command *Command) error {
 	verboseLog("loading config for %q", command.VMName)
 	configuration, configPath, err := loadConfig(command)
@@ -326,6 +825,14 @@ func cmdCreate(ctx context.Context, command *Command) error {
 		configPath, configuration.VM.Name, configuration.VM.Image,
 		configuration.VM.CPUs, configuration.VM.Memory, configuration.VM.Disk)
 
+	stateStore, err := store.Open()
+	if err != nil {
+		return err
+	}
+	if stateStore.Exists(command.VMName) {
+		return fmt.Errorf("VM %q already exists in %s: destroy it first", command.VMName, stateStore.ActiveDir(command.VMName))
+	}
+
 	if len(command.Users) > 0 {
 		users := make([]config.User, len(command.Users))
 		for i, githubUsername := range command.Users {
@@ -344,13 +851,17 @@ func cmdCreate(ctx context.Context, command *Command) error {
 
 	providerName := DetectProvider(command.ProviderFlag)
 	verboseLog("provider: %s", providerName)
+	if err := config.ValidateForProvider(configuration, providerName); err != nil {
+		return err
+	}
 	vmProvider, err := getProvider(providerName, configuration.VM.Region, command.Verbose)
 	if err != nil {
 		return err
 	}
-
-	stackFolder := resolveStackFolder(command)
-	dirName := providerDirName(providerName)
+	if awsProvider, ok := vmProvider.(*awsprovider.Provider); ok {
+		awsProvider.StackFolder = sourceConfigDir(configPath)
+		awsProvider.Version = version
+	}
 
 	cloudInitSource := resolveCloudInitPath(command)
 	cloudInitPath := ""
@@ -360,8 +871,17 @@ func cmdCreate(ctx context.Context, command *Command) error {
 			if user.GitHubUsername != "" {
 				verboseLog("fetching SSH keys from github.com/%s.keys", user.GitHubUsername)
 			}
+			if user.GitLabUsername != "" {
+				verboseLog("fetching SSH keys for GitLab user %s", user.GitLabUsername)
+			}
+			for _, path := range user.SSHKeyFiles {
+				verboseLog("reading SSH keys for %s from %s", user.Username, path)
+			}
+			if user.SSHKeysFromAgent {
+				verboseLog("reading SSH keys for %s from ssh-agent", user.Username)
+			}
 		}
-		processedPath, err := cloudinit.Process(cloudInitSource, configuration, cloudinit.FetchGitHubKeys)
+		processedPath, err := cloudinit.ProcessWithSources(cloudInitSource, configuration, keySources(ctx, command))
 		if err != nil {
 			return fmt.Errorf("cloud-init processing failed: %w", err)
 		}
@@ -375,35 +895,71 @@ func cmdCreate(ctx context.Context, command *Command) error {
 		return err
 	}
 
-	verboseLog("saving state to %s/%s/%s/config.json", stackFolder, command.VMName, dirName)
+	verboseLog("saving state to %s", stateStore.ActiveDir(command.VMName))
+	if err := stateStore.SaveConfig(command.VMName, configuration); err != nil {
+		return fmt.Errorf("VM created but failed to save config snapshot: %w", err)
+	}
+	if err := stateStore.CopyCloudInit(command.VMName, cloudInitSource); err != nil {
+		verboseLog("warning: failed to copy cloud-init to state: %v", err)
+	}
+	state := store.NewState(command.VMName, providerName, sourceConfigDir(configPath), configuration)
+	if err := stateStore.SaveState(command.VMName, state); err != nil {
+		return fmt.Errorf("VM created but failed to save state: %w", err)
+	}
+	stackFolder := resolveStackFolder(command)
+	dirName := providerDirName(providerName)
 	if err := config.SaveState(stackFolder, command.VMName, dirName, configuration); err != nil {
 		return fmt.Errorf("VM created but failed to save state: %w", err)
 	}
+	if err := config.CopyCloudInitToState(stackFolder, command.VMName, dirName, cloudInitPath); err != nil {
+		verboseLog("warning: failed to copy cloud-init to state: %v", err)
+	}
 
-	if cloudInitPath != "" {
-		if err := config.CopyCloudInitToState(stackFolder, command.VMName, dirName, cloudInitPath); err != nil {
-			verboseLog("warning: failed to copy cloud-init to state: %v", err)
-		}
+	messages := io.Writer(os.Stdout)
+	if structuredOutput(command) {
+		messages = os.Stderr
 	}
 
 	hostsAdded := false
-	if providerName == "multipass" && !command.NoHosts && configuration.Local != nil && configuration.Local.IP != "" {
+	if address := hostsAddress(providerName, configuration); !command.NoHosts && address != "" {
 		hostnames := hosts.BuildHostnames(configuration.VM.Name, dnsHostname(configuration), dnsDomain(configuration))
-		fmt.Println("Adding hostname to /etc/hosts (requires sudo)")
-		if err := hosts.Add(configuration.VM.Name, configuration.Local.IP, hostnames, command.Verbose); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to update /etc/hosts: %v\n", err)
-			fmt.Fprintln(os.Stderr, hosts.ManualInstructions(configuration.Local.IP, hostnames, configuration.VM.Name))
-		} else {
+		hostsBackend, err := selectHostsBackend(configuration)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else if err := addHostsEntry(hostsBackend, configuration.VM.Name, address, hostnames, command, messages); err == nil {
 			hostsAdded = true
-			configuration.Local.HostsEntry = true
-			if saveErr := config.SaveState(stackFolder, command.VMName, dirName, configuration); saveErr != nil {
+			state := hostsState(providerName, configuration)
+			state.HostsEntry = true
+			state.HostsBackend = hostsBackend.Name
+			state.HostsFile = hostsBackend.Path
+			if saveErr := saveManagedState(stateStore, command, providerName, stateSourceStore, configuration); saveErr != nil {
 				fmt.Fprintf(os.Stderr, "Warning: hosts entry added but failed to save state: %v\n", saveErr)
 			}
 		}
 	}
 
+	sshConfigAdded := addSSHConfigEntry(command, providerName, configuration)
+
+	if command.Wait {
+		if err := waitForCloudInit(ctx, vmProvider, configuration, command, messages); err != nil {
+			return err
+		}
+	}
+
+	if structuredOutput(command) {
+		status, err := vmProvider.Status(ctx, configuration)
+		if err != nil {
+			verboseLog("status after create failed: %v", err)
+			status = &provider.VMStatus{Name: configuration.VM.Name, State: "created", Provider: providerName}
+		}
+		enrichStatus(status, configuration, state)
+		return writeOutput(command.Output, status)
+	}
+
 	fmt.Printf("Created %s via %s\n", configuration.VM.Name, vmProvider.Name())
-	if configuration.AWS != nil && configuration.AWS.PublicIP != "" {
+	if configuration.AWS != nil && configuration.AWS.ElasticIPAllocationID != "" {
+		fmt.Printf("IP: %s (Elastic IP %s)\n", configuration.AWS.PublicIP, configuration.AWS.ElasticIPAllocationID)
+	} else if configuration.AWS != nil && configuration.AWS.PublicIP != "" {
 		fmt.Printf("IP: %s\n", configuration.AWS.PublicIP)
 	} else if configuration.Local != nil && configuration.Local.IP != "" {
 		fmt.Printf("IP: %s\n", configuration.Local.IP)
@@ -416,28 +972,28 @@ func cmdCreate(ctx context.Context, command *Command) error {
 		fmt.Printf("Hosts: %s\n", strings.Join(hostnames, ", "))
 	}
 	fmt.Printf("SSH: goloo ssh %s\n", configuration.VM.Name)
+	if sshConfigAdded {
+		fmt.Printf("SSH config: ssh %s\n", configuration.VM.Name)
+	}
 
 	return nil
 }
 
 func cmdDestroy(ctx context.Context, command *Command) error {
+	stateStore, err := store.Open()
+	if err != nil {
+		return err
+	}
+
 	providerName := DetectProvider(command.ProviderFlag)
-	dirName := providerDirName(providerName)
-	stackFolder := resolveStackFolder(command)
+	if command.ProviderFlag == "" && stateStore.Exists(command.VMName) {
+		providerName = resolveProvider(stateStore, command)
+	}
+	migrateLegacyState(stateStore, command, providerName)
 
-	var configuration *config.Config
-	if config.HasState(stackFolder, command.VMName, dirName) {
-		cfg, _, err := config.LoadState(stackFolder, command.VMName, dirName)
-		if err != nil {
-			return err
-		}
-		configuration = cfg
-	} else {
-		cfg, _, err := loadConfig(command)
-		if err != nil {
-			return err
-		}
-		configuration = cfg
+	configuration, source, err := loadManagedConfig(stateStore, command, providerName)
+	if err != nil {
+		return err
 	}
 
 	vmProvider, err := getProvider(providerName, configuration.VM.Region, command.Verbose)
@@ -449,252 +1005,1425 @@ func cmdDestroy(ctx context.Context, command *Command) error {
 		return err
 	}
 
-	if providerName == "multipass" && !command.NoHosts && hosts.HasEntry(configuration.VM.Name) {
-		fmt.Println("Removing hostname from /etc/hosts (requires sudo)")
-		if err := hosts.Remove(configuration.VM.Name, command.Verbose); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to remove /etc/hosts entry: %v\n", err)
+	if !command.NoHosts {
+		if hostsBackend, err := recordedHostsBackend(providerName, configuration); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else if hostsBackend.HasEntry(configuration.VM.Name) {
+			if hostsBackend.Privileged {
+				fmt.Printf("Removing hostname from %s (may require sudo)\n", hostsBackend.Path)
+			} else {
+				fmt.Printf("Removing hostname from %s\n", hostsBackend.Path)
+			}
+			if err := hostsBackend.Remove(configuration.VM.Name, command.Verbose); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to remove %s entry: %v\n", hostsBackend.Path, err)
+			}
 		}
 	}
 
-	if err := config.ClearState(stackFolder, command.VMName, dirName); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to remove state directory: %v\n", err)
+	removeSSHConfigEntry(command, configuration.VM.Name)
+
+	recordedSource := ""
+	if source == stateSourceStore {
+		if state, err := stateStore.LoadState(command.VMName); err == nil {
+			recordedSource = state.SourceConfigPath
+			if providerName == "aws" {
+				for _, snapshot := range state.Snapshots {
+					fmt.Fprintf(os.Stderr, "Warning: snapshot %s (%s) is kept; deregister it in the EC2 console when no longer needed\n", snapshot.Name, snapshot.ID)
+				}
+			}
+		}
 	}
 
-	fmt.Printf("Destroyed %s\n", configuration.VM.Name)
+	if source == stateSourceStore {
+		entry, err := stateStore.Archive(command.VMName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to archive state: %v\n", err)
+		} else {
+			verboseLog("state archived as %s", entry)
+		}
+	}
+	stackFolder := resolveStackFolder(command)
+	ownsLegacyState := source == stateSourceLegacy || isRecordedStackFolder(stackFolder, command.VMName, recordedSource)
+	if ownsLegacyState && config.HasState(stackFolder, command.VMName, providerDirName(providerName)) {
+		if err := config.ClearState(stackFolder, command.VMName, providerDirName(providerName)); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove legacy state directory: %v\n", err)
+		}
+	}
+
+	fmt.Printf("Destroyed %s\n", configuration.VM.Name)
 	return nil
 }
 
-func cmdList(ctx context.Context, command *Command) error {
-	providerName := "multipass"
-	if command.ProviderFlag == "aws" {
-		providerName = "aws"
+func isRecordedStackFolder(stackFolder, vmName, recordedSource string) bool {
+	if recordedSource == "" {
+		return false
+	}
+	recordedSource = filepath.Clean(recordedSource)
+	for _, candidate := range []string{config.ResolveFolder(stackFolder, vmName), stackFolder} {
+		if directory, err := filepath.Abs(candidate); err == nil && directory == recordedSource {
+			return true
+		}
 	}
+	return false
+}
+
+type knownVM struct {
+	Name        string
+	Provider    string
+	Region      string
+	StackFolder string
+	CreatedAt   time.Time
+	ExpiresAt   *time.Time
+}
+
+type listSource struct {
+	Provider string
+	Region   string
+}
+
+type listResult struct {
+	Source   listSource
+	Statuses []provider.VMStatus
+	Err      error
+}
+
+type listRow struct {
+	Status      provider.VMStatus
+	Region      string
+	StackFolder string
+	Orphan      bool
+	ExpiresAt   *time.Time
+}
+
+type listOutput struct {
+	provider.VMStatus `yaml:",inline"`
+	Region            string     `json:"region" yaml:"region"`
+	StackFolder       string     `json:"stack_folder" yaml:"stack_folder"`
+	Orphan            bool       `json:"orphan" yaml:"orphan"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+}
 
-	vmProvider, err := getProvider(providerName, "us-east-1", command.Verbose)
+func loadKnownVMs(stateStore *store.Store) []knownVM {
+	names, err := stateStore.ListActive()
 	if err != nil {
-		return err
+		verboseLog("failed to read state directory: %v", err)
+		return nil
+	}
+	known := make([]knownVM, 0, len(names))
+	for _, name := range names {
+		configuration, state, err := stateStore.LoadConfig(name)
+		if err != nil {
+			verboseLog("skipping state for %s: %v", name, err)
+			continue
+		}
+		vm := knownVM{
+			Name:        configuration.VM.Name,
+			Provider:    state.Provider,
+			StackFolder: state.SourceConfigPath,
+			CreatedAt:   state.CreatedAt,
+			ExpiresAt:   state.ExpiresAt,
+		}
+		if state.Provider == "aws" {
+			vm.Region = configuration.VM.Region
+			if state.AWS != nil && state.AWS.Region != "" {
+				vm.Region = state.AWS.Region
+			}
+		}
+		known = append(known, vm)
 	}
+	return known
+}
 
-	statuses, err := vmProvider.List(ctx)
-	if err != nil {
-		return err
+func buildListSources(providerFlag string, all bool, known []knownVM, defaultRegion func() string) []listSource {
+	var sources []listSource
+	if all || providerFlag != "aws" {
+		sources = append(sources, listSource{Provider: "multipass"})
+	}
+	if all || providerFlag == "aws" {
+		seen := make(map[string]bool)
+		for _, vm := range known {
+			if vm.Provider == "aws" && vm.Region != "" && !seen[vm.Region] {
+				seen[vm.Region] = true
+				sources = append(sources, listSource{Provider: "aws", Region: vm.Region})
+			}
+		}
+		if len(seen) == 0 {
+			sources = append(sources, listSource{Provider: "aws", Region: defaultRegion()})
+		}
+	}
+	sort.SliceStable(sources, func(i, j int) bool {
+		if sources[i].Provider != sources[j].Provider {
+			return sources[i].Provider > sources[j].Provider
+		}
+		return sources[i].Region < sources[j].Region
+	})
+	return sources
+}
+
+func fetchListResults(ctx context.Context, sources []listSource, verbose bool) []listResult {
+	results := make([]listResult, len(sources))
+	var waitGroup sync.WaitGroup
+	for i, source := range sources {
+		waitGroup.Add(1)
+		go func(i int, source listSource) {
+			defer waitGroup.Done()
+			results[i].Source = source
+			vmProvider, err := getProvider(source.Provider, source.Region, verbose)
+			if err != nil {
+				results[i].Err = err
+				return
+			}
+			results[i].Statuses, results[i].Err = vmProvider.List(ctx)
+		}(i, source)
+	}
+	waitGroup.Wait()
+	return results
+}
+
+func buildListRows(results []listResult, known []knownVM) []listRow {
+	index := make(map[listSource]map[string]knownVM)
+	for _, vm := range known {
+		source := listSource{Provider: vm.Provider, Region: vm.Region}
+		if index[source] == nil {
+			index[source] = make(map[string]knownVM)
+		}
+		index[source][vm.Name] = vm
+	}
+
+	var rows []listRow
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		expected := index[result.Source]
+		found := make(map[string]bool)
+		for _, status := range result.Statuses {
+			row := listRow{Status: status, Region: result.Source.Region}
+			if vm, exists := expected[status.Name]; exists {
+				row.StackFolder = vm.StackFolder
+				row.ExpiresAt = vm.ExpiresAt
+				if row.Status.CreatedAt == nil && !vm.CreatedAt.IsZero() {
+					createdAt := vm.CreatedAt
+					row.Status.CreatedAt = &createdAt
+				}
+				found[status.Name] = true
+			} else {
+				row.Orphan = true
+			}
+			rows = append(rows, row)
+		}
+
+		var missing []string
+		for name := range expected {
+			if !found[name] {
+				missing = append(missing, name)
+			}
+		}
+		sort.Strings(missing)
+		for _, name := range missing {
+			rows = append(rows, listRow{
+				Status:      provider.VMStatus{Name: name, State: "missing", Provider: result.Source.Provider},
+				Region:      result.Source.Region,
+				StackFolder: expected[name].StackFolder,
+				ExpiresAt:   expected[name].ExpiresAt,
+			})
+		}
+	}
+	return rows
+}
+
+func cmdList(ctx context.Context, command *Command) error {
+	var known []knownVM
+	if stateStore, err := store.Open(); err == nil {
+		known = loadKnownVMs(stateStore)
+	}
+
+	sources := buildListSources(command.ProviderFlag, command.All, known, func() string {
+		return awsprovider.DefaultRegion(ctx)
+	})
+	results := fetchListResults(ctx, sources, command.Verbose)
+
+	failures := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failures++
+			fmt.Fprintf(os.Stderr, "Warning: %s", result.Source.Provider)
+			if result.Source.Region != "" {
+				fmt.Fprintf(os.Stderr, " (%s)", result.Source.Region)
+			}
+			fmt.Fprintf(os.Stderr, ": %v\n", result.Err)
+		}
+	}
+	if failures == len(results) {
+		return results[0].Err
+	}
+
+	rows := buildListRows(results, known)
+	if structuredOutput(command) {
+		output := make([]listOutput, 0, len(rows))
+		for _, row := range rows {
+			output = append(output, listOutput{
+				VMStatus:    row.Status,
+				Region:      row.Region,
+				StackFolder: row.StackFolder,
+				Orphan:      row.Orphan,
+				ExpiresAt:   row.ExpiresAt,
+			})
+		}
+		return writeOutput(command.Output, output)
 	}
 
-	if len(statuses) == 0 {
+	if len(rows) == 0 {
 		fmt.Println("No VMs found")
 		return nil
 	}
 
-	fmt.Printf("%-20s %-12s %-16s %s\n", "NAME", "STATE", "IP", "PROVIDER")
-	for _, status := range statuses {
-		ip := status.IP
+	now := time.Now()
+	fmt.Printf("%-20s %-12s %-16s %-10s %-12s %-10s %s\n", "NAME", "STATE", "IP", "PROVIDER", "REGION", "EXPIRES", "STACK")
+	for _, row := range rows {
+		ip := row.Status.IP
 		if ip == "" {
 			ip = "-"
 		}
-		fmt.Printf("%-20s %-12s %-16s %s\n", status.Name, status.State, ip, status.Provider)
+		region := row.Region
+		if region == "" {
+			region = "-"
+		}
+		stackFolder := row.StackFolder
+		if row.Orphan {
+			stackFolder = "(orphan: no goloo state)"
+		} else if stackFolder == "" {
+			stackFolder = "-"
+		}
+		fmt.Printf("%-20s %-12s %-16s %-10s %-12s %-10s %s\n", row.Status.Name, row.Status.State, ip, row.Status.Provider, region, formatRemaining(row.ExpiresAt, now), stackFolder)
 	}
 
 	return nil
 }
 
-func cmdSSH(ctx context.Context, command *Command) error {
-	stackFolder := resolveStackFolder(command)
-	providerName := DetectProviderForState(command.ProviderFlag, stackFolder, command.VMName)
-	dirName := providerDirName(providerName)
+func formatRemaining(expiresAt *time.Time, now time.Time) string {
+	if expiresAt == nil {
+		return "-"
+	}
+	remaining := expiresAt.Sub(now)
+	if remaining <= 0 {
+		return "expired"
+	}
+	return formatDuration(remaining)
+}
 
-	var configuration *config.Config
-	if config.HasState(stackFolder, command.VMName, dirName) {
-		cfg, _, err := config.LoadState(stackFolder, command.VMName, dirName)
+func formatDuration(duration time.Duration) string {
+	duration = duration.Round(time.Minute)
+	days := int(duration / (24 * time.Hour))
+	hours := int(duration % (24 * time.Hour) / time.Hour)
+	minutes := int(duration % time.Hour / time.Minute)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+type expiredVM struct {
+	Name        string
+	Provider    string
+	Action      string
+	ExpiresAt   time.Time
+	StackFolder string
+}
+
+func findExpiredVMs(stateStore *store.Store, now time.Time) []expiredVM {
+	names, err := stateStore.ListActive()
+	if err != nil {
+		verboseLog("failed to read state directory: %v", err)
+		return nil
+	}
+	var expired []expiredVM
+	for _, name := range names {
+		state, err := stateStore.LoadState(name)
 		if err != nil {
-			return err
+			verboseLog("skipping state for %s: %v", name, err)
+			continue
 		}
-		configuration = cfg
-	} else {
-		cfg, _, err := loadConfig(command)
+		if !state.Expired(now) {
+			continue
+		}
+		configuration, _, err := stateStore.LoadConfig(name)
 		if err != nil {
-			return err
+			fmt.Fprintf(os.Stderr, "Warning: skipping expired VM %s: %v\n", name, err)
+			continue
 		}
-		configuration = cfg
+		action := configuration.VM.TTLAction
+		if action == "" {
+			action = config.TTLActionStop
+		}
+		vm := expiredVM{Name: name, Provider: state.Provider, Action: action, ExpiresAt: *state.ExpiresAt}
+		if state.SourceConfigPath != "" {
+			vm.StackFolder = filepath.Dir(state.SourceConfigPath)
+		}
+		expired = append(expired, vm)
 	}
+	return expired
+}
 
-	vmProvider, err := getProvider(providerName, configuration.VM.Region, command.Verbose)
+func cmdReap(ctx context.Context, command *Command) error {
+	stateStore, err := store.Open()
 	if err != nil {
 		return err
 	}
 
-	return vmProvider.SSH(ctx, configuration)
-}
+	now := time.Now()
+	expired := findExpiredVMs(stateStore, now)
+	if len(expired) == 0 {
+		fmt.Println("No expired VMs")
+		return nil
+	}
 
-func cmdStatus(ctx context.Context, command *Command) error {
-	stackFolder := resolveStackFolder(command)
-	providerName := DetectProviderForState(command.ProviderFlag, stackFolder, command.VMName)
-	dirName := providerDirName(providerName)
+	failures := 0
+	for _, vm := range expired {
+		overdue := formatDuration(now.Sub(vm.ExpiresAt))
+		if command.DryRun {
+			fmt.Printf("Would %s %s (%s, expired %s ago)\n", vm.Action, vm.Name, vm.Provider, overdue)
+			continue
+		}
 
-	var configuration *config.Config
-	if config.HasState(stackFolder, command.VMName, dirName) {
-		cfg, _, err := config.LoadState(stackFolder, command.VMName, dirName)
-		if err != nil {
-			return err
+		vmCommand := &Command{Action: vm.Action, VMName: vm.Name, FolderPath: vm.StackFolder, Verbose: command.Verbose}
+		if vm.Action == config.TTLActionStop {
+			if stopped, err := vmIsStopped(ctx, stateStore, vmCommand); err == nil && stopped {
+				verboseLog("%s is already stopped", vm.Name)
+				continue
+			}
+		}
+
+		fmt.Printf("Reaping %s (%s, expired %s ago): %s\n", vm.Name, vm.Provider, overdue, vm.Action)
+		if vm.Action == config.TTLActionDestroy {
+			err = cmdDestroy(ctx, vmCommand)
+		} else {
+			err = cmdStop(ctx, vmCommand)
 		}
-		configuration = cfg
-	} else {
-		cfg, _, err := loadConfig(command)
 		if err != nil {
-			return err
+			failures++
+			fmt.Fprintf(os.Stderr, "Warning: failed to %s %s: %v\n", vm.Action, vm.Name, err)
 		}
-		configuration = cfg
 	}
 
+	if failures > 0 {
+		return fmt.Errorf("%d of %d expired VMs could not be reaped", failures, len(expired))
+	}
+	return nil
+}
+
+func vmIsStopped(ctx context.Context, stateStore *store.Store, command *Command) (bool, error) {
+	providerName := resolveProvider(stateStore, command)
+	configuration, _, err := loadManagedConfig(stateStore, command, providerName)
+	if err != nil {
+		return false, err
+	}
 	vmProvider, err := getProvider(providerName, configuration.VM.Region, command.Verbose)
+	if err != nil {
+		return false, err
+	}
+	status, err := vmProvider.Status(ctx, configuration)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(status.State) {
+	case "stopped", "stopping", "suspended":
+		return true, nil
+	}
+	return false, nil
+}
+
+func cmdExtend(command *Command) error {
+	duration, err := config.ParseDuration(command.ExtendBy)
 	if err != nil {
 		return err
 	}
 
-	status, err := vmProvider.Status(ctx, configuration)
+	stateStore, err := store.Open()
+	if err != nil {
+		return err
+	}
+	if !stateStore.Exists(command.VMName) {
+		return fmt.Errorf("VM %q not found in %s", command.VMName, stateStore.ActiveDir(command.VMName))
+	}
+	state, err := stateStore.LoadState(command.VMName)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Name:     %s\n", status.Name)
-	fmt.Printf("State:    %s\n", status.State)
-	fmt.Printf("Provider: %s\n", status.Provider)
-	if status.IP != "" {
-		fmt.Printf("IP:       %s\n", status.IP)
+	now := time.Now()
+	state.Extend(duration, now)
+	if err := stateStore.SaveState(command.VMName, state); err != nil {
+		return err
 	}
 
+	fmt.Printf("%s now expires %s (in %s)\n", command.VMName, state.ExpiresAt.Local().Format("2006-01-02 15:04 MST"), formatRemaining(state.ExpiresAt, now))
 	return nil
 }
 
-func cmdStop(ctx context.Context, command *Command) error {
-	stackFolder := resolveStackFolder(command)
-	providerName := DetectProviderForState(command.ProviderFlag, stackFolder, command.VMName)
-	dirName := providerDirName(providerName)
+func loadSnapshotter(command *Command) (provider.Snapshotter, *config.Config, *store.Store, *store.State, error) {
+	stateStore, err := store.Open()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	providerName := resolveProvider(stateStore, command)
 
-	var configuration *config.Config
-	if config.HasState(stackFolder, command.VMName, dirName) {
-		cfg, _, err := config.LoadState(stackFolder, command.VMName, dirName)
-		if err != nil {
-			return err
-		}
-		configuration = cfg
-	} else {
-		cfg, _, err := loadConfig(command)
-		if err != nil {
-			return err
-		}
-		configuration = cfg
+	configuration, source, err := loadManagedConfig(stateStore, command, providerName)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if source != stateSourceStore {
+		return nil, nil, nil, nil, fmt.Errorf("no goloo state for %s: snapshots are recorded in the state directory, run 'goloo migrate' for VMs created by older versions", command.VMName)
+	}
+	state, err := stateStore.LoadState(command.VMName)
+	if err != nil {
+		return nil, nil, nil, nil, err
 	}
 
 	vmProvider, err := getProvider(providerName, configuration.VM.Region, command.Verbose)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if awsProvider, ok := vmProvider.(*awsprovider.Provider); ok {
+		awsProvider.StackFolder = state.SourceConfigPath
+		awsProvider.Version = version
+	}
+	snapshotter, ok := vmProvider.(provider.Snapshotter)
+	if !ok {
+		return nil, nil, nil, nil, fmt.Errorf("provider %s does not support snapshots", vmProvider.Name())
+	}
+	return snapshotter, configuration, stateStore, state, nil
+}
+
+func cmdSnapshotCreate(ctx context.Context, command *Command) error {
+	snapshotter, configuration, stateStore, state, err := loadSnapshotter(command)
 	if err != nil {
 		return err
 	}
 
-	if err := vmProvider.Stop(ctx, configuration); err != nil {
+	name := command.SnapshotName
+	if name == "" {
+		name = "snap-" + time.Now().UTC().Format("20060102-150405")
+	}
+	if _, exists := state.FindSnapshot(name); exists {
+		return fmt.Errorf("%s already has a snapshot named %q", command.VMName, name)
+	}
+
+	fmt.Printf("Creating snapshot %s of %s...\n", name, command.VMName)
+	if state.Provider == "aws" {
+		fmt.Printf("AWS reboots %s while it takes the image so the snapshot is consistent\n", command.VMName)
+	}
+	snapshot, err := snapshotter.CreateSnapshot(ctx, configuration, name)
+	if err != nil {
 		return err
 	}
+	state.Snapshots = append(state.Snapshots, *snapshot)
+	if err := stateStore.SaveState(command.VMName, state); err != nil {
+		return fmt.Errorf("snapshot %s (%s) was created but could not be recorded: %w", name, snapshot.ID, err)
+	}
 
-	fmt.Printf("Stopped %s\n", configuration.VM.Name)
+	fmt.Printf("Created snapshot %s (%s)\n", name, snapshot.ID)
 	return nil
 }
 
-func cmdStart(ctx context.Context, command *Command) error {
-	stackFolder := resolveStackFolder(command)
-	providerName := DetectProviderForState(command.ProviderFlag, stackFolder, command.VMName)
-	dirName := providerDirName(providerName)
+func cmdSnapshotList(command *Command) error {
+	stateStore, err := store.Open()
+	if err != nil {
+		return err
+	}
+	if !stateStore.Exists(command.VMName) {
+		return fmt.Errorf("VM %q not found in %s", command.VMName, stateStore.ActiveDir(command.VMName))
+	}
+	state, err := stateStore.LoadState(command.VMName)
+	if err != nil {
+		return err
+	}
 
-	var configuration *config.Config
-	hasState := config.HasState(stackFolder, command.VMName, dirName)
-	if hasState {
-		cfg, _, err := config.LoadState(stackFolder, command.VMName, dirName)
-		if err != nil {
-			return err
-		}
-		configuration = cfg
-	} else {
-		cfg, _, err := loadConfig(command)
-		if err != nil {
-			return err
-		}
-		configuration = cfg
+	if len(state.Snapshots) == 0 {
+		fmt.Printf("No snapshots for %s\n", command.VMName)
+		return nil
 	}
 
-	vmProvider, err := getProvider(providerName, configuration.VM.Region, command.Verbose)
+	fmt.Printf("%-24s %-24s %s\n", "NAME", "ID", "CREATED")
+	for _, snapshot := range state.Snapshots {
+		fmt.Printf("%-24s %-24s %s\n", snapshot.Name, snapshot.ID, snapshot.CreatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+func cmdSnapshotRestore(ctx context.Context, command *Command) error {
+	snapshotter, configuration, _, state, err := loadSnapshotter(command)
 	if err != nil {
 		return err
 	}
+	snapshot, exists := state.FindSnapshot(command.SnapshotName)
+	if !exists {
+		return fmt.Errorf("%s has no snapshot named %q: see 'goloo snapshot list %s'", command.VMName, command.SnapshotName, command.VMName)
+	}
 
-	if err := vmProvider.Start(ctx, configuration); err != nil {
+	fmt.Printf("Restoring %s to snapshot %s...\n", command.VMName, snapshot.Name)
+	if err := snapshotter.RestoreSnapshot(ctx, configuration, snapshot); err != nil {
 		return err
 	}
+	fmt.Printf("Restored %s to snapshot %s\n", command.VMName, snapshot.Name)
+	if warning := dataVolumeRestoreWarning(state.Provider, snapshot); warning != "" {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+	return nil
+}
 
-	fmt.Printf("Started %s\n", configuration.VM.Name)
-
-	status, err := vmProvider.Status(ctx, configuration)
-	if err == nil && status.IP != "" {
-		currentIP := ""
-		if configuration.AWS != nil {
-			currentIP = configuration.AWS.PublicIP
-		} else if configuration.Local != nil {
-			currentIP = configuration.Local.IP
-		}
-		if status.IP != currentIP {
-			if configuration.AWS != nil {
-				configuration.AWS.PublicIP = status.IP
-			} else if configuration.Local != nil {
-				configuration.Local.IP = status.IP
-			}
-			if hasState {
-				if saveErr := config.SaveState(stackFolder, command.VMName, dirName, configuration); saveErr != nil {
-					fmt.Fprintf(os.Stderr, "Warning: started but failed to save updated IP: %v\n", saveErr)
-				}
-			}
-			fmt.Printf("IP: %s\n", status.IP)
+func dataVolumeRestoreWarning(providerName string, snapshot config.Snapshot) string {
+	if providerName != "aws" || len(snapshot.SnapshotIDs) < 2 {
+		return ""
+	}
+	return fmt.Sprintf("Warning: only the root volume was restored; data volumes keep their current contents. The image %s holds snapshots %s: create volumes from them by hand to roll data back",
+		snapshot.ID, strings.Join(snapshot.SnapshotIDs, ", "))
+}
 
-			if providerName == "multipass" && !command.NoHosts && configuration.Local != nil && configuration.Local.HostsEntry {
-				hostnames := hosts.BuildHostnames(configuration.VM.Name, dnsHostname(configuration), dnsDomain(configuration))
-				if err := hosts.Add(configuration.VM.Name, status.IP, hostnames, command.Verbose); err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: failed to update /etc/hosts with new IP: %v\n", err)
-				}
-			}
-		}
+func cmdSnapshotDelete(ctx context.Context, command *Command) error {
+	snapshotter, configuration, stateStore, state, err := loadSnapshotter(command)
+	if err != nil {
+		return err
+	}
+	snapshot, exists := state.FindSnapshot(command.SnapshotName)
+	if !exists {
+		return fmt.Errorf("%s has no snapshot named %q: see 'goloo snapshot list %s'", command.VMName, command.SnapshotName, command.VMName)
 	}
 
+	if err := snapshotter.DeleteSnapshot(ctx, configuration, snapshot); err != nil {
+		return err
+	}
+	state.RemoveSnapshot(snapshot.Name)
+	if err := stateStore.SaveState(command.VMName, state); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted snapshot %s of %s\n", snapshot.Name, command.VMName)
 	return nil
 }
 
-func cmdDNSSwap(ctx context.Context, command *Command) error {
-	stackFolder := resolveStackFolder(command)
+func cmdSSH(ctx context.Context, command *Command) error {
+	stateStore, err := store.Open()
+	if err != nil {
+		return err
+	}
+	providerName := resolveProvider(stateStore, command)
 
-	var configuration *config.Config
-	if config.HasState(stackFolder, command.VMName, "aws") {
-		cfg, _, err := config.LoadState(stackFolder, command.VMName, "aws")
-		if err != nil {
-			return err
-		}
-		configuration = cfg
-	} else {
-		cfg, _, err := loadConfig(command)
-		if err != nil {
-			return err
-		}
-		configuration = cfg
+	configuration, _, err := loadManagedConfig(stateStore, command, providerName)
+	if err != nil {
+		return err
 	}
 
-	awsProvider, err := awsprovider.NewWithSDK(configuration.VM.Region)
+	vmProvider, err := getProvider(providerName, configuration.VM.Region, command.Verbose)
 	if err != nil {
 		return err
 	}
-	if err := awsProvider.SwapDNS(ctx, configuration); err != nil {
+
+	return vmProvider.SSH(ctx, configuration, command.RemoteArgs)
+}
+
+func cmdWait(ctx context.Context, command *Command) error {
+	stateStore, err := store.Open()
+	if err != nil {
 		return err
 	}
+	providerName := resolveProvider(stateStore, command)
 
-	if err := config.SaveState(stackFolder, command.VMName, "aws", configuration); err != nil {
-		return fmt.Errorf("DNS swapped but failed to save state: %w", err)
+	configuration, _, err := loadManagedConfig(stateStore, command, providerName)
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("DNS swapped: %s -> %s\n", configuration.AWS.FQDN, configuration.AWS.PublicIP)
-	return nil
+	vmProvider, err := getProvider(providerName, configuration.VM.Region, command.Verbose)
+	if err != nil {
+		return err
+	}
+
+	if err := waitForCloudInit(ctx, vmProvider, configuration, command, os.Stdout); err != nil {
+		return err
+	}
+	fmt.Printf("%s is ready\n", configuration.VM.Name)
+	return nil
+}
+
+func waitForCloudInit(ctx context.Context, vmProvider provider.VMProvider, configuration *config.Config, command *Command, messages io.Writer) error {
+	checker, ok := vmProvider.(provider.ReadinessChecker)
+	if !ok {
+		return fmt.Errorf("provider %s does not support waiting for cloud-init", vmProvider.Name())
+	}
+
+	timeout := command.Timeout
+	if timeout == "" {
+		timeout = defaultWaitTimeout
+	}
+	duration, err := config.ParseDuration(timeout)
+	if err != nil {
+		return fmt.Errorf("invalid --timeout: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	fmt.Fprintf(messages, "Waiting for cloud-init on %s (timeout %s)\n", configuration.VM.Name, timeout)
+	err = provider.WaitForCloudInit(ctx, checker, configuration, waitPollInterval, func(status string) {
+		fmt.Fprintf(messages, "cloud-init: %s\n", status)
+	})
+	var cloudInitErr *provider.CloudInitError
+	if errors.As(err, &cloudInitErr) {
+		fmt.Fprintf(os.Stderr, "--- %s ---\n%s\n", provider.CloudInitOutputLog, strings.TrimRight(cloudInitErr.Log, "\n"))
+	}
+	return err
+}
+
+func loadExecutor(command *Command) (provider.Executor, *config.Config, error) {
+	stateStore, err := store.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	providerName := resolveProvider(stateStore, command)
+
+	configuration, _, err := loadManagedConfig(stateStore, command, providerName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vmProvider, err := getProvider(providerName, configuration.VM.Region, command.Verbose)
+	if err != nil {
+		return nil, nil, err
+	}
+	executor, ok := vmProvider.(provider.Executor)
+	if !ok {
+		return nil, nil, fmt.Errorf("provider %s does not support remote commands", vmProvider.Name())
+	}
+	return executor, configuration, nil
+}
+
+func cmdExec(ctx context.Context, command *Command) error {
+	executor, configuration, err := loadExecutor(command)
+	if err != nil {
+		return err
+	}
+
+	result, err := executor.Exec(ctx, configuration, command.RemoteArgs)
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(result.Stdout)
+	os.Stderr.Write(result.Stderr)
+	if result.ExitCode != 0 {
+		return &remoteExitError{code: result.ExitCode}
+	}
+	return nil
+}
+
+func cmdCopy(ctx context.Context, command *Command) error {
+	executor, configuration, err := loadExecutor(command)
+	if err != nil {
+		return err
+	}
+
+	if _, remotePath, isRemote := splitRemotePath(command.CopySource); isRemote {
+		verboseLog("copying %s:%s to %s", command.VMName, remotePath, command.CopyDest)
+		return executor.CopyFrom(ctx, configuration, remotePath, command.CopyDest)
+	}
+	_, remotePath, _ := splitRemotePath(command.CopyDest)
+	verboseLog("copying %s to %s:%s", command.CopySource, command.VMName, remotePath)
+	return executor.CopyTo(ctx, configuration, command.CopySource, remotePath)
+}
+
+func cmdStatus(ctx context.Context, command *Command) error {
+	stateStore, err := store.Open()
+	if err != nil {
+		return err
+	}
+	providerName := resolveProvider(stateStore, command)
+
+	configuration, source, err := loadManagedConfig(stateStore, command, providerName)
+	if err != nil {
+		return err
+	}
+
+	vmProvider, err := getProvider(providerName, configuration.VM.Region, command.Verbose)
+	if err != nil {
+		return err
+	}
+
+	status, err := vmProvider.Status(ctx, configuration)
+	if err != nil {
+		return err
+	}
+
+	var state *store.State
+	if source == stateSourceStore {
+		state, _ = stateStore.LoadState(command.VMName)
+	}
+	enrichStatus(status, configuration, state)
+	if configuration.VM.IdleStop != nil {
+		status.Idle = idleStatus(ctx, vmProvider, configuration, status.State)
+		if rememberIdleStop(status.Idle, state) {
+			if err := stateStore.SaveState(command.VMName, state); err != nil {
+				verboseLog("could not record last idle stop for %s: %v", command.VMName, err)
+			}
+		}
+	}
+
+	if structuredOutput(command) {
+		return writeOutput(command.Output, status)
+	}
+
+	fmt.Printf("Name:     %s\n", status.Name)
+	fmt.Printf("State:    %s\n", status.State)
+	fmt.Printf("Provider: %s\n", status.Provider)
+	if status.IP != "" {
+		fmt.Printf("IP:       %s\n", status.IP)
+	}
+	if status.Spot != nil {
+		fmt.Printf("Spot:     %s (%s)\n", status.Spot.RequestState, status.Spot.StatusCode)
+		if status.Spot.InterruptionNotice {
+			fmt.Printf("Warning: spot interruption: %s\n", status.Spot.Message)
+		}
+	}
+	if status.Idle != nil {
+		fmt.Printf("Idle:     stop after %dm without SSH sessions and below %d%% CPU\n", status.Idle.Minutes, status.Idle.CPUPercent)
+		if status.Idle.IdleSince != nil {
+			fmt.Printf("          idle since %s\n", status.Idle.IdleSince.Local().Format("2006-01-02 15:04 MST"))
+		}
+		if status.Idle.LastIdleStop != nil {
+			fmt.Printf("          last idle stop %s\n", status.Idle.LastIdleStop.Local().Format("2006-01-02 15:04 MST"))
+		}
+	}
+
+	return nil
+}
+
+func idleStatus(ctx context.Context, vmProvider provider.VMProvider, configuration *config.Config, state string) *provider.IdleStatus {
+	idle := &provider.IdleStatus{
+		Minutes:    configuration.VM.IdleStop.Minutes,
+		CPUPercent: configuration.VM.IdleStop.CPUPercent,
+	}
+	executor, ok := vmProvider.(provider.Executor)
+	if !ok || !strings.EqualFold(state, "running") {
+		return idle
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, idleStatusTimeout)
+	defer cancel()
+	result, err := executor.Exec(ctx, configuration, []string{"grep", "-s", "-H", ".", cloudinit.IdleSincePath, cloudinit.IdleStoppedPath})
+	if err != nil {
+		verboseLog("could not read idle state from %s: %v", configuration.VM.Name, err)
+		return idle
+	}
+	idle.IdleSince, idle.LastIdleStop = parseIdleTimes(string(result.Stdout))
+	return idle
+}
+
+func rememberIdleStop(idle *provider.IdleStatus, state *store.State) bool {
+	if state == nil {
+		return false
+	}
+	if idle.LastIdleStop == nil {
+		idle.LastIdleStop = state.LastIdleStop
+		return false
+	}
+	if state.LastIdleStop != nil && state.LastIdleStop.Equal(*idle.LastIdleStop) {
+		return false
+	}
+	state.LastIdleStop = idle.LastIdleStop
+	return true
+}
+
+func parseIdleTimes(output string) (idleSince, lastIdleStop *time.Time) {
+	for _, line := range strings.Split(output, "\n") {
+		path, value, found := strings.Cut(strings.TrimSpace(line), ":")
+		if !found {
+			continue
+		}
+		seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		timestamp := time.Unix(seconds, 0).UTC()
+		switch path {
+		case cloudinit.IdleSincePath:
+			idleSince = &timestamp
+		case cloudinit.IdleStoppedPath:
+			lastIdleStop = &timestamp
+		}
+	}
+	return idleSince, lastIdleStop
+}
+
+func cmdStop(ctx context.Context, command *Command) error {
+	stateStore, err := store.Open()
+	if err != nil {
+		return err
+	}
+	providerName := resolveProvider(stateStore, command)
+
+	configuration, _, err := loadManagedConfig(stateStore, command, providerName)
+	if err != nil {
+		return err
+	}
+
+	vmProvider, err := getProvider(providerName, configuration.VM.Region, command.Verbose)
+	if err != nil {
+		return err
+	}
+
+	if err := vmProvider.Stop(ctx, configuration); err != nil {
+		return err
+	}
+
+	fmt.Printf("Stopped %s\n", configuration.VM.Name)
+	return nil
+}
+
+func cmdStart(ctx context.Context, command *Command) error {
+	stateStore, err := store.Open()
+	if err != nil {
+		return err
+	}
+	providerName := resolveProvider(stateStore, command)
+
+	configuration, source, err := loadManagedConfig(stateStore, command, providerName)
+	if err != nil {
+		return err
+	}
+
+	vmProvider, err := getProvider(providerName, configuration.VM.Region, command.Verbose)
+	if err != nil {
+		return err
+	}
+
+	if err := vmProvider.Start(ctx, configuration); err != nil {
+		return err
+	}
+
+	fmt.Printf("Started %s\n", configuration.VM.Name)
+
+	status, err := vmProvider.Status(ctx, configuration)
+	if err == nil && status.IP != "" {
+		currentIP := ""
+		if configuration.AWS != nil {
+			currentIP = configuration.AWS.PublicIP
+		} else if configuration.Local != nil {
+			currentIP = configuration.Local.IP
+		}
+		if status.IP != currentIP {
+			if configuration.AWS != nil {
+				configuration.AWS.PublicIP = status.IP
+			} else if configuration.Local != nil {
+				configuration.Local.IP = status.IP
+			}
+			if saveErr := saveManagedState(stateStore, command, providerName, source, configuration); saveErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: started but failed to save updated IP: %v\n", saveErr)
+			}
+			fmt.Printf("IP: %s\n", status.IP)
+
+			if state := hostsState(providerName, configuration); !command.NoHosts && state != nil && state.HostsEntry {
+				hostnames := hosts.BuildHostnames(configuration.VM.Name, dnsHostname(configuration), dnsDomain(configuration))
+				if hostsBackend, err := recordedHostsBackend(providerName, configuration); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				} else if err := hostsBackend.Add(configuration.VM.Name, status.IP, hostnames, command.Verbose); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to update %s with new IP: %v\n", hostsBackend.Path, err)
+				}
+			}
+			refreshSSHConfigEntry(command, providerName, configuration)
+		}
+	}
+
+	return nil
+}
+
+type staleHostsEntry struct {
+	hosts.Entry
+	Path string
+}
+
+func cmdHostsCheck(ctx context.Context, command *Command) error {
+	vmProvider, err := getProvider("multipass", "", command.Verbose)
+	if err != nil {
+		return err
+	}
+	vms, err := vmProvider.List(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot check hosts entries: %w", err)
+	}
+	existing := make(map[string]bool)
+	for _, vm := range vms {
+		existing[vm.Name] = true
+	}
+	if stateStore, err := store.Open(); err == nil {
+		for _, vm := range loadKnownVMs(stateStore) {
+			if vm.Provider == "aws" {
+				existing[vm.Name] = true
+			}
+		}
+	}
+
+	var stale []staleHostsEntry
+	for _, hostsBackend := range hostsBackendsToCheck() {
+		entries, err := hostsBackend.Entries()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			continue
+		}
+		verboseLog("found %d goloo entries in %s", len(entries), hostsBackend.Path)
+		for _, entry := range findStaleHostsEntries(entries, existing) {
+			stale = append(stale, staleHostsEntry{Entry: entry, Path: hostsBackend.Path})
+		}
+	}
+
+	if len(stale) == 0 {
+		fmt.Println("No stale hosts entries")
+		return nil
+	}
+
+	fmt.Printf("%-20s %-16s %-40s %s\n", "NAME", "IP", "HOSTNAMES", "FILE")
+	for _, entry := range stale {
+		fmt.Printf("%-20s %-16s %-40s %s\n", entry.Name, entry.IP, strings.Join(entry.Hostnames, " "), entry.Path)
+	}
+	return fmt.Errorf("found %d stale hosts entries for VMs missing from multipass list and goloo's AWS state", len(stale))
+}
+
+func hostsBackendsToCheck() []*hosts.Backend {
+	etcHosts, _ := hosts.NewBackend(hosts.BackendEtcHosts, "")
+	backends := []*hosts.Backend{etcHosts}
+	selected, err := selectHostsBackend(&config.Config{})
+	if err != nil {
+		verboseLog("skipping configured hosts backend: %v", err)
+		return backends
+	}
+	if selected.Path != etcHosts.Path {
+		backends = append(backends, selected)
+	}
+	return backends
+}
+
+func findStaleHostsEntries(entries []hosts.Entry, existing map[string]bool) []hosts.Entry {
+	var stale []hosts.Entry
+	for _, entry := range entries {
+		if !existing[entry.Name] {
+			stale = append(stale, entry)
+		}
+	}
+	return stale
+}
+
+func cmdDNSSwap(ctx context.Context, command *Command) error {
+	stateStore, err := store.Open()
+	if err != nil {
+		return err
+	}
+
+	configuration, source, err := loadManagedConfig(stateStore, command, "aws")
+	if err != nil {
+		return err
+	}
+
+	awsProvider, err := awsprovider.NewWithSDK(configuration.VM.Region)
+	if err != nil {
+		return err
+	}
+	if err := awsProvider.SwapDNS(ctx, configuration); err != nil {
+		return err
+	}
+
+	if source == stateSourceConfig {
+		source = stateSourceLegacy
+	}
+	if err := saveManagedState(stateStore, command, "aws", source, configuration); err != nil {
+		return fmt.Errorf("DNS swapped but failed to save state: %w", err)
+	}
+
+	fmt.Printf("DNS swapped: %s -> %s\n", configuration.AWS.FQDN, configuration.AWS.PublicIP)
+	return nil
+}
+
+func cmdFirewall(ctx context.Context, command *Command) error {
+	stateStore, err := store.Open()
+	if err != nil {
+		return err
+	}
+
+	configuration, _, err := loadManagedConfig(stateStore, command, "aws")
+	if err != nil {
+		return err
+	}
+
+	awsProvider, err := awsprovider.NewWithSDK(configuration.VM.Region)
+	if err != nil {
+		return err
+	}
+
+	rules := []config.FirewallRule{command.FirewallRule}
+	if command.Action == "firewall-allow" {
+		applied, err := awsProvider.AllowIngress(ctx, configuration, rules)
+		if err != nil {
+			return err
+		}
+		for _, rule := range applied {
+			fmt.Printf("Allowed %s on %s\n", rule, configuration.AWS.SecurityGroup)
+		}
+		return nil
+	}
+
+	revoked, err := awsProvider.RevokeIngress(ctx, configuration, rules)
+	if err != nil {
+		return err
+	}
+	for _, rule := range revoked {
+		fmt.Printf("Revoked %s on %s\n", rule, configuration.AWS.SecurityGroup)
+	}
+	return nil
+}
+
+func cmdMigrate(command *Command) error {
+	stateStore, err := store.Open()
+	if err != nil {
+		return err
+	}
+
+	stackFolder := resolveStackFolder(command)
+	results, err := stateStore.Migrate(stackFolder, command.DryRun)
+	if err != nil {
+		return err
+	}
+
+	if len(results) == 0 {
+		fmt.Printf("No legacy state found in %s\n", stackFolder)
+		return nil
+	}
+
+	conflicts := 0
+	for _, result := range results {
+		line := fmt.Sprintf("%-18s %-20s %-10s %s", result.Status, result.Name, result.Provider, result.StatePath)
+		if result.Reason != "" {
+			line += ": " + result.Reason
+		}
+		fmt.Println(line)
+		if result.Status == store.MigrationConflict || result.Status == store.MigrationInvalid {
+			conflicts++
+		}
+	}
+
+	if command.DryRun {
+		fmt.Println("Dry run: no state was written")
+	}
+	if conflicts > 0 {
+		return fmt.Errorf("%d legacy state entries could not be migrated", conflicts)
+	}
+	return nil
+}
+
+func cmdArchiveList(command *Command) error {
+	stateStore, err := store.Open()
+	if err != nil {
+		return err
+	}
+
+	entries, err := stateStore.ListArchive()
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No archived VMs found")
+		return nil
+	}
+
+	fmt.Printf("%-36s %-20s %-10s %-20s %-20s %-16s %s\n", "ENTRY", "NAME", "PROVIDER", "CREATED", "DESTROYED", "LAST IP", "INSTANCE")
+	for _, entry := range entries {
+		state := entry.State
+		destroyed := "-"
+		if state.DestroyedAt != nil {
+			destroyed = state.DestroyedAt.Local().Format("2006-01-02 15:04")
+		}
+		ip, instanceID := "-", "-"
+		if state.AWS != nil {
+			if state.AWS.PublicIP != "" {
+				ip = state.AWS.PublicIP
+			}
+			if state.AWS.InstanceID != "" {
+				instanceID = state.AWS.InstanceID
+			}
+		} else if state.Local != nil && state.Local.IP != "" {
+			ip = state.Local.IP
+		}
+		fmt.Printf("%-36s %-20s %-10s %-20s %-20s %-16s %s\n", entry.Entry, state.Name, state.Provider,
+			state.CreatedAt.Local().Format("2006-01-02 15:04"), destroyed, ip, instanceID)
+	}
+
+	return nil
+}
+
+func cmdArchiveClean(command *Command) error {
+	olderThan := command.OlderThan
+	if olderThan == "" {
+		olderThan = "90d"
+	}
+	age, err := config.ParseDuration(olderThan)
+	if err != nil {
+		return err
+	}
+
+	stateStore, err := store.Open()
+	if err != nil {
+		return err
+	}
+
+	removed, err := stateStore.CleanArchive(age, time.Now())
+	for _, entry := range removed {
+		verboseLog("removed archive entry %s", entry)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed %d archive entries older than %s\n", len(removed), olderThan)
+	return nil
+}
+
+func cmdArchiveDelete(command *Command) error {
+	stateStore, err := store.Open()
+	if err != nil {
+		return err
+	}
+
+	if err := stateStore.DeleteArchive(command.VMName); err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted archive entry %s\n", command.VMName)
+	return nil
+}
+
+func cmdArchiveRestore(command *Command) error {
+	stateStore, err := store.Open()
+	if err != nil {
+		return err
+	}
+
+	state, err := stateStore.LoadArchivedState(command.VMName)
+	if err != nil {
+		return err
+	}
+
+	destination := config.ResolveFolder(resolveStackFolder(command), state.Name)
+	if err := stateStore.RestoreArchive(command.VMName, destination); err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %s to %s\n", command.VMName, destination)
+	fmt.Printf("Recreate: goloo create %s", state.Name)
+	if command.FolderPath != "" {
+		fmt.Printf(" -f %s", command.FolderPath)
+	}
+	if state.Provider == "aws" {
+		fmt.Print(" --aws")
+	}
+	fmt.Println()
+	return nil
+}
+
+func selectHostsBackend(configuration *config.Config) (*hosts.Backend, error) {
+	name, file := "", ""
+	if configuration.Hosts != nil {
+		name = configuration.Hosts.Backend
+		file = configuration.Hosts.File
+	}
+	if envBackend := os.Getenv("GOLOO_HOSTS_BACKEND"); envBackend != "" {
+		name = envBackend
+	}
+	if name != hosts.BackendDnsmasq {
+		return hosts.NewBackend(name, "")
+	}
+
+	if file == "" {
+		baseDir, err := store.DefaultBaseDir()
+		if err != nil {
+			return nil, err
+		}
+		file = filepath.Join(baseDir, "hosts.d", hosts.FragmentFileName)
+	}
+	file, err := config.ExpandHome(file)
+	if err != nil {
+		return nil, err
+	}
+	return hosts.NewBackend(name, file)
+}
+
+func hostsState(providerName string, configuration *config.Config) *config.HostsState {
+	if providerName == "aws" {
+		if configuration.AWS == nil {
+			return nil
+		}
+		return &configuration.AWS.HostsState
+	}
+	if configuration.Local == nil {
+		return nil
+	}
+	return &configuration.Local.HostsState
+}
+
+func hostsAddress(providerName string, configuration *config.Config) string {
+	if providerName == "aws" {
+		if configuration.AWS == nil || configuration.AWS.ZoneID != "" {
+			return ""
+		}
+		return configuration.AWS.PublicIP
+	}
+	if configuration.Local == nil {
+		return ""
+	}
+	return configuration.Local.IP
+}
+
+func recordedHostsBackend(providerName string, configuration *config.Config) (*hosts.Backend, error) {
+	state := hostsState(providerName, configuration)
+	if state != nil && state.HostsBackend != "" {
+		return hosts.NewBackend(state.HostsBackend, state.HostsFile)
+	}
+	if state != nil && state.HostsEntry {
+		return hosts.NewBackend(hosts.BackendEtcHosts, "")
+	}
+	return selectHostsBackend(configuration)
+}
+
+func addHostsEntry(hostsBackend *hosts.Backend, vmName, ip string, hostnames []string, command *Command, messages io.Writer) error {
+	if hostsBackend.Privileged {
+		fmt.Fprintf(messages, "Adding hostname to %s (may require sudo)\n", hostsBackend.Path)
+	} else {
+		fmt.Fprintf(messages, "Adding hostname to %s\n", hostsBackend.Path)
+	}
+	if err := hostsBackend.Add(vmName, ip, hostnames, command.Verbose); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update %s: %v\n", hostsBackend.Path, err)
+		fmt.Fprintln(os.Stderr, hostsBackend.ManualInstructions(ip, hostnames, vmName))
+		return err
+	}
+	return nil
+}
+
+func buildSSHConfigEntry(providerName string, configuration *config.Config) sshconfig.Entry {
+	entry := sshconfig.Entry{Name: configuration.VM.Name}
+	defaultUser := multipass.DefaultSSHUser
+	if providerName == "aws" {
+		defaultUser = awsprovider.SSHUsername(configuration.VM.OS)
+		if configuration.AWS != nil {
+			entry.HostName = configuration.AWS.PublicIP
+		}
+	} else if configuration.Local != nil {
+		entry.HostName = configuration.Local.IP
+	}
+	entry.User = provider.SSHUser(configuration, defaultUser)
+	if configuration.SSH != nil {
+		entry.IdentityFile = configuration.SSH.IdentityFile
+		entry.Port = configuration.SSH.Port
+		entry.ProxyJump = configuration.SSH.ProxyJump
+	}
+	return entry
+}
+
+func addSSHConfigEntry(command *Command, providerName string, configuration *config.Config) bool {
+	if command.NoSSHConfig {
+		return false
+	}
+	sshDir, err := sshconfig.DefaultDir()
+	if err == nil {
+		err = sshconfig.Add(sshDir, buildSSHConfigEntry(providerName, configuration))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update ~/.ssh/goloo.conf: %v\n", err)
+		return false
+	}
+	verboseLog("added ssh config entry for %s to %s", configuration.VM.Name, sshconfig.GolooPath(sshDir))
+	return true
+}
+
+func refreshSSHConfigEntry(command *Command, providerName string, configuration *config.Config) {
+	sshDir, err := sshconfig.DefaultDir()
+	if err != nil || command.NoSSHConfig || !sshconfig.HasEntry(sshDir, configuration.VM.Name) {
+		return
+	}
+	if err := sshconfig.Add(sshDir, buildSSHConfigEntry(providerName, configuration)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to update ~/.ssh/goloo.conf with new IP: %v\n", err)
+	}
+}
+
+func removeSSHConfigEntry(command *Command, name string) {
+	sshDir, err := sshconfig.DefaultDir()
+	if err != nil || command.NoSSHConfig || !sshconfig.HasEntry(sshDir, name) {
+		return
+	}
+	if err := sshconfig.Remove(sshDir, name); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to remove ~/.ssh/goloo.conf entry: %v\n", err)
+	}
+}
+
+func keySources(ctx context.Context, command *Command) cloudinit.KeySources {
+	sources := cloudinit.NetworkKeySources(ctx)
+	cacheDir, err := cloudinit.DefaultKeyCacheDir()
+	if err != nil {
+		verboseLog("SSH key cache disabled: %v", err)
+		return sources
+	}
+	verboseLog("SSH key cache: %s (refresh: %v)", cacheDir, command.RefreshKeys)
+	cache := cloudinit.NewKeyCache(cacheDir, cloudinit.DefaultKeyCacheTTL, command.RefreshKeys, func(message string) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", message)
+	})
+	return cache.Wrap(sources)
+}
+
+func structuredOutput(command *Command) bool {
+	return command.Output == "json" || command.Output == "yaml"
+}
+
+func writeOutput(format string, value interface{}) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case "yaml":
+		data, err := yaml.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal YAML output: %w", err)
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	default:
+		return fmt.Errorf("unknown output format %q: use table, json or yaml", format)
+	}
+}
+
+func enrichStatus(status *provider.VMStatus, configuration *config.Config, state *store.State) {
+	if status.IP == "" {
+		if configuration.AWS != nil {
+			status.IP = configuration.AWS.PublicIP
+		} else if configuration.Local != nil {
+			status.IP = configuration.Local.IP
+		}
+	}
+	if configuration.AWS != nil {
+		if status.InstanceID == "" {
+			status.InstanceID = configuration.AWS.InstanceID
+		}
+		if status.FQDN == "" {
+			status.FQDN = configuration.AWS.FQDN
+		}
+		if status.Image == "" {
+			status.Image = configuration.AWS.AMIID
+		}
+	}
+	if status.Image == "" && configuration.VM != nil {
+		status.Image = configuration.VM.Image
+	}
+	if status.CreatedAt == nil && state != nil && !state.CreatedAt.IsZero() {
+		createdAt := state.CreatedAt
+		status.CreatedAt = &createdAt
+	}
 }
 
 func dnsHostname(configuration *config.Config) string {
@@ -719,12 +2448,29 @@ func printUsage() {
 	fmt.Println("Commands:")
 	fmt.Println("  create <name>       Create a VM")
 	fmt.Println("  destroy <name>      Destroy a VM")
-	fmt.Println("  list                List all VMs")
-	fmt.Println("  ssh <name>          SSH into a VM")
+	fmt.Println("  list                List local VMs (--aws for AWS, --all for every provider and region)")
+	fmt.Println("  ssh <name> [-- CMD] SSH into a VM, optionally running CMD")
+	fmt.Println("  exec <name> -- CMD  Run a command on a VM and exit with its status")
+	fmt.Println("  cp SRC DEST         Copy files to or from a VM (<name>:<path> on one side)")
 	fmt.Println("  status <name>       Show VM status")
 	fmt.Println("  stop <name>         Stop a VM")
 	fmt.Println("  start <name>        Start a VM")
+	fmt.Println("  wait <name>         Wait until cloud-init finishes, failing if it reports errors")
 	fmt.Println("  dns swap <name>     Swap DNS to current VM IP")
+	fmt.Println("  hosts check         Report goloo hosts entries for VMs that no longer exist")
+	fmt.Println("  firewall allow <n>  Open a port on an AWS VM (--port, --protocol, --cidr)")
+	fmt.Println("  firewall revoke <n> Close a port on an AWS VM's security group")
+	fmt.Println("  snapshot create <n> Take a restore point, optionally named (<n> SNAPSHOT)")
+	fmt.Println("  snapshot list <n>   List a VM's snapshots")
+	fmt.Println("  snapshot restore    Roll a VM back: snapshot restore <name> SNAPSHOT")
+	fmt.Println("  snapshot delete     Delete one: snapshot delete <name> SNAPSHOT")
+	fmt.Println("  reap                Stop or destroy every VM past its vm.ttl deadline (--dry-run)")
+	fmt.Println("  extend <name> DUR   Push a VM's expiry out by DUR (e.g. 4h, 2d)")
+	fmt.Println("  migrate             Import legacy <name>/local|aws state into the state directory")
+	fmt.Println("  archive list        List destroyed VMs kept in the archive")
+	fmt.Println("  archive clean       Delete archive entries older than 90d (--older-than)")
+	fmt.Println("  archive delete <e>  Delete an archive entry")
+	fmt.Println("  archive restore <e> Restore an entry's config and cloud-init to the stacks folder")
 	fmt.Println()
 	fmt.Println("Flags:")
 	fmt.Println("  --aws               Use AWS provider")
@@ -732,20 +2478,29 @@ func printUsage() {
 	fmt.Println("  --folder, -f PATH   Base folder for configs (default: stacks/)")
 	fmt.Println("  --users, -u USERS   GitHub usernames for SSH keys (comma-separated)")
 	fmt.Println("  --no-hosts          Skip /etc/hosts management for local VMs")
+	fmt.Println("  --no-ssh-config     Skip the ~/.ssh/goloo.conf Host entry")
+	fmt.Println("  --refresh-keys      Fetch SSH keys again instead of using the key cache")
+	fmt.Println("  --wait              create: wait until cloud-init finishes")
+	fmt.Println("  --timeout DURATION  Limit for --wait and wait (default: 20m)")
+	fmt.Println("  --dry-run           Report what migrate or reap would do without doing it")
+	fmt.Println("  --output, -o FMT    Output format for list, status and create: table, json, yaml")
 	fmt.Println("  --verbose, -v       Show detailed progress")
 	fmt.Println("  --version           Show version")
 	fmt.Println("  --help, -h          Show this help")
 	fmt.Println()
 	fmt.Println("Environment Variables:")
 	fmt.Println("  GOLOO_STACK_FOLDER  Default base folder (overridden by --folder/-f)")
+	fmt.Println("  GOLOO_STATE_DIR     State directory (default: ~/.local/share/goloo)")
+	fmt.Println("  GOLOO_HOSTS_BACKEND Hosts backend: etc-hosts (default) or dnsmasq")
 	fmt.Println()
 	fmt.Println("Legacy Flags (aws-ec2 compatibility):")
 	fmt.Println("  -c -n <name>        Create AWS VM")
 	fmt.Println("  -d -n <name>        Destroy AWS VM")
 	fmt.Println()
 	fmt.Println("Provider Auto-Detection:")
-	fmt.Println("  create/destroy: defaults to local unless --aws is given")
-	fmt.Println("  Other commands: checks which provider state exists, defaults to local")
+	fmt.Println("  create: defaults to local unless --aws is given")
+	fmt.Println("  Other commands: uses the provider recorded in the state directory,")
+	fmt.Println("                  then checks legacy stack state, defaults to local")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  goloo create devbox                         Create local VM (stacks/devbox/)")
@@ -753,10 +2508,22 @@ func printUsage() {
 	fmt.Println("  goloo create devbox -f ~/my-servers         Use ~/my-servers/devbox/")
 	fmt.Println("  goloo create devbox -u gherlein             Fetch SSH keys for gherlein")
 	fmt.Println("  goloo create devbox -u \"alice,bob\"           Fetch SSH keys for multiple users")
+	fmt.Println("  goloo create devbox --wait                  Create and block until cloud-init is done")
 	fmt.Println("  goloo list                                  List local VMs and IPs")
 	fmt.Println("  goloo list --aws                            List AWS VMs")
+	fmt.Println("  goloo list --all                            List local and AWS VMs from every known region")
+	fmt.Println("  goloo status devbox -o json                 Print status as JSON")
 	fmt.Println("  goloo destroy devbox                        Destroy local VM")
 	fmt.Println("  goloo destroy devbox --aws                  Destroy AWS VM")
 	fmt.Println("  goloo ssh devbox                            SSH into VM")
+	fmt.Println("  goloo ssh devbox -- tail -f /var/log/syslog Run a command over SSH")
+	fmt.Println("  goloo exec devbox -- uname -a               Run a command on the VM")
+	fmt.Println("  goloo cp ./app.tar devbox:/tmp/app.tar      Copy a file to the VM")
 	fmt.Println("  goloo dns swap devbox                       Update DNS to current IP")
+	fmt.Println("  goloo snapshot create devbox pre-upgrade    Take a restore point before an upgrade")
+	fmt.Println("  goloo reap --dry-run                        Show which expired VMs reap would stop or destroy")
+	fmt.Println("  goloo extend devbox 4h                      Keep devbox alive 4 more hours")
+	fmt.Println("  goloo migrate -f ~/my-servers --dry-run     Preview importing legacy state")
+	fmt.Println("  goloo archive clean --older-than 30d        Prune archive entries older than 30 days")
+	fmt.Println("  goloo archive restore devbox-20250115T103000  Restore a destroyed VM's config")
 }
@@ -1,9 +1,20 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/emergingrobotics/goloo/internal/cloudinit"
 	"github.com/emergingrobotics/goloo/internal/config"
+	"github.com/emergingrobotics/goloo/internal/hosts"
+	"github.com/emergingrobotics/goloo/internal/provider"
+	awsprovider "github.com/emergingrobotics/goloo/internal/provider/aws"
+	"github.com/emergingrobotics/goloo/internal/store"
+	"gopkg.in/yaml.v3"
 )
 
 func TestParseArgsNoArgs(t *testing.T) {
@@ -568,6 +579,206 @@ func TestParseArgsNoHostsDefaultFalse(t *testing.T) {
 	}
 }
 
+func TestParseArgsNoSSHConfigFlag(t *testing.T) {
+	command, err := ParseArgs([]string{"create", "devbox", "--no-ssh-config"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !command.NoSSHConfig {
+		t.Error("expected NoSSHConfig=true for --no-ssh-config flag")
+	}
+	if command.NoHosts {
+		t.Error("expected NoHosts=false")
+	}
+}
+
+func TestParseArgsHostsCheck(t *testing.T) {
+	command, err := ParseArgs([]string{"hosts", "check"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.Action != "hosts-check" {
+		t.Errorf("expected action hosts-check, got %q", command.Action)
+	}
+}
+
+func TestParseArgsHostsErrors(t *testing.T) {
+	for _, args := range [][]string{{"hosts"}, {"hosts", "clean"}, {"hosts", "check", "devbox"}} {
+		if _, err := ParseArgs(args); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
+
+func TestFindStaleHostsEntries(t *testing.T) {
+	entries := []hosts.Entry{{Name: "devbox", IP: "192.168.64.5"}, {Name: "gone", IP: "192.168.64.6"}}
+	stale := findStaleHostsEntries(entries, map[string]bool{"devbox": true})
+	if len(stale) != 1 || stale[0].Name != "gone" {
+		t.Errorf("expected only 'gone' to be stale, got %+v", stale)
+	}
+}
+
+func TestParseArgsFirewallAllow(t *testing.T) {
+	command, err := ParseArgs([]string{"firewall", "allow", "web", "--port", "443", "--cidr", "0.0.0.0/0", "--description", "HTTPS"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.Action != "firewall-allow" || command.VMName != "web" {
+		t.Errorf("unexpected action/name: %q %q", command.Action, command.VMName)
+	}
+	expected := config.FirewallRule{Port: 443, CIDR: "0.0.0.0/0", Description: "HTTPS"}
+	if command.FirewallRule != expected {
+		t.Errorf("FirewallRule = %+v, want %+v", command.FirewallRule, expected)
+	}
+}
+
+func TestParseArgsFirewallRevokeDefaultsToMyIP(t *testing.T) {
+	command, err := ParseArgs([]string{"firewall", "revoke", "web", "--port", "8000-8100", "--protocol", "udp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := config.FirewallRule{Protocol: "udp", Port: 8000, ToPort: 8100, CIDR: "my-ip"}
+	if command.Action != "firewall-revoke" || command.FirewallRule != expected {
+		t.Errorf("unexpected command: %q %+v", command.Action, command.FirewallRule)
+	}
+}
+
+func TestParseArgsFirewallErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"firewall"},
+		{"firewall", "open", "web", "--port", "22"},
+		{"firewall", "allow", "--port", "22"},
+		{"firewall", "allow", "web"},
+		{"firewall", "allow", "web", "--port", "https"},
+		{"firewall", "allow", "web", "--port", "22", "--cidr", "everywhere"},
+		{"firewall", "allow", "web", "other", "--port", "22"},
+		{"firewall", "allow", "web", "--port"},
+	} {
+		if _, err := ParseArgs(args); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
+
+func TestSelectHostsBackendDefault(t *testing.T) {
+	t.Setenv("GOLOO_HOSTS_BACKEND", "")
+	backend, err := selectHostsBackend(&config.Config{VM: &config.VMConfig{Name: "devbox"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend.Name != hosts.BackendEtcHosts {
+		t.Errorf("expected etc-hosts backend, got %q", backend.Name)
+	}
+}
+
+func TestSelectHostsBackendFromConfig(t *testing.T) {
+	t.Setenv("GOLOO_HOSTS_BACKEND", "")
+	t.Setenv("GOLOO_STATE_DIR", "/var/lib/goloo")
+	configuration := &config.Config{
+		VM:    &config.VMConfig{Name: "devbox"},
+		Hosts: &config.HostsConfig{Backend: "dnsmasq"},
+	}
+	backend, err := selectHostsBackend(configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend.Name != hosts.BackendDnsmasq || backend.Path != "/var/lib/goloo/hosts.d/goloo.hosts" {
+		t.Errorf("unexpected backend: %+v", backend)
+	}
+}
+
+func TestSelectHostsBackendEnvOverridesConfig(t *testing.T) {
+	t.Setenv("GOLOO_HOSTS_BACKEND", "dnsmasq")
+	configuration := &config.Config{
+		VM:    &config.VMConfig{Name: "devbox"},
+		Hosts: &config.HostsConfig{Backend: "etc-hosts", File: "/etc/dnsmasq.hosts/goloo"},
+	}
+	backend, err := selectHostsBackend(configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend.Name != hosts.BackendDnsmasq || backend.Path != "/etc/dnsmasq.hosts/goloo" {
+		t.Errorf("unexpected backend: %+v", backend)
+	}
+}
+
+func TestRecordedHostsBackend(t *testing.T) {
+	t.Setenv("GOLOO_HOSTS_BACKEND", "dnsmasq")
+	legacy := &config.Config{VM: &config.VMConfig{Name: "devbox"}, Local: &config.LocalState{HostsState: config.HostsState{HostsEntry: true}}}
+	backend, err := recordedHostsBackend("multipass", legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend.Name != hosts.BackendEtcHosts {
+		t.Errorf("expected legacy entries to use etc-hosts, got %q", backend.Name)
+	}
+
+	recorded := &config.Config{
+		VM:  &config.VMConfig{Name: "devbox"},
+		AWS: &config.AWSState{HostsState: config.HostsState{HostsEntry: true, HostsBackend: "dnsmasq", HostsFile: "/tmp/goloo.hosts"}},
+	}
+	backend, err = recordedHostsBackend("aws", recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend.Name != hosts.BackendDnsmasq || backend.Path != "/tmp/goloo.hosts" {
+		t.Errorf("unexpected recorded backend: %+v", backend)
+	}
+}
+
+func TestHostsAddress(t *testing.T) {
+	local := &config.Config{Local: &config.LocalState{IP: "192.168.64.5"}}
+	if got := hostsAddress("multipass", local); got != "192.168.64.5" {
+		t.Errorf("expected local IP, got %q", got)
+	}
+
+	aws := &config.Config{AWS: &config.AWSState{PublicIP: "54.1.2.3"}}
+	if got := hostsAddress("aws", aws); got != "54.1.2.3" {
+		t.Errorf("expected public IP for AWS without Route53, got %q", got)
+	}
+
+	aws.AWS.ZoneID = "Z123"
+	if got := hostsAddress("aws", aws); got != "" {
+		t.Errorf("expected no hosts address for AWS with Route53, got %q", got)
+	}
+
+	if got := hostsAddress("aws", &config.Config{}); got != "" {
+		t.Errorf("expected no hosts address without AWS state, got %q", got)
+	}
+}
+
+func TestBuildSSHConfigEntryAWS(t *testing.T) {
+	configuration := &config.Config{
+		VM:  &config.VMConfig{Name: "devbox", OS: "ubuntu:24.04"},
+		AWS: &config.AWSState{PublicIP: "54.1.2.3"},
+		SSH: &config.SSHConfig{User: "admin", IdentityFile: "~/.ssh/work", Port: 2222, ProxyJump: "bastion"},
+	}
+	entry := buildSSHConfigEntry("aws", configuration)
+	if entry.Name != "devbox" || entry.HostName != "54.1.2.3" {
+		t.Errorf("unexpected name/host: %+v", entry)
+	}
+	if entry.User != "admin" || entry.IdentityFile != "~/.ssh/work" || entry.Port != 2222 || entry.ProxyJump != "bastion" {
+		t.Errorf("expected ssh section to be applied, got %+v", entry)
+	}
+}
+
+func TestBuildSSHConfigEntryMultipassDefaults(t *testing.T) {
+	configuration := &config.Config{
+		VM:    &config.VMConfig{Name: "devbox"},
+		Local: &config.LocalState{IP: "192.168.64.5"},
+	}
+	entry := buildSSHConfigEntry("multipass", configuration)
+	if entry.HostName != "192.168.64.5" {
+		t.Errorf("expected HostName 192.168.64.5, got %q", entry.HostName)
+	}
+	if entry.User != "ubuntu" {
+		t.Errorf("expected default user ubuntu, got %q", entry.User)
+	}
+	if entry.IdentityFile != "" || entry.Port != 0 || entry.ProxyJump != "" {
+		t.Errorf("expected no ssh options, got %+v", entry)
+	}
+}
+
 func TestDetectProviderAWSFlag(t *testing.T) {
 	result := DetectProvider("aws")
 	if result != "aws" {
@@ -741,3 +952,763 @@ func TestResolveStackFolderFlagWithoutEnv(t *testing.T) {
 		t.Errorf("expected '/opt/stacks', got %q", result)
 	}
 }
+
+func TestResolveProviderFromStore(t *testing.T) {
+	t.Setenv("GOLOO_STACK_FOLDER", t.TempDir())
+	stateStore := store.New(t.TempDir())
+	stateStore.SaveState("devbox", &store.State{Name: "devbox", Provider: "aws"})
+
+	result := resolveProvider(stateStore, &Command{VMName: "devbox"})
+	if result != "aws" {
+		t.Errorf("expected 'aws' from store, got %q", result)
+	}
+}
+
+func TestResolveProviderFlagOverridesStore(t *testing.T) {
+	stateStore := store.New(t.TempDir())
+	stateStore.SaveState("devbox", &store.State{Name: "devbox", Provider: "aws"})
+
+	result := resolveProvider(stateStore, &Command{VMName: "devbox", ProviderFlag: "local"})
+	if result != "multipass" {
+		t.Errorf("expected 'multipass' (flag override), got %q", result)
+	}
+}
+
+func TestResolveProviderFallsBackToLegacyState(t *testing.T) {
+	directory := t.TempDir()
+	cfg := &config.Config{
+		VM: &config.VMConfig{
+			Name:  "devbox",
+			Users: []config.User{{Username: "ubuntu", GitHubUsername: "test"}},
+		},
+		AWS: &config.AWSState{StackID: "arn:aws:cloudformation:..."},
+	}
+	config.SaveState(directory, "devbox", "aws", cfg)
+
+	stateStore := store.New(t.TempDir())
+	result := resolveProvider(stateStore, &Command{VMName: "devbox", FolderPath: directory})
+	if result != "aws" {
+		t.Errorf("expected 'aws' from legacy state, got %q", result)
+	}
+}
+
+func TestSaveManagedStateKeepsLegacyCopyInSync(t *testing.T) {
+	stateStore := store.New(t.TempDir())
+	directory := t.TempDir()
+	cfg := &config.Config{
+		VM: &config.VMConfig{
+			Name:  "devbox",
+			Users: []config.User{{Username: "ubuntu", GitHubUsername: "test"}},
+		},
+		Local: &config.LocalState{IP: "10.0.0.5"},
+	}
+	stateStore.SaveConfig("devbox", cfg)
+	stateStore.SaveState("devbox", store.NewState("devbox", "multipass", "", cfg))
+	config.SaveState(directory, "devbox", "local", cfg)
+
+	cfg.Local.IP = "10.0.0.9"
+	if err := saveManagedState(stateStore, &Command{VMName: "devbox", FolderPath: directory}, "multipass", stateSourceStore, cfg); err != nil {
+		t.Fatal(err)
+	}
+	state, err := stateStore.LoadState("devbox")
+	if err != nil || state.Local == nil || state.Local.IP != "10.0.0.9" {
+		t.Errorf("store state not updated: %+v, %v", state, err)
+	}
+	legacy, _, err := config.LoadState(directory, "devbox", "local")
+	if err != nil || legacy.Local == nil || legacy.Local.IP != "10.0.0.9" {
+		t.Errorf("legacy state not updated: %+v, %v", legacy, err)
+	}
+}
+
+func TestLoadManagedConfigPrefersStore(t *testing.T) {
+	stateStore := store.New(t.TempDir())
+	cfg := &config.Config{
+		VM: &config.VMConfig{
+			Name:  "devbox",
+			Users: []config.User{{Username: "ubuntu", GitHubUsername: "test"}},
+		},
+		Local: &config.LocalState{IP: "10.0.0.5"},
+	}
+	stateStore.SaveConfig("devbox", cfg)
+	stateStore.SaveState("devbox", store.NewState("devbox", "multipass", "", cfg))
+
+	loaded, source, err := loadManagedConfig(stateStore, &Command{VMName: "devbox", FolderPath: t.TempDir()}, "multipass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source != stateSourceStore {
+		t.Errorf("expected source %q, got %q", stateSourceStore, source)
+	}
+	if loaded.Local == nil || loaded.Local.IP != "10.0.0.5" {
+		t.Errorf("expected Local.IP 10.0.0.5, got %v", loaded.Local)
+	}
+}
+
+func TestParseArgsArchiveList(t *testing.T) {
+	command, err := ParseArgs([]string{"archive", "list"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.Action != "archive-list" {
+		t.Errorf("expected action 'archive-list', got %q", command.Action)
+	}
+}
+
+func TestParseArgsArchiveClean(t *testing.T) {
+	command, err := ParseArgs([]string{"archive", "clean", "--older-than", "30d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.Action != "archive-clean" {
+		t.Errorf("expected action 'archive-clean', got %q", command.Action)
+	}
+	if command.OlderThan != "30d" {
+		t.Errorf("expected OlderThan '30d', got %q", command.OlderThan)
+	}
+}
+
+func TestParseArgsArchiveCleanMissingValue(t *testing.T) {
+	_, err := ParseArgs([]string{"archive", "clean", "--older-than"})
+	if err == nil {
+		t.Fatal("expected error for --older-than without value")
+	}
+}
+
+func TestParseArgsArchiveDeleteAndRestore(t *testing.T) {
+	for _, subcommand := range []string{"delete", "restore"} {
+		command, err := ParseArgs([]string{"archive", subcommand, "devbox-20250115T103000", "-f", "/opt/stacks"})
+		if err != nil {
+			t.Fatalf("unexpected error for archive %s: %v", subcommand, err)
+		}
+		if command.Action != "archive-"+subcommand {
+			t.Errorf("expected action 'archive-%s', got %q", subcommand, command.Action)
+		}
+		if command.VMName != "devbox-20250115T103000" {
+			t.Errorf("expected entry 'devbox-20250115T103000', got %q", command.VMName)
+		}
+		if command.FolderPath != "/opt/stacks" {
+			t.Errorf("expected FolderPath '/opt/stacks', got %q", command.FolderPath)
+		}
+	}
+}
+
+func TestParseArgsArchiveErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"archive"},
+		{"archive", "prune"},
+		{"archive", "delete"},
+		{"archive", "list", "extra"},
+		{"archive", "clean", "--force"},
+	} {
+		if _, err := ParseArgs(args); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+}
+
+func TestParseArgsMigrate(t *testing.T) {
+	command, err := ParseArgs([]string{"migrate", "-f", "/opt/stacks", "--dry-run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.Action != "migrate" {
+		t.Errorf("expected action 'migrate', got %q", command.Action)
+	}
+	if command.FolderPath != "/opt/stacks" {
+		t.Errorf("expected FolderPath '/opt/stacks', got %q", command.FolderPath)
+	}
+	if !command.DryRun {
+		t.Error("expected DryRun=true for --dry-run")
+	}
+}
+
+func TestParseArgsMigrateUnknownFlag(t *testing.T) {
+	if _, err := ParseArgs([]string{"migrate", "devbox"}); err == nil {
+		t.Fatal("expected error for unexpected migrate argument")
+	}
+}
+
+func TestResolveProviderMigratesLegacyState(t *testing.T) {
+	directory := t.TempDir()
+	cfg := &config.Config{
+		VM: &config.VMConfig{
+			Name:  "devbox",
+			Users: []config.User{{Username: "ubuntu", GitHubUsername: "test"}},
+		},
+		Local: &config.LocalState{IP: "10.0.0.5"},
+	}
+	config.SaveState(directory, "devbox", "local", cfg)
+
+	stateStore := store.New(t.TempDir())
+	command := &Command{VMName: "devbox", FolderPath: directory}
+	if result := resolveProvider(stateStore, command); result != "multipass" {
+		t.Errorf("expected 'multipass', got %q", result)
+	}
+	if !stateStore.Exists("devbox") {
+		t.Fatal("expected legacy state to be migrated into the store")
+	}
+
+	_, source, err := loadManagedConfig(stateStore, command, "multipass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source != stateSourceStore {
+		t.Errorf("expected source %q after migration, got %q", stateSourceStore, source)
+	}
+}
+
+func TestParseArgsListAll(t *testing.T) {
+	command, err := ParseArgs([]string{"list", "--all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !command.All {
+		t.Error("expected All=true for --all")
+	}
+}
+
+func TestBuildListSourcesDefaultIsLocal(t *testing.T) {
+	sources := buildListSources("", false, nil, nil)
+	if len(sources) != 1 || sources[0].Provider != "multipass" {
+		t.Errorf("expected only multipass, got %v", sources)
+	}
+}
+
+func TestBuildListSourcesAWSUsesKnownRegions(t *testing.T) {
+	known := []knownVM{
+		{Name: "web", Provider: "aws", Region: "us-west-2"},
+		{Name: "api", Provider: "aws", Region: "eu-west-1"},
+		{Name: "db", Provider: "aws", Region: "us-west-2"},
+		{Name: "devbox", Provider: "multipass"},
+	}
+	sources := buildListSources("aws", false, known, nil)
+	if len(sources) != 2 {
+		t.Fatalf("expected 2 AWS regions, got %v", sources)
+	}
+	if sources[0].Region != "eu-west-1" || sources[1].Region != "us-west-2" {
+		t.Errorf("expected [eu-west-1 us-west-2], got %v", sources)
+	}
+}
+
+func TestBuildListSourcesAWSDefaultsRegion(t *testing.T) {
+	sources := buildListSources("aws", false, nil, func() string { return "eu-west-1" })
+	if len(sources) != 1 || sources[0].Region != "eu-west-1" {
+		t.Errorf("expected the default region fallback, got %v", sources)
+	}
+}
+
+func TestBuildListSourcesAll(t *testing.T) {
+	known := []knownVM{{Name: "web", Provider: "aws", Region: "us-west-2"}}
+	sources := buildListSources("", true, known, nil)
+	if len(sources) != 2 {
+		t.Fatalf("expected 2 sources, got %v", sources)
+	}
+	if sources[0].Provider != "multipass" || sources[1].Provider != "aws" {
+		t.Errorf("expected multipass then aws, got %v", sources)
+	}
+}
+
+func TestBuildListRowsMarksOrphansAndMissing(t *testing.T) {
+	known := []knownVM{
+		{Name: "devbox", Provider: "multipass", StackFolder: "/stacks/devbox"},
+		{Name: "gone", Provider: "multipass", StackFolder: "/stacks/gone"},
+		{Name: "web", Provider: "aws", Region: "us-west-2", StackFolder: "/stacks/web"},
+	}
+	results := []listResult{
+		{
+			Source: listSource{Provider: "multipass"},
+			Statuses: []provider.VMStatus{
+				{Name: "devbox", State: "Running", Provider: "multipass"},
+				{Name: "scratch", State: "Stopped", Provider: "multipass"},
+			},
+		},
+		{
+			Source:   listSource{Provider: "aws", Region: "us-west-2"},
+			Statuses: []provider.VMStatus{{Name: "web", State: "running", Provider: "aws"}},
+		},
+		{
+			Source: listSource{Provider: "aws", Region: "eu-west-1"},
+			Err:    fmt.Errorf("access denied"),
+		},
+	}
+
+	rows := buildListRows(results, known)
+	if len(rows) != 4 {
+		t.Fatalf("expected 4 rows, got %d: %v", len(rows), rows)
+	}
+	if rows[0].Status.Name != "devbox" || rows[0].Orphan || rows[0].StackFolder != "/stacks/devbox" {
+		t.Errorf("devbox row = %+v", rows[0])
+	}
+	if rows[1].Status.Name != "scratch" || !rows[1].Orphan {
+		t.Errorf("scratch should be an orphan: %+v", rows[1])
+	}
+	if rows[2].Status.Name != "gone" || rows[2].Status.State != "missing" {
+		t.Errorf("gone should be reported missing: %+v", rows[2])
+	}
+	if rows[3].Status.Name != "web" || rows[3].Region != "us-west-2" || rows[3].StackFolder != "/stacks/web" {
+		t.Errorf("web row = %+v", rows[3])
+	}
+}
+
+func TestParseArgsOutputFormat(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"list", "--output", "json"}, "json"},
+		{[]string{"list", "-o", "yaml", "--all"}, "yaml"},
+		{[]string{"status", "devbox", "-o", "json"}, "json"},
+		{[]string{"create", "devbox", "--output", "yaml"}, "yaml"},
+		{[]string{"status", "devbox", "--output", "table"}, "table"},
+	}
+	for _, test := range tests {
+		command, err := ParseArgs(test.args)
+		if err != nil {
+			t.Fatalf("ParseArgs(%v) returned error: %v", test.args, err)
+		}
+		if command.Output != test.want {
+			t.Errorf("ParseArgs(%v).Output = %q, want %q", test.args, command.Output, test.want)
+		}
+	}
+}
+
+func TestParseArgsOutputErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"list", "--output"},
+		{"list", "-o", "xml"},
+		{"status", "devbox", "--output", "csv"},
+		{"ssh", "devbox", "-o", "json"},
+		{"destroy", "devbox", "--output", "json"},
+	} {
+		if _, err := ParseArgs(args); err == nil {
+			t.Errorf("ParseArgs(%v) should return error", args)
+		}
+	}
+}
+
+func TestEnrichStatusFromState(t *testing.T) {
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	configuration := &config.Config{
+		VM: &config.VMConfig{Name: "web", Image: "ubuntu-24.04"},
+		AWS: &config.AWSState{
+			InstanceID: "i-0123456789abcdef0",
+			PublicIP:   "54.1.2.3",
+			FQDN:       "web.example.com",
+			AMIID:      "ami-0abc",
+		},
+	}
+	status := &provider.VMStatus{Name: "web", State: "running", Provider: "aws"}
+	enrichStatus(status, configuration, &store.State{CreatedAt: createdAt})
+
+	if status.IP != "54.1.2.3" || status.InstanceID != "i-0123456789abcdef0" || status.FQDN != "web.example.com" {
+		t.Errorf("status not enriched from AWS state: %+v", status)
+	}
+	if status.Image != "ami-0abc" {
+		t.Errorf("Image = %q, want %q", status.Image, "ami-0abc")
+	}
+	if status.CreatedAt == nil || !status.CreatedAt.Equal(createdAt) {
+		t.Errorf("CreatedAt = %v, want %v", status.CreatedAt, createdAt)
+	}
+}
+
+func TestVMStatusJSONSchema(t *testing.T) {
+	data, err := json.Marshal(listOutput{
+		VMStatus: provider.VMStatus{Name: "devbox", State: "Running", Provider: "multipass"},
+		Orphan:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"name"`, `"state"`, `"ip"`, `"provider"`, `"instance_id"`, `"fqdn"`, `"image"`, `"created_at"`, `"region"`, `"stack_folder"`, `"orphan":true`} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("JSON output missing %s: %s", key, data)
+		}
+	}
+}
+
+func TestListOutputYAMLInlinesStatus(t *testing.T) {
+	data, err := yaml.Marshal(listOutput{
+		VMStatus: provider.VMStatus{Name: "devbox", State: "Running", Provider: "multipass"},
+		Region:   "us-west-2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "name: devbox") || !strings.Contains(string(data), "region: us-west-2") {
+		t.Errorf("unexpected YAML output:\n%s", data)
+	}
+}
+
+func TestParseArgsRefreshKeys(t *testing.T) {
+	command, err := ParseArgs([]string{"create", "devbox", "--refresh-keys"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !command.RefreshKeys {
+		t.Error("expected RefreshKeys=true for --refresh-keys")
+	}
+}
+
+func TestParseArgsCreateWait(t *testing.T) {
+	command, err := ParseArgs([]string{"create", "devbox", "--wait", "--timeout", "30m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !command.Wait || command.Timeout != "30m" {
+		t.Errorf("expected Wait=true Timeout=30m, got %+v", command)
+	}
+}
+
+func TestParseArgsWaitCommand(t *testing.T) {
+	command, err := ParseArgs([]string{"wait", "devbox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.Action != "wait" || command.VMName != "devbox" {
+		t.Errorf("expected wait devbox, got %+v", command)
+	}
+	if _, err := ParseArgs([]string{"wait", "devbox", "--timeout"}); err == nil {
+		t.Error("--timeout without a value should return error")
+	}
+}
+
+func TestParseArgsExec(t *testing.T) {
+	command, err := ParseArgs([]string{"exec", "devbox", "--aws", "--", "ls", "-v", "/tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.VMName != "devbox" || command.ProviderFlag != "aws" {
+		t.Errorf("unexpected command: %+v", command)
+	}
+	if strings.Join(command.RemoteArgs, " ") != "ls -v /tmp" {
+		t.Errorf("RemoteArgs = %v, want [ls -v /tmp]", command.RemoteArgs)
+	}
+	if command.Verbose {
+		t.Error("-v after -- belongs to the remote command")
+	}
+}
+
+func TestParseArgsExecRequiresCommand(t *testing.T) {
+	for _, args := range [][]string{
+		{"exec", "devbox"},
+		{"exec", "devbox", "--"},
+		{"exec", "--", "ls"},
+	} {
+		if _, err := ParseArgs(args); err == nil {
+			t.Errorf("ParseArgs(%v) should return error", args)
+		}
+	}
+}
+
+func TestParseArgsCopy(t *testing.T) {
+	command, err := ParseArgs([]string{"cp", "./build/app", "devbox:/opt/app", "--local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.VMName != "devbox" || command.CopySource != "./build/app" || command.CopyDest != "devbox:/opt/app" {
+		t.Errorf("unexpected command: %+v", command)
+	}
+
+	command, err = ParseArgs([]string{"cp", "web:/var/log/syslog", "logs/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.VMName != "web" {
+		t.Errorf("VMName = %q, want web", command.VMName)
+	}
+}
+
+func TestParseArgsCopyErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"cp", "a", "b"},
+		{"cp", "web:/a", "devbox:/b"},
+		{"cp", "web:/a"},
+		{"cp", "web:/a", "b", "c"},
+		{"cp", "--bogus", "web:/a", "b"},
+	} {
+		if _, err := ParseArgs(args); err == nil {
+			t.Errorf("ParseArgs(%v) should return error", args)
+		}
+	}
+}
+
+func TestSplitRemotePath(t *testing.T) {
+	tests := []struct {
+		input      string
+		wantName   string
+		wantPath   string
+		wantRemote bool
+	}{
+		{"devbox:/tmp/file", "devbox", "/tmp/file", true},
+		{"devbox:", "devbox", "", true},
+		{"./dir/with:colon", "", "./dir/with:colon", false},
+		{"/abs/path", "", "/abs/path", false},
+		{":/tmp", "", ":/tmp", false},
+	}
+	for _, test := range tests {
+		name, path, remote := splitRemotePath(test.input)
+		if name != test.wantName || path != test.wantPath || remote != test.wantRemote {
+			t.Errorf("splitRemotePath(%q) = %q, %q, %v", test.input, name, path, remote)
+		}
+	}
+}
+
+func TestParseArgsSSHPassthrough(t *testing.T) {
+	command, err := ParseArgs([]string{"ssh", "devbox", "--", "tail", "-f", "/var/log/syslog"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.VMName != "devbox" || strings.Join(command.RemoteArgs, " ") != "tail -f /var/log/syslog" {
+		t.Errorf("unexpected command: %+v", command)
+	}
+
+	command, err = ParseArgs([]string{"ssh", "devbox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(command.RemoteArgs) != 0 {
+		t.Errorf("RemoteArgs = %v, want none", command.RemoteArgs)
+	}
+}
+
+func TestParseArgsReapAndExtend(t *testing.T) {
+	command, err := ParseArgs([]string{"reap", "--dry-run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.Action != "reap" || !command.DryRun {
+		t.Errorf("expected reap --dry-run, got %+v", command)
+	}
+	if _, err := ParseArgs([]string{"reap", "devbox"}); err == nil {
+		t.Error("reap should not accept a VM name")
+	}
+
+	command, err = ParseArgs([]string{"extend", "devbox", "4h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.Action != "extend" || command.VMName != "devbox" || command.ExtendBy != "4h" {
+		t.Errorf("expected extend devbox 4h, got %+v", command)
+	}
+	for _, args := range [][]string{{"extend", "devbox"}, {"extend", "devbox", "later"}, {"extend", "devbox", "0h"}} {
+		if _, err := ParseArgs(args); err == nil {
+			t.Errorf("ParseArgs(%v) should return error", args)
+		}
+	}
+}
+
+func TestFormatRemaining(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		expiresAt := now.Add(d)
+		return &expiresAt
+	}
+	for _, tc := range []struct {
+		expiresAt *time.Time
+		want      string
+	}{
+		{nil, "-"},
+		{at(-time.Minute), "expired"},
+		{at(45 * time.Minute), "45m"},
+		{at(3*time.Hour + 12*time.Minute), "3h12m"},
+		{at(51 * time.Hour), "2d3h"},
+	} {
+		if got := formatRemaining(tc.expiresAt, now); got != tc.want {
+			t.Errorf("formatRemaining(%v) = %q, want %q", tc.expiresAt, got, tc.want)
+		}
+	}
+}
+
+func TestFindExpiredVMs(t *testing.T) {
+	stateStore := store.New(t.TempDir())
+	now := time.Now()
+	for _, vm := range []struct {
+		name, action string
+		expiresIn    time.Duration
+	}{
+		{"stale", "", -time.Hour},
+		{"doomed", config.TTLActionDestroy, -time.Minute},
+		{"fresh", "", time.Hour},
+		{"forever", "", 0},
+	} {
+		cfg := &config.Config{VM: &config.VMConfig{
+			Name:      vm.name,
+			Users:     []config.User{{Username: "ubuntu", GitHubUsername: "test"}},
+			TTLAction: vm.action,
+		}}
+		state := store.NewState(vm.name, "aws", "/projects/stacks/"+vm.name, cfg)
+		if vm.expiresIn != 0 {
+			expiresAt := now.Add(vm.expiresIn)
+			state.ExpiresAt = &expiresAt
+		}
+		stateStore.SaveConfig(vm.name, cfg)
+		stateStore.SaveState(vm.name, state)
+	}
+
+	expired := findExpiredVMs(stateStore, now)
+	if len(expired) != 2 {
+		t.Fatalf("expected 2 expired VMs, got %+v", expired)
+	}
+	actions := map[string]string{}
+	for _, vm := range expired {
+		actions[vm.Name] = vm.Action
+		if vm.StackFolder != "/projects/stacks" {
+			t.Errorf("%s: StackFolder = %q, want the recorded stack folder", vm.Name, vm.StackFolder)
+		}
+	}
+	if actions["stale"] != config.TTLActionStop || actions["doomed"] != config.TTLActionDestroy {
+		t.Errorf("unexpected reap actions %v", actions)
+	}
+}
+
+func TestParseIdleTimes(t *testing.T) {
+	output := cloudinit.IdleSincePath + ":1767268800\n" + cloudinit.IdleStoppedPath + ":1767182400\n"
+	idleSince, lastIdleStop := parseIdleTimes(output)
+	if idleSince == nil || idleSince.Unix() != 1767268800 {
+		t.Errorf("unexpected idle since %v", idleSince)
+	}
+	if lastIdleStop == nil || lastIdleStop.Unix() != 1767182400 {
+		t.Errorf("unexpected last idle stop %v", lastIdleStop)
+	}
+
+	idleSince, lastIdleStop = parseIdleTimes(cloudinit.IdleSincePath + ":garbage\n")
+	if idleSince != nil || lastIdleStop != nil {
+		t.Errorf("expected no timestamps from bad output, got %v %v", idleSince, lastIdleStop)
+	}
+}
+
+func TestRememberIdleStop(t *testing.T) {
+	stopped := time.Unix(1767182400, 0).UTC()
+	state := &store.State{Name: "devbox"}
+
+	if !rememberIdleStop(&provider.IdleStatus{LastIdleStop: &stopped}, state) {
+		t.Fatal("expected a new idle stop to change state")
+	}
+	if state.LastIdleStop == nil || !state.LastIdleStop.Equal(stopped) {
+		t.Fatalf("expected state to record %v, got %v", stopped, state.LastIdleStop)
+	}
+	if rememberIdleStop(&provider.IdleStatus{LastIdleStop: &stopped}, state) {
+		t.Error("expected the same idle stop to leave state alone")
+	}
+
+	stoppedVM := &provider.IdleStatus{Minutes: 30}
+	if rememberIdleStop(stoppedVM, state) {
+		t.Error("expected a stopped VM to leave state alone")
+	}
+	if stoppedVM.LastIdleStop == nil || !stoppedVM.LastIdleStop.Equal(stopped) {
+		t.Errorf("expected the stored idle stop for a stopped VM, got %v", stoppedVM.LastIdleStop)
+	}
+
+	if rememberIdleStop(&provider.IdleStatus{LastIdleStop: &stopped}, nil) {
+		t.Error("expected no state change without goloo state")
+	}
+}
+
+func TestParseArgsSnapshot(t *testing.T) {
+	for _, tc := range []struct {
+		args           []string
+		action, vmName string
+		snapshot       string
+		provider       string
+	}{
+		{[]string{"snapshot", "create", "devbox"}, "snapshot-create", "devbox", "", ""},
+		{[]string{"snapshot", "create", "devbox", "pre-upgrade", "--aws"}, "snapshot-create", "devbox", "pre-upgrade", "aws"},
+		{[]string{"snapshot", "list", "devbox", "--local"}, "snapshot-list", "devbox", "", "local"},
+		{[]string{"snapshot", "restore", "devbox", "pre-upgrade"}, "snapshot-restore", "devbox", "pre-upgrade", ""},
+		{[]string{"snapshot", "delete", "devbox", "pre-upgrade", "-f", "stacks"}, "snapshot-delete", "devbox", "pre-upgrade", ""},
+	} {
+		command, err := ParseArgs(tc.args)
+		if err != nil {
+			t.Errorf("ParseArgs(%v) returned error: %v", tc.args, err)
+			continue
+		}
+		if command.Action != tc.action || command.VMName != tc.vmName || command.SnapshotName != tc.snapshot || command.ProviderFlag != tc.provider {
+			t.Errorf("ParseArgs(%v) = %+v", tc.args, command)
+		}
+	}
+}
+
+func TestParseArgsSnapshotErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"snapshot"},
+		{"snapshot", "rollback", "devbox"},
+		{"snapshot", "create"},
+		{"snapshot", "restore", "devbox"},
+		{"snapshot", "delete", "devbox", "--aws"},
+		{"snapshot", "create", "devbox", "bad.name"},
+		{"snapshot", "list", "devbox", "extra"},
+	} {
+		if _, err := ParseArgs(args); err == nil {
+			t.Errorf("ParseArgs(%v) should return error", args)
+		}
+	}
+}
+
+func TestSourceConfigDirIsAbsolute(t *testing.T) {
+	directory := sourceConfigDir(filepath.Join("stacks", "devbox", "config.json"))
+	if !filepath.IsAbs(directory) || !strings.HasSuffix(directory, filepath.Join("stacks", "devbox")) {
+		t.Errorf("sourceConfigDir() = %q, want an absolute path ending in stacks/devbox", directory)
+	}
+}
+
+func TestLoadSnapshotterSetsAWSStackFolderAndVersion(t *testing.T) {
+	stateDir := t.TempDir()
+	t.Setenv("GOLOO_STATE_DIR", stateDir)
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(stateDir, "aws-config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(stateDir, "aws-credentials"))
+
+	cfg := &config.Config{VM: &config.VMConfig{
+		Name:   "devbox",
+		Region: "us-west-2",
+		Users:  []config.User{{Username: "ubuntu", GitHubUsername: "test"}},
+	}}
+	stateStore := store.New(stateDir)
+	stateStore.SaveConfig("devbox", cfg)
+	stateStore.SaveState("devbox", store.NewState("devbox", "aws", "/projects/stacks/devbox", cfg))
+
+	snapshotter, _, _, _, err := loadSnapshotter(&Command{VMName: "devbox"})
+	if err != nil {
+		t.Fatalf("loadSnapshotter() returned error: %v", err)
+	}
+	awsProvider, ok := snapshotter.(*awsprovider.Provider)
+	if !ok {
+		t.Fatalf("expected an AWS provider, got %T", snapshotter)
+	}
+	if awsProvider.StackFolder != "/projects/stacks/devbox" {
+		t.Errorf("StackFolder = %q, want %q", awsProvider.StackFolder, "/projects/stacks/devbox")
+	}
+	if awsProvider.Version != version {
+		t.Errorf("Version = %q, want %q", awsProvider.Version, version)
+	}
+}
+
+func TestIsRecordedStackFolder(t *testing.T) {
+	directory := t.TempDir()
+	recorded := filepath.Join(directory, "devbox")
+	if !isRecordedStackFolder(directory, "devbox", recorded) {
+		t.Error("expected the recorded stack folder to match")
+	}
+	if !isRecordedStackFolder(recorded, "devbox", recorded) {
+		t.Error("expected a stack folder holding config.json directly to match")
+	}
+	if isRecordedStackFolder("stacks", "devbox", recorded) {
+		t.Error("a different stack folder should not match")
+	}
+	if isRecordedStackFolder(directory, "devbox", "") {
+		t.Error("an unrecorded source should not match")
+	}
+}
+
+func TestDataVolumeRestoreWarning(t *testing.T) {
+	rootOnly := config.Snapshot{Name: "pre-upgrade", ID: "ami-0fedcba987654321", SnapshotIDs: []string{"snap-root"}}
+	withData := config.Snapshot{Name: "pre-upgrade", ID: "ami-0fedcba987654321", SnapshotIDs: []string{"snap-root", "snap-data"}}
+	if warning := dataVolumeRestoreWarning("aws", rootOnly); warning != "" {
+		t.Errorf("expected no warning for a root-only image, got %q", warning)
+	}
+	if warning := dataVolumeRestoreWarning("multipass", withData); warning != "" {
+		t.Errorf("expected no warning for multipass, got %q", warning)
+	}
+	if warning := dataVolumeRestoreWarning("aws", withData); !strings.Contains(warning, "snap-data") {
+		t.Errorf("expected the warning to list the data volume snapshots, got %q", warning)
+	}
+}
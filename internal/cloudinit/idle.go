@@ -0,0 +1,156 @@
+package cloudinit
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	cloudConfigHeader = "#cloud-config"
+
+	IdleCheckPath   = "/usr/local/sbin/goloo-idle-check"
+	IdleSincePath   = "/run/goloo/idle-since"
+	IdleStoppedPath = "/var/lib/goloo/idle-stopped"
+	idleServicePath = "/etc/systemd/system/goloo-idle.service"
+	idleTimerPath   = "/etc/systemd/system/goloo-idle.timer"
+	idleTimerName   = "goloo-idle.timer"
+)
+
+const idleCheckScript = `#!/bin/sh
+# Installed by goloo (vm.idle_stop): power off after %[1]d idle minutes.
+# Idle means no SSH sessions and CPU use below %[2]d%%.
+set -eu
+
+IDLE_MINUTES=%[1]d
+CPU_PERCENT=%[2]d
+IDLE_SINCE=%[3]s
+IDLE_STOPPED=%[4]s
+
+sessions_active() {
+    [ -n "$(who)" ] && return 0
+    ss -Htn state established '( sport = :22 )' | grep -q .
+}
+
+cpu_busy() {
+    read -r _ u1 n1 s1 i1 w1 q1 sq1 st1 _ < /proc/stat
+    sleep 10
+    read -r _ u2 n2 s2 i2 w2 q2 sq2 st2 _ < /proc/stat
+    busy=$(( (u2 + n2 + s2 + q2 + sq2 + st2) - (u1 + n1 + s1 + q1 + sq1 + st1) ))
+    total=$(( busy + (i2 + w2) - (i1 + w1) ))
+    [ "$total" -gt 0 ] && [ $(( busy * 100 / total )) -ge "$CPU_PERCENT" ]
+}
+
+now=$(date +%%s)
+if sessions_active || cpu_busy; then
+    rm -f "$IDLE_SINCE"
+    exit 0
+fi
+
+mkdir -p "$(dirname "$IDLE_SINCE")" "$(dirname "$IDLE_STOPPED")"
+[ -s "$IDLE_SINCE" ] || echo "$now" > "$IDLE_SINCE"
+since=$(cat "$IDLE_SINCE")
+if [ $(( now - since )) -ge $(( IDLE_MINUTES * 60 )) ]; then
+    echo "$now" > "$IDLE_STOPPED"
+    logger -t goloo-idle "no activity for ${IDLE_MINUTES}m, powering off"
+    systemctl poweroff
+fi
+`
+
+const idleService = `[Unit]
+Description=goloo idle check
+
+[Service]
+Type=oneshot
+ExecStart=` + IdleCheckPath + `
+`
+
+const idleTimer = `[Unit]
+Description=Power off when idle (goloo vm.idle_stop)
+
+[Timer]
+OnBootSec=5min
+OnUnitActiveSec=1min
+
+[Install]
+WantedBy=timers.target
+`
+
+type writeFile struct {
+	Path        string `yaml:"path"`
+	Permissions string `yaml:"permissions"`
+	Content     string `yaml:"content"`
+}
+
+func IdleCheckScript(idle *config.IdleStopConfig) string {
+	return fmt.Sprintf(idleCheckScript, idle.Minutes, idle.CPUPercent, IdleSincePath, IdleStoppedPath)
+}
+
+func AddIdleStop(content string, idle *config.IdleStopConfig) (string, error) {
+	if idle == nil {
+		return content, nil
+	}
+	if !strings.HasPrefix(strings.TrimLeft(content, " \t\r\n"), cloudConfigHeader) {
+		return "", fmt.Errorf("vm.idle_stop requires a cloud-init file that starts with %s", cloudConfigHeader)
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil {
+		return "", fmt.Errorf("vm.idle_stop: failed to parse cloud-init: %w", err)
+	}
+	if len(document.Content) == 0 {
+		document = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return "", fmt.Errorf("vm.idle_stop: cloud-init must be a YAML mapping")
+	}
+
+	files := []writeFile{
+		{Path: IdleCheckPath, Permissions: "0755", Content: IdleCheckScript(idle)},
+		{Path: idleServicePath, Permissions: "0644", Content: idleService},
+		{Path: idleTimerPath, Permissions: "0644", Content: idleTimer},
+	}
+	commands := [][]string{
+		{"systemctl", "daemon-reload"},
+		{"systemctl", "enable", "--now", idleTimerName},
+	}
+	if err := appendToSequence(root, "write_files", files); err != nil {
+		return "", err
+	}
+	if err := appendToSequence(root, "runcmd", commands); err != nil {
+		return "", err
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return "", fmt.Errorf("vm.idle_stop: failed to render cloud-init: %w", err)
+	}
+	encoder.Close()
+	return cloudConfigHeader + "\n" + strings.TrimPrefix(buffer.String(), cloudConfigHeader+"\n"), nil
+}
+
+func appendToSequence(mapping *yaml.Node, key string, values interface{}) error {
+	var items yaml.Node
+	if err := items.Encode(values); err != nil {
+		return fmt.Errorf("vm.idle_stop: failed to encode %s: %w", key, err)
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != key {
+			continue
+		}
+		sequence := mapping.Content[i+1]
+		if sequence.Kind != yaml.SequenceNode {
+			return fmt.Errorf("vm.idle_stop: cloud-init %s must be a list", key)
+		}
+		sequence.Content = append(sequence.Content, items.Content...)
+		return nil
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &items)
+	return nil
+}
@@ -0,0 +1,117 @@
+package cloudinit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+type idleCloudConfig struct {
+	Packages   []string `yaml:"packages"`
+	WriteFiles []struct {
+		Path        string `yaml:"path"`
+		Permissions string `yaml:"permissions"`
+		Content     string `yaml:"content"`
+	} `yaml:"write_files"`
+	RunCmd []interface{} `yaml:"runcmd"`
+}
+
+func parseIdleCloudConfig(t *testing.T, content string) idleCloudConfig {
+	t.Helper()
+	if !strings.HasPrefix(content, "#cloud-config\n") || strings.Count(content, "#cloud-config") != 1 {
+		t.Fatalf("expected a single #cloud-config header, got:\n%s", content)
+	}
+	var parsed idleCloudConfig
+	if err := yaml.Unmarshal([]byte(content), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestAddIdleStopMergesIntoExistingLists(t *testing.T) {
+	content := "#cloud-config\npackages:\n  - nginx\nwrite_files:\n  - path: /etc/motd\n    content: hello\nruncmd:\n  - echo ready\n"
+	idle := &config.IdleStopConfig{Minutes: 45, CPUPercent: 10}
+
+	result, err := AddIdleStop(content, idle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := parseIdleCloudConfig(t, result)
+
+	if len(parsed.Packages) != 1 || parsed.Packages[0] != "nginx" {
+		t.Errorf("expected packages to be kept, got %v", parsed.Packages)
+	}
+	if len(parsed.WriteFiles) != 4 || parsed.WriteFiles[0].Path != "/etc/motd" {
+		t.Fatalf("expected the user's file plus three idle files, got %+v", parsed.WriteFiles)
+	}
+	script := parsed.WriteFiles[1]
+	if script.Path != IdleCheckPath || script.Permissions != "0755" {
+		t.Errorf("unexpected idle script entry %+v", script)
+	}
+	if !strings.Contains(script.Content, "IDLE_MINUTES=45\n") || !strings.Contains(script.Content, "CPU_PERCENT=10\n") {
+		t.Errorf("idle script does not carry the policy:\n%s", script.Content)
+	}
+	if len(parsed.RunCmd) != 3 || parsed.RunCmd[0] != "echo ready" {
+		t.Errorf("expected the user's runcmd first, got %v", parsed.RunCmd)
+	}
+	if !strings.Contains(result, idleTimerName) {
+		t.Error("expected runcmd to enable the idle timer")
+	}
+}
+
+func TestAddIdleStopCreatesLists(t *testing.T) {
+	result, err := AddIdleStop("#cloud-config\n", &config.IdleStopConfig{Minutes: 30, CPUPercent: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := parseIdleCloudConfig(t, result)
+	if len(parsed.WriteFiles) != 3 || len(parsed.RunCmd) != 2 {
+		t.Errorf("expected idle files and commands, got %+v", parsed)
+	}
+}
+
+func TestAddIdleStopDisabled(t *testing.T) {
+	content := "#!/bin/sh\necho hello\n"
+	result, err := AddIdleStop(content, nil)
+	if err != nil || result != content {
+		t.Errorf("expected content unchanged without idle_stop, got %q, %v", result, err)
+	}
+}
+
+func TestAddIdleStopErrors(t *testing.T) {
+	idle := &config.IdleStopConfig{Minutes: 30, CPUPercent: 5}
+	for _, content := range []string{
+		"#!/bin/sh\necho hello\n",
+		"#cloud-config\n- not a mapping\n",
+		"#cloud-config\nruncmd: echo hello\n",
+	} {
+		if _, err := AddIdleStop(content, idle); err == nil {
+			t.Errorf("AddIdleStop(%q) should return error", content)
+		}
+	}
+}
+
+func TestProcessInjectsIdleStop(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "cloud-init.yaml")
+	os.WriteFile(templatePath, []byte("#cloud-config\npackages:\n  - git\n"), 0644)
+	configuration := &config.Config{
+		VM: &config.VMConfig{
+			Users:    []config.User{{Username: "ubuntu", SSHKeys: []string{"ssh-ed25519 AAAAC3 key"}}},
+			IdleStop: &config.IdleStopConfig{Minutes: 20, CPUPercent: 5},
+		},
+	}
+
+	resultPath, err := Process(templatePath, configuration, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(resultPath)
+	data, _ := os.ReadFile(resultPath)
+	if !strings.Contains(string(data), "IDLE_MINUTES=20") {
+		t.Errorf("expected the idle agent in processed cloud-init, got:\n%s", data)
+	}
+}
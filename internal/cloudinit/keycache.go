@@ -0,0 +1,139 @@
+package cloudinit
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const DefaultKeyCacheTTL = time.Hour
+
+type KeyCache struct {
+	Dir     string
+	TTL     time.Duration
+	Refresh bool
+	Warn    func(message string)
+	now     func() time.Time
+}
+
+func NewKeyCache(dir string, ttl time.Duration, refresh bool, warn func(message string)) *KeyCache {
+	return &KeyCache{Dir: dir, TTL: ttl, Refresh: refresh, Warn: warn, now: time.Now}
+}
+
+func DefaultKeyCacheDir() (string, error) {
+	if cacheHome := os.Getenv("XDG_CACHE_HOME"); cacheHome != "" {
+		return filepath.Join(cacheHome, "goloo", "keys"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve key cache directory: %w", err)
+	}
+	return filepath.Join(home, ".cache", "goloo", "keys"), nil
+}
+
+func (c *KeyCache) Wrap(sources KeySources) KeySources {
+	wrapped := sources
+	if sources.GitHub != nil {
+		wrapped.GitHub = func(username string) (string, error) {
+			return c.fetch(c.path("github", username), "GitHub user "+username, func() (string, error) {
+				return sources.GitHub(username)
+			})
+		}
+	}
+	if sources.GitLab != nil {
+		wrapped.GitLab = func(baseURL, username string) (string, error) {
+			return c.fetch(c.path(filepath.Join("gitlab", gitLabCacheKey(baseURL)), username), "GitLab user "+username, func() (string, error) {
+				return sources.GitLab(baseURL, username)
+			})
+		}
+	}
+	return wrapped
+}
+
+func (c *KeyCache) path(source, username string) string {
+	if username == "" || username == "." || username == ".." || strings.ContainsAny(username, `/\`) {
+		return ""
+	}
+	return filepath.Join(c.Dir, source, username+".keys")
+}
+
+func (c *KeyCache) fetch(path, label string, fetchKeys func() (string, error)) (string, error) {
+	if path == "" {
+		return fetchKeys()
+	}
+	cached, modified, cacheErr := readCachedKeys(path)
+	if cacheErr == nil && !c.Refresh && c.now().Sub(modified) < c.TTL {
+		return cached, nil
+	}
+
+	keys, err := fetchKeys()
+	if err == nil {
+		if writeErr := writeCachedKeys(path, keys); writeErr != nil {
+			c.warn(fmt.Sprintf("failed to cache SSH keys for %s: %v", label, writeErr))
+		}
+		return keys, nil
+	}
+	if cacheErr != nil {
+		return "", err
+	}
+
+	age := c.now().Sub(modified).Truncate(time.Minute)
+	c.warn(fmt.Sprintf("%v; using SSH keys for %s cached %s ago", err, label, age))
+	return cached, nil
+}
+
+func (c *KeyCache) warn(message string) {
+	if c.Warn != nil {
+		c.Warn(message)
+	}
+}
+
+func readCachedKeys(path string) (string, time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	keys := strings.TrimSpace(string(data))
+	if keys == "" {
+		return "", time.Time{}, fmt.Errorf("cached keys in %s are empty", path)
+	}
+	return keys, info.ModTime(), nil
+}
+
+func writeCachedKeys(path, keys string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	temporaryFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporaryFile.Name())
+
+	if _, err := temporaryFile.WriteString(keys + "\n"); err != nil {
+		temporaryFile.Close()
+		return err
+	}
+	if err := temporaryFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporaryFile.Name(), path)
+}
+
+func gitLabCacheKey(baseURL string) string {
+	if baseURL == "" {
+		baseURL = GitLabBaseURL
+	}
+	parsed, err := url.Parse(baseURL)
+	if err != nil || parsed.Host == "" {
+		return "default"
+	}
+	return url.PathEscape(strings.ToLower(parsed.Host) + strings.TrimRight(parsed.EscapedPath(), "/"))
+}
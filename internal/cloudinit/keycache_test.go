@@ -0,0 +1,226 @@
+package cloudinit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+func countingSources(keys string, err error, calls *int32) KeySources {
+	return KeySources{
+		GitHub: func(username string) (string, error) {
+			atomic.AddInt32(calls, 1)
+			return keys, err
+		},
+		GitLab: func(baseURL, username string) (string, error) {
+			atomic.AddInt32(calls, 1)
+			return keys, err
+		},
+	}
+}
+
+func TestKeyCacheStoresAndReusesFreshKeys(t *testing.T) {
+	var calls int32
+	cache := NewKeyCache(t.TempDir(), time.Hour, false, nil)
+	sources := cache.Wrap(countingSources("ssh-ed25519 fresh-key", nil, &calls))
+
+	for i := 0; i < 2; i++ {
+		keys, err := sources.GitHub("alice")
+		if err != nil {
+			t.Fatalf("GitHub() returned error: %v", err)
+		}
+		if keys != "ssh-ed25519 fresh-key" {
+			t.Errorf("GitHub() = %q", keys)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected one fetch, got %d", calls)
+	}
+}
+
+func TestKeyCacheRefetchesAfterTTL(t *testing.T) {
+	var calls int32
+	cache := NewKeyCache(t.TempDir(), time.Hour, false, nil)
+	sources := cache.Wrap(countingSources("ssh-ed25519 key", nil, &calls))
+
+	sources.GitHub("alice")
+	cache.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	sources.GitHub("alice")
+	if calls != 2 {
+		t.Errorf("expected a second fetch after TTL, got %d fetches", calls)
+	}
+}
+
+func TestKeyCacheRefreshBypassesCache(t *testing.T) {
+	var calls int32
+	directory := t.TempDir()
+	NewKeyCache(directory, time.Hour, false, nil).Wrap(countingSources("ssh-ed25519 key", nil, &calls)).GitHub("alice")
+
+	NewKeyCache(directory, time.Hour, true, nil).Wrap(countingSources("ssh-ed25519 key", nil, &calls)).GitHub("alice")
+	if calls != 2 {
+		t.Errorf("Refresh should force a fetch, got %d fetches", calls)
+	}
+}
+
+func TestKeyCacheFallsBackOnFetchError(t *testing.T) {
+	var calls int32
+	directory := t.TempDir()
+	NewKeyCache(directory, time.Hour, false, nil).Wrap(countingSources("ssh-ed25519 cached-key", nil, &calls)).GitLab("", "alice")
+
+	var warnings []string
+	cache := NewKeyCache(directory, time.Hour, true, func(message string) {
+		warnings = append(warnings, message)
+	})
+	keys, err := cache.Wrap(countingSources("", fmt.Errorf("network unreachable"), &calls)).GitLab("", "alice")
+	if err != nil {
+		t.Fatalf("expected cached fallback, got error: %v", err)
+	}
+	if keys != "ssh-ed25519 cached-key" {
+		t.Errorf("GitLab() = %q, want cached key", keys)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "network unreachable") {
+		t.Errorf("expected a warning mentioning the fetch error, got %v", warnings)
+	}
+}
+
+func TestKeyCacheErrorWithoutCache(t *testing.T) {
+	var calls int32
+	cache := NewKeyCache(t.TempDir(), time.Hour, false, nil)
+	if _, err := cache.Wrap(countingSources("", fmt.Errorf("network unreachable"), &calls)).GitHub("alice"); err == nil {
+		t.Fatal("expected error when fetch fails and nothing is cached")
+	}
+}
+
+func TestKeyCacheSeparatesGitLabHosts(t *testing.T) {
+	directory := t.TempDir()
+	cache := NewKeyCache(directory, time.Hour, false, nil)
+	sources := cache.Wrap(KeySources{
+		GitLab: func(baseURL, username string) (string, error) {
+			return "ssh-ed25519 " + baseURL, nil
+		},
+	})
+	sources.GitLab("https://gitlab.example.com", "alice")
+
+	if _, err := os.Stat(filepath.Join(directory, "gitlab", "gitlab.example.com", "alice.keys")); err != nil {
+		t.Errorf("expected cache file per GitLab host: %v", err)
+	}
+}
+
+func TestKeyCacheSeparatesGitLabInstancesOnOneHost(t *testing.T) {
+	directory := t.TempDir()
+	cache := NewKeyCache(directory, time.Hour, false, nil)
+	sources := cache.Wrap(KeySources{
+		GitLab: func(baseURL, username string) (string, error) {
+			return "ssh-ed25519 " + baseURL, nil
+		},
+	})
+	first, _ := sources.GitLab("https://example.com/gitlab-a", "alice")
+	second, _ := sources.GitLab("https://example.com/gitlab-b/", "alice")
+
+	if first != "ssh-ed25519 https://example.com/gitlab-a" || second != "ssh-ed25519 https://example.com/gitlab-b/" {
+		t.Errorf("expected keys from each GitLab instance, got %q and %q", first, second)
+	}
+	entries, _ := os.ReadDir(filepath.Join(directory, "gitlab"))
+	if len(entries) != 2 {
+		t.Errorf("expected a cache directory per GitLab instance, got %d", len(entries))
+	}
+}
+
+func TestKeyCacheSkipsUnsafeUsernames(t *testing.T) {
+	directory := t.TempDir()
+	var calls int32
+	cache := NewKeyCache(directory, time.Hour, false, nil)
+	cache.Wrap(countingSources("ssh-ed25519 key", nil, &calls)).GitHub("../escape")
+
+	entries, _ := os.ReadDir(directory)
+	if len(entries) != 0 {
+		t.Errorf("unsafe username should not be cached, found %v", entries)
+	}
+}
+
+func TestDefaultKeyCacheDir(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", "/tmp/cache")
+	got, err := DefaultKeyCacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != filepath.Join("/tmp/cache", "goloo", "keys") {
+		t.Errorf("DefaultKeyCacheDir() = %q", got)
+	}
+}
+
+func TestFetchGitHubKeysContextTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	originalBaseURL := GitHubBaseURL
+	GitHubBaseURL = server.URL
+	defer func() { GitHubBaseURL = originalBaseURL }()
+
+	originalTimeout := KeyFetchTimeout
+	KeyFetchTimeout = 50 * time.Millisecond
+	defer func() { KeyFetchTimeout = originalTimeout }()
+
+	if _, err := FetchGitHubKeysContext(context.Background(), "slowuser"); err == nil {
+		t.Fatal("expected timeout error")
+	}
+}
+
+func TestProcessFetchesUsersInParallel(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "template.yaml")
+	os.WriteFile(templatePath, []byte("#cloud-config"), 0644)
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	sources := KeySources{
+		GitHub: func(username string) (string, error) {
+			started <- struct{}{}
+			<-release
+			return "ssh-ed25519 " + username, nil
+		},
+	}
+	go func() {
+		<-started
+		<-started
+		close(release)
+	}()
+
+	configuration := &config.Config{
+		VM: &config.VMConfig{
+			Users: []config.User{
+				{Username: "ubuntu", GitHubUsername: "alice"},
+				{Username: "admin", GitHubUsername: "bob"},
+			},
+		},
+	}
+	done := make(chan error, 1)
+	go func() {
+		resultPath, err := ProcessWithSources(templatePath, configuration, sources)
+		if err == nil {
+			os.Remove(resultPath)
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ProcessWithSources() returned error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("key fetches did not run in parallel")
+	}
+}
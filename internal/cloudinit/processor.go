@@ -4,13 +4,34 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/emergingrobotics/goloo/internal/config"
 )
 
 type KeyFetchFunc func(username string) (string, error)
 
+type KeySources struct {
+	GitHub  KeyFetchFunc
+	GitLab  func(baseURL, username string) (string, error)
+	KeyFile func(path string) (string, error)
+	Agent   func() (string, error)
+}
+
+func DefaultKeySources(fetchGitHub KeyFetchFunc) KeySources {
+	return KeySources{
+		GitHub:  fetchGitHub,
+		GitLab:  FetchGitLabKeys,
+		KeyFile: ReadKeyFile,
+		Agent:   FetchAgentKeys,
+	}
+}
+
 func Process(templatePath string, configuration *config.Config, fetchKeys KeyFetchFunc) (string, error) {
+	return ProcessWithSources(templatePath, configuration, DefaultKeySources(fetchKeys))
+}
+
+func ProcessWithSources(templatePath string, configuration *config.Config, sources KeySources) (string, error) {
 	content, err := os.ReadFile(templatePath)
 	if err != nil {
 		return "", fmt.Errorf("cloud-init template not found: %s", templatePath)
@@ -18,16 +39,9 @@ func Process(templatePath string, configuration *config.Config, fetchKeys KeyFet
 
 	users := getUsers(configuration)
 
-	keysPerUser := make(map[string]string)
-	for _, user := range users {
-		if user.GitHubUsername == "" {
-			continue
-		}
-		keys, err := fetchKeys(user.GitHubUsername)
-		if err != nil {
-			return "", err
-		}
-		keysPerUser[user.Username] = keys
+	keysPerUser, err := collectAllKeys(users, sources)
+	if err != nil {
+		return "", err
 	}
 
 	rendered := string(content)
@@ -42,6 +56,17 @@ func Process(templatePath string, configuration *config.Config, fetchKeys KeyFet
 
 	rendered = substituteVariables(rendered, users, keysPerUser)
 
+	if configuration != nil && configuration.VM != nil {
+		rendered, err = AddIdleStop(rendered, configuration.VM.IdleStop)
+		if err != nil {
+			return "", err
+		}
+		rendered, err = AddVolumeLinks(rendered, configuration.VM.Volumes)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	temporaryFile, err := os.CreateTemp("", "goloo-cloudinit-*.yaml")
 	if err != nil {
 		return "", fmt.Errorf("failed to create temp file: %w", err)
@@ -56,6 +81,78 @@ func Process(templatePath string, configuration *config.Config, fetchKeys KeyFet
 	return temporaryFile.Name(), nil
 }
 
+func collectAllKeys(users []config.User, sources KeySources) (map[string]string, error) {
+	keys := make([]string, len(users))
+	errs := make([]error, len(users))
+	var waitGroup sync.WaitGroup
+	for i, user := range users {
+		waitGroup.Add(1)
+		go func(i int, user config.User) {
+			defer waitGroup.Done()
+			keys[i], errs[i] = CollectKeys(user, sources)
+		}(i, user)
+	}
+	waitGroup.Wait()
+
+	keysPerUser := make(map[string]string)
+	for i, user := range users {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if keys[i] != "" {
+			keysPerUser[user.Username] = keys[i]
+		}
+	}
+	return keysPerUser, nil
+}
+
+func CollectKeys(user config.User, sources KeySources) (string, error) {
+	var collected []string
+	seen := make(map[string]bool)
+	add := func(keys string) {
+		for _, key := range splitKeys(keys) {
+			if !seen[key] {
+				seen[key] = true
+				collected = append(collected, key)
+			}
+		}
+	}
+
+	if user.GitHubUsername != "" {
+		keys, err := sources.GitHub(user.GitHubUsername)
+		if err != nil {
+			return "", err
+		}
+		add(keys)
+	}
+	if user.GitLabUsername != "" {
+		keys, err := sources.GitLab(user.GitLabURL, user.GitLabUsername)
+		if err != nil {
+			return "", err
+		}
+		add(keys)
+	}
+	for _, key := range user.SSHKeys {
+		add(key)
+	}
+	for _, path := range user.SSHKeyFiles {
+		keys, err := sources.KeyFile(path)
+		if err != nil {
+			return "", fmt.Errorf("user %q: %w", user.Username, err)
+		}
+		add(keys)
+	}
+	if user.SSHKeysFromAgent {
+		keys, err := sources.Agent()
+		if err != nil {
+			return "", fmt.Errorf("user %q: %w", user.Username, err)
+		}
+		add(keys)
+	}
+
+	return strings.Join(collected, "\n"), nil
+}
+
 func getUsers(configuration *config.Config) []config.User {
 	if configuration != nil && configuration.VM != nil {
 		return configuration.VM.Users
@@ -1,38 +1,142 @@
 package cloudinit
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"os/exec"
 	"strings"
+	"time"
+
+	"github.com/emergingrobotics/goloo/internal/config"
 )
 
 var GitHubBaseURL = "https://github.com"
 
+var GitLabBaseURL = "https://gitlab.com"
+
+var KeyFetchTimeout = 10 * time.Second
+
 func FetchGitHubKeys(username string) (string, error) {
+	return FetchGitHubKeysContext(context.Background(), username)
+}
+
+func FetchGitHubKeysContext(ctx context.Context, username string) (string, error) {
 	url := fmt.Sprintf("%s/%s.keys", GitHubBaseURL, username)
-	response, err := http.Get(url)
+	status, keys, err := getKeys(ctx, url)
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch SSH keys for %s: %w", username, err)
 	}
-	defer response.Body.Close()
 
-	if response.StatusCode == http.StatusNotFound {
+	if status == http.StatusNotFound {
 		return "", fmt.Errorf("no SSH keys found for GitHub user %q: verify username at github.com/%s.keys", username, username)
 	}
-	if response.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to fetch SSH keys for %s: HTTP %d", username, response.StatusCode)
+	if status != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch SSH keys for %s: HTTP %d", username, status)
+	}
+	if keys == "" {
+		return "", fmt.Errorf("no SSH keys found for GitHub user %q: add keys at github.com/settings/keys", username)
+	}
+
+	return keys, nil
+}
+
+func FetchGitLabKeys(baseURL, username string) (string, error) {
+	return FetchGitLabKeysContext(context.Background(), baseURL, username)
+}
+
+func FetchGitLabKeysContext(ctx context.Context, baseURL, username string) (string, error) {
+	if baseURL == "" {
+		baseURL = GitLabBaseURL
+	}
+	url := fmt.Sprintf("%s/%s.keys", strings.TrimRight(baseURL, "/"), username)
+	status, keys, err := getKeys(ctx, url)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch SSH keys for GitLab user %s: %w", username, err)
+	}
+
+	if status == http.StatusNotFound {
+		return "", fmt.Errorf("no SSH keys found for GitLab user %q: verify username at %s", username, url)
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch SSH keys for GitLab user %s: HTTP %d", username, status)
+	}
+	if keys == "" {
+		return "", fmt.Errorf("no SSH keys found for GitLab user %q at %s", username, baseURL)
+	}
+
+	return keys, nil
+}
+
+func NetworkKeySources(ctx context.Context) KeySources {
+	return KeySources{
+		GitHub: func(username string) (string, error) {
+			return FetchGitHubKeysContext(ctx, username)
+		},
+		GitLab: func(baseURL, username string) (string, error) {
+			return FetchGitLabKeysContext(ctx, baseURL, username)
+		},
+		KeyFile: ReadKeyFile,
+		Agent:   FetchAgentKeys,
+	}
+}
+
+func getKeys(ctx context.Context, url string) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, KeyFetchTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return 0, "", err
 	}
+	defer response.Body.Close()
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read SSH keys for %s: %w", username, err)
+		return response.StatusCode, "", err
 	}
+	return response.StatusCode, strings.TrimSpace(string(body)), nil
+}
 
-	keys := strings.TrimSpace(string(body))
+func ReadKeyFile(path string) (string, error) {
+	expanded, err := config.ExpandHome(path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(expanded)
+	if err != nil {
+		return "", fmt.Errorf("failed to read SSH key file %s: %w", path, err)
+	}
+	keys := strings.TrimSpace(string(data))
 	if keys == "" {
-		return "", fmt.Errorf("no SSH keys found for GitHub user %q: add keys at github.com/settings/keys", username)
+		return "", fmt.Errorf("SSH key file %s is empty", path)
+	}
+	if strings.Contains(keys, "PRIVATE KEY") {
+		return "", fmt.Errorf("SSH key file %s contains a private key: use the .pub file", path)
 	}
+	return keys, nil
+}
 
+func FetchAgentKeys() (string, error) {
+	if os.Getenv("SSH_AUTH_SOCK") == "" {
+		return "", fmt.Errorf("cannot read keys from ssh-agent: SSH_AUTH_SOCK is not set")
+	}
+	output, err := exec.Command("ssh-add", "-L").Output()
+	keys := strings.TrimSpace(string(output))
+	if err != nil {
+		if keys != "" {
+			return "", fmt.Errorf("ssh-agent: %s", keys)
+		}
+		return "", fmt.Errorf("failed to list ssh-agent keys: %w", err)
+	}
+	if keys == "" {
+		return "", fmt.Errorf("ssh-agent has no identities: add one with ssh-add")
+	}
 	return keys, nil
 }
@@ -12,9 +12,16 @@ import (
 type TemplateUser struct {
 	Username       string
 	GithubUsername string
+	GitlabUsername string
 	SSHKeys        []string
 }
 
+type TemplateVolume struct {
+	Device     string
+	MountPoint string
+	Size       string
+}
+
 type TemplateData struct {
 	Name         string
 	CPUs         int
@@ -35,7 +42,8 @@ type TemplateData struct {
 	Packages   []string
 	WorkingDir string
 
-	Users []TemplateUser
+	Users   []TemplateUser
+	Volumes []TemplateVolume
 
 	Vars map[string]interface{}
 }
@@ -59,6 +67,7 @@ func buildTemplateData(configuration *config.Config, keysPerUser map[string]stri
 			templateUser := TemplateUser{
 				Username:       user.Username,
 				GithubUsername: user.GitHubUsername,
+				GitlabUsername: user.GitLabUsername,
 			}
 			if keys, exists := keysPerUser[user.Username]; exists {
 				for _, key := range strings.Split(keys, "\n") {
@@ -70,6 +79,14 @@ func buildTemplateData(configuration *config.Config, keysPerUser map[string]stri
 			}
 			data.Users = append(data.Users, templateUser)
 		}
+
+		for i, device := range config.VolumeDevices(configuration.VM.Volumes) {
+			data.Volumes = append(data.Volumes, TemplateVolume{
+				Device:     device,
+				MountPoint: configuration.VM.Volumes[i].MountPoint,
+				Size:       configuration.VM.Volumes[i].Size,
+			})
+		}
 	}
 
 	if configuration.DNS != nil {
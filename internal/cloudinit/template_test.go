@@ -418,3 +418,34 @@ func TestProcessWithCNAMEAliasesTemplate(t *testing.T) {
 		t.Error("Result should contain api CNAME alias")
 	}
 }
+
+func TestBuildTemplateDataVolumes(t *testing.T) {
+	configuration := &config.Config{
+		VM: &config.VMConfig{
+			Name: "devbox",
+			Volumes: []config.Volume{
+				{Size: "100G", MountPoint: "/data"},
+				{Size: "50G", Device: "/dev/sdf"},
+			},
+		},
+	}
+	data := buildTemplateData(configuration, map[string]string{})
+
+	if len(data.Volumes) != 2 {
+		t.Fatalf("Volumes length = %d, want 2", len(data.Volumes))
+	}
+	if data.Volumes[0].Device != "/dev/sdg" || data.Volumes[0].MountPoint != "/data" || data.Volumes[0].Size != "100G" {
+		t.Errorf("Volumes[0] = %+v, want /dev/sdg mounted at /data", data.Volumes[0])
+	}
+	if data.Volumes[1].Device != "/dev/sdf" {
+		t.Errorf("Volumes[1].Device = %q, want %q", data.Volumes[1].Device, "/dev/sdf")
+	}
+
+	result, err := renderGoTemplate("{{range .Volumes}}{{if .MountPoint}}- [{{.Device}}, {{.MountPoint}}]\n{{end}}{{end}}", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "- [/dev/sdg, /data]\n" {
+		t.Errorf("rendered mounts = %q", result)
+	}
+}
@@ -0,0 +1,95 @@
+package cloudinit
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EBSNamePath      = "/usr/local/sbin/goloo-ebs-name"
+	ebsUdevRulesPath = "/etc/udev/rules.d/70-goloo-ebs.rules"
+)
+
+const ebsNameScript = `#!/usr/bin/env python3
+# Installed by goloo (vm.volumes): print the EC2 device name of an EBS NVMe disk.
+import ctypes
+import fcntl
+import struct
+import sys
+
+NVME_IOCTL_ADMIN_CMD = 0xC0484E41
+NVME_ADMIN_IDENTIFY = 0x06
+
+data = ctypes.create_string_buffer(4096)
+command = bytearray(struct.pack(
+    "<BBHIIIQQII6III",
+    NVME_ADMIN_IDENTIFY, 0, 0, 0, 0, 0, 0, ctypes.addressof(data), 0, len(data),
+    1, 0, 0, 0, 0, 0, 0, 0,
+))
+with open(sys.argv[1], "rb") as device:
+    fcntl.ioctl(device, NVME_IOCTL_ADMIN_CMD, command)
+name = data.raw[3072:3104].decode("ascii", "ignore").strip(" \x00")
+print(name[len("/dev/"):] if name.startswith("/dev/") else name)
+`
+
+const ebsUdevRules = `# Installed by goloo (vm.volumes): link EBS NVMe disks to their EC2 device names.
+KERNEL=="nvme[0-9]*n[0-9]*", ENV{DEVTYPE}=="disk", ATTRS{model}=="Amazon Elastic Block Store", PROGRAM="` + EBSNamePath + ` /dev/%k", SYMLINK+="%c"
+`
+
+func AddVolumeLinks(content string, volumes []config.Volume) (string, error) {
+	if len(volumes) == 0 || !strings.HasPrefix(strings.TrimLeft(content, " \t\r\n"), cloudConfigHeader) {
+		return content, nil
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil {
+		return "", fmt.Errorf("vm.volumes: failed to parse cloud-init: %w", err)
+	}
+	if len(document.Content) == 0 {
+		document = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return "", fmt.Errorf("vm.volumes: cloud-init must be a YAML mapping")
+	}
+
+	commands := [][]string{
+		{"sh", "-c", `printf '%s' "$1" > ` + EBSNamePath + ` && chmod 0755 ` + EBSNamePath, "goloo-ebs-name", ebsNameScript},
+		{"sh", "-c", `printf '%s' "$1" > ` + ebsUdevRulesPath, "goloo-ebs-rules", ebsUdevRules},
+		{"udevadm", "control", "--reload-rules"},
+		{"udevadm", "trigger", "--subsystem-match=block", "--action=add"},
+		{"udevadm", "settle"},
+	}
+	var items yaml.Node
+	if err := items.Encode(commands); err != nil {
+		return "", fmt.Errorf("vm.volumes: failed to encode bootcmd: %w", err)
+	}
+	appended := false
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "bootcmd" {
+			continue
+		}
+		if root.Content[i+1].Kind != yaml.SequenceNode {
+			return "", fmt.Errorf("vm.volumes: cloud-init bootcmd must be a list")
+		}
+		root.Content[i+1].Content = append(root.Content[i+1].Content, items.Content...)
+		appended = true
+		break
+	}
+	if !appended {
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "bootcmd"}, &items)
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return "", fmt.Errorf("vm.volumes: failed to render cloud-init: %w", err)
+	}
+	encoder.Close()
+	return cloudConfigHeader + "\n" + strings.TrimPrefix(buffer.String(), cloudConfigHeader+"\n"), nil
+}
@@ -0,0 +1,84 @@
+package cloudinit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+func TestAddVolumeLinksMergesIntoBootcmd(t *testing.T) {
+	content := "#cloud-config\nbootcmd:\n  - echo early\nfs_setup:\n  - device: /dev/sdf\n    filesystem: ext4\n"
+	volumes := []config.Volume{{Size: "100G", MountPoint: "/data"}}
+
+	result, err := AddVolumeLinks(content, volumes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed struct {
+		BootCmd []interface{} `yaml:"bootcmd"`
+		FSSetup []interface{} `yaml:"fs_setup"`
+	}
+	if err := yaml.Unmarshal([]byte(result), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.BootCmd) != 6 || parsed.BootCmd[0] != "echo early" {
+		t.Fatalf("expected the user's bootcmd first plus five link commands, got %v", parsed.BootCmd)
+	}
+	if len(parsed.FSSetup) != 1 {
+		t.Errorf("expected fs_setup to be kept, got %v", parsed.FSSetup)
+	}
+	if !strings.Contains(result, EBSNamePath) || !strings.Contains(result, "Amazon Elastic Block Store") {
+		t.Errorf("expected the EBS udev helper and rule, got:\n%s", result)
+	}
+}
+
+func TestAddVolumeLinksUnchanged(t *testing.T) {
+	for _, test := range []struct {
+		content string
+		volumes []config.Volume
+	}{
+		{"#cloud-config\npackages:\n  - git\n", nil},
+		{"#!/bin/sh\necho hello\n", []config.Volume{{Size: "100G"}}},
+	} {
+		result, err := AddVolumeLinks(test.content, test.volumes)
+		if err != nil || result != test.content {
+			t.Errorf("AddVolumeLinks(%q) = %q, %v; want content unchanged", test.content, result, err)
+		}
+	}
+}
+
+func TestAddVolumeLinksErrors(t *testing.T) {
+	volumes := []config.Volume{{Size: "100G"}}
+	for _, content := range []string{
+		"#cloud-config\n- not a mapping\n",
+		"#cloud-config\nbootcmd: echo hello\n",
+	} {
+		if _, err := AddVolumeLinks(content, volumes); err == nil {
+			t.Errorf("AddVolumeLinks(%q) should return error", content)
+		}
+	}
+}
+
+func TestProcessInjectsVolumeLinks(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "cloud-init.yaml")
+	os.WriteFile(templatePath, []byte("#cloud-config\nmounts:\n{{- range .Volumes}}\n  - [{{.Device}}, {{.MountPoint}}]\n{{- end}}\n"), 0644)
+	configuration := &config.Config{
+		VM: &config.VMConfig{
+			Volumes: []config.Volume{{Size: "100G", Device: "/dev/sdf", MountPoint: "/data"}},
+		},
+	}
+
+	resultPath, err := Process(templatePath, configuration, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(resultPath)
+	data, _ := os.ReadFile(resultPath)
+	if !strings.Contains(string(data), "/dev/sdf") || !strings.Contains(string(data), EBSNamePath) {
+		t.Errorf("expected the mount and the EBS links in processed cloud-init, got:\n%s", data)
+	}
+}
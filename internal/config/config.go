@@ -1,11 +1,17 @@
 package config
 
+import "time"
+
 type Config struct {
-	VM        *VMConfig        `json:"vm,omitempty"`
-	DNS       *DNSConfig       `json:"dns,omitempty"`
-	CloudInit *CloudInitConfig `json:"cloud_init,omitempty"`
-	Local     *LocalState      `json:"local,omitempty"`
-	AWS       *AWSState        `json:"aws,omitempty"`
+	VM        *VMConfig         `json:"vm,omitempty"`
+	DNS       *DNSConfig        `json:"dns,omitempty"`
+	CloudInit *CloudInitConfig  `json:"cloud_init,omitempty"`
+	SSH       *SSHConfig        `json:"ssh,omitempty"`
+	Hosts     *HostsConfig      `json:"hosts,omitempty"`
+	Firewall  []FirewallRule    `json:"firewall,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Local     *LocalState       `json:"local,omitempty"`
+	AWS       *AWSState         `json:"aws,omitempty"`
 }
 
 type CloudInitConfig struct {
@@ -23,11 +29,50 @@ type VMConfig struct {
 	Image  string  `json:"image,omitempty"`
 	Mounts []Mount `json:"mounts,omitempty"`
 
+	TTL       string          `json:"ttl,omitempty"`
+	TTLAction string          `json:"ttl_action,omitempty"`
+	IdleStop  *IdleStopConfig `json:"idle_stop,omitempty"`
+
 	InstanceType string `json:"instance_type,omitempty"`
 	OS           string `json:"os,omitempty"`
 	Region       string `json:"region,omitempty"`
 	VpcID        string `json:"vpc_id,omitempty"`
 	SubnetID     string `json:"subnet_id,omitempty"`
+
+	ElasticIP             bool   `json:"elastic_ip,omitempty"`
+	ElasticIPAllocationID string `json:"elastic_ip_allocation_id,omitempty"`
+
+	DiskType      string   `json:"disk_type,omitempty"`
+	DiskIOPS      int      `json:"disk_iops,omitempty"`
+	DiskEncrypted bool     `json:"disk_encrypted,omitempty"`
+	Volumes       []Volume `json:"volumes,omitempty"`
+
+	IAM  *IAMConfig  `json:"iam,omitempty"`
+	Spot *SpotConfig `json:"spot,omitempty"`
+}
+
+type IdleStopConfig struct {
+	Minutes    int `json:"minutes,omitempty"`
+	CPUPercent int `json:"cpu_percent,omitempty"`
+}
+
+type SpotConfig struct {
+	MaxPrice             string `json:"max_price,omitempty"`
+	InterruptionBehavior string `json:"interruption_behavior,omitempty"`
+}
+
+type IAMConfig struct {
+	InstanceProfile string   `json:"instance_profile,omitempty"`
+	ManagedPolicies []string `json:"managed_policies,omitempty"`
+}
+
+type Volume struct {
+	Size       string `json:"size"`
+	Type       string `json:"type,omitempty"`
+	IOPS       int    `json:"iops,omitempty"`
+	Encrypted  bool   `json:"encrypted,omitempty"`
+	Device     string `json:"device,omitempty"`
+	MountPoint string `json:"mount_point,omitempty"`
 }
 
 type DNSConfig struct {
@@ -37,11 +82,42 @@ type DNSConfig struct {
 	IsApexDomain bool     `json:"is_apex_domain,omitempty"`
 	CNAMEAliases []string `json:"cname_aliases,omitempty"`
 	ZoneID       string   `json:"zone_id,omitempty"`
+	LocalOnly    bool     `json:"local_only,omitempty"`
+}
+
+type SSHConfig struct {
+	User           string            `json:"user,omitempty"`
+	IdentityFile   string            `json:"identity_file,omitempty"`
+	Port           int               `json:"port,omitempty"`
+	ProxyJump      string            `json:"proxy_jump,omitempty"`
+	LocalForwards  []string          `json:"local_forwards,omitempty"`
+	RemoteForwards []string          `json:"remote_forwards,omitempty"`
+	Options        map[string]string `json:"options,omitempty"`
+	ExtraArgs      []string          `json:"extra_args,omitempty"`
+}
+
+type FirewallRule struct {
+	Protocol    string `json:"protocol,omitempty"`
+	Port        int    `json:"port,omitempty"`
+	ToPort      int    `json:"to_port,omitempty"`
+	CIDR        string `json:"cidr,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type HostsConfig struct {
+	Backend string `json:"backend,omitempty"`
+	File    string `json:"file,omitempty"`
+}
+
+type HostsState struct {
+	HostsEntry   bool   `json:"hosts_entry,omitempty"`
+	HostsBackend string `json:"hosts_backend,omitempty"`
+	HostsFile    string `json:"hosts_file,omitempty"`
 }
 
 type LocalState struct {
-	IP         string `json:"ip,omitempty"`
-	HostsEntry bool   `json:"hosts_entry,omitempty"`
+	IP string `json:"ip,omitempty"`
+	HostsState
 }
 
 type AWSState struct {
@@ -49,6 +125,7 @@ type AWSState struct {
 	InstanceID            string      `json:"instance_id,omitempty"`
 	StackID               string      `json:"stack_id,omitempty"`
 	StackName             string      `json:"stack_name,omitempty"`
+	Region                string      `json:"region,omitempty"`
 	SecurityGroup         string      `json:"security_group,omitempty"`
 	AMIID                 string      `json:"ami_id,omitempty"`
 	VpcID                 string      `json:"vpc_id,omitempty"`
@@ -61,11 +138,33 @@ type AWSState struct {
 	ZoneID                string      `json:"zone_id,omitempty"`
 	FQDN                  string      `json:"fqdn,omitempty"`
 	DNSRecords            []DNSRecord `json:"dns_records,omitempty"`
+	ElasticIPAllocationID string      `json:"elastic_ip_allocation_id,omitempty"`
+	CreatedElasticIP      bool        `json:"created_elastic_ip,omitempty"`
+	InstanceProfile       string      `json:"instance_profile,omitempty"`
+	Spot                  bool        `json:"spot,omitempty"`
+	HostsState
+}
+
+type Snapshot struct {
+	Name        string    `json:"name"`
+	ID          string    `json:"id"`
+	SnapshotIDs []string  `json:"snapshot_ids,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 type User struct {
-	Username       string `json:"username"`
-	GitHubUsername string `json:"github_username"`
+	Username         string   `json:"username"`
+	GitHubUsername   string   `json:"github_username,omitempty"`
+	GitLabUsername   string   `json:"gitlab_username,omitempty"`
+	GitLabURL        string   `json:"gitlab_url,omitempty"`
+	SSHKeys          []string `json:"ssh_keys,omitempty"`
+	SSHKeyFiles      []string `json:"ssh_key_files,omitempty"`
+	SSHKeysFromAgent bool     `json:"ssh_keys_from_agent,omitempty"`
+}
+
+func (u User) HasKeySource() bool {
+	return u.GitHubUsername != "" || u.GitLabUsername != "" || len(u.SSHKeys) > 0 ||
+		len(u.SSHKeyFiles) > 0 || u.SSHKeysFromAgent
 }
 
 type Mount struct {
@@ -4,13 +4,45 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TTLActionStop    = "stop"
+	TTLActionDestroy = "destroy"
+)
+
+const (
+	DefaultIdleMinutes    = 30
+	DefaultIdleCPUPercent = 5
+	DefaultRegion         = "us-east-1"
 )
 
 var validUsernamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
 
+var elasticIPAllocationPattern = regexp.MustCompile(`^eipalloc-[0-9a-f]+$`)
+
+var instanceProfileNamePattern = regexp.MustCompile(`^[\w+=,.@-]{1,128}$`)
+
+var instanceProfileARNPattern = regexp.MustCompile(`^arn:aws[a-z-]*:iam::[0-9]{12}:instance-profile/([\w+=,.@-]+/)*[\w+=,.@-]{1,128}$`)
+
+var managedPolicyARNPattern = regexp.MustCompile(`^arn:aws[a-z-]*:iam::(aws|[0-9]{12}):policy/([\w+=,.@-]+/)*[\w+=,.@-]{1,128}$`)
+
+var volumeDevicePattern = regexp.MustCompile(`^/dev/(sd|xvd)[f-p]$`)
+
+var sizePattern = regexp.MustCompile(`(?i)^([0-9]+(?:\.[0-9]+)?)(?:([KMGT])(?:i?B)?|B)?$`)
+
+var snapshotNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9-]{0,62}$`)
+
+var volumeDeviceLetters = "fghijklmnop"
+
 func ResolveFolder(folder string, name string) string {
 	return filepath.Join(folder, name)
 }
@@ -69,11 +101,22 @@ func ApplyDefaults(configuration *Config) {
 	if configuration.VM.Disk == "" {
 		configuration.VM.Disk = "20G"
 	}
+	if idle := configuration.VM.IdleStop; idle != nil {
+		if idle.Minutes == 0 {
+			idle.Minutes = DefaultIdleMinutes
+		}
+		if idle.CPUPercent == 0 {
+			idle.CPUPercent = DefaultIdleCPUPercent
+		}
+	}
+	for i, device := range VolumeDevices(configuration.VM.Volumes) {
+		configuration.VM.Volumes[i].Device = device
+	}
 	if configuration.VM.Image == "" {
 		configuration.VM.Image = "24.04"
 	}
 	if configuration.VM.Region == "" {
-		configuration.VM.Region = "us-east-1"
+		configuration.VM.Region = DefaultRegion
 	}
 	if configuration.VM.InstanceType == "" {
 		configuration.VM.InstanceType = "t3.micro"
@@ -158,6 +201,38 @@ func Validate(configuration *Config) error {
 		return fmt.Errorf("config missing required field: vm.users (at least one user required)")
 	}
 
+	if configuration.VM.ElasticIPAllocationID != "" && !elasticIPAllocationPattern.MatchString(configuration.VM.ElasticIPAllocationID) {
+		return fmt.Errorf("invalid vm.elastic_ip_allocation_id %q: expected an ID like eipalloc-0123456789abcdef0", configuration.VM.ElasticIPAllocationID)
+	}
+
+	if configuration.VM.TTL != "" {
+		ttl, err := ParseDuration(configuration.VM.TTL)
+		if err != nil {
+			return fmt.Errorf("invalid vm.ttl: %w", err)
+		}
+		if ttl == 0 {
+			return fmt.Errorf("invalid vm.ttl %q: must be greater than zero", configuration.VM.TTL)
+		}
+	}
+	switch configuration.VM.TTLAction {
+	case "", TTLActionStop, TTLActionDestroy:
+	default:
+		return fmt.Errorf("invalid vm.ttl_action %q: must be stop or destroy", configuration.VM.TTLAction)
+	}
+
+	if err := validateDisk(configuration.VM); err != nil {
+		return err
+	}
+	if err := validateIAM(configuration.VM.IAM); err != nil {
+		return err
+	}
+	if err := validateSpot(configuration.VM); err != nil {
+		return err
+	}
+	if err := validateIdleStop(configuration.VM.IdleStop); err != nil {
+		return err
+	}
+
 	seen := make(map[string]bool)
 	for _, user := range configuration.VM.Users {
 		if user.Username == "" {
@@ -166,8 +241,11 @@ func Validate(configuration *Config) error {
 		if !validUsernamePattern.MatchString(user.Username) {
 			return fmt.Errorf("invalid username %q: must start with a lowercase letter and contain only lowercase letters, numbers, hyphens, underscores", user.Username)
 		}
-		if user.GitHubUsername == "" {
-			return fmt.Errorf("user %q missing required field: github_username", user.Username)
+		if !user.HasKeySource() {
+			return fmt.Errorf("user %q has no SSH key source: set github_username, gitlab_username, ssh_keys, ssh_key_files or ssh_keys_from_agent", user.Username)
+		}
+		if user.GitLabURL != "" && user.GitLabUsername == "" {
+			return fmt.Errorf("user %q: gitlab_url requires gitlab_username", user.Username)
 		}
 		if seen[user.Username] {
 			return fmt.Errorf("duplicate username %q", user.Username)
@@ -175,6 +253,48 @@ func Validate(configuration *Config) error {
 		seen[user.Username] = true
 	}
 
+	if configuration.SSH != nil {
+		if configuration.SSH.Port < 0 || configuration.SSH.Port > 65535 {
+			return fmt.Errorf("invalid ssh.port %d: must be between 1 and 65535", configuration.SSH.Port)
+		}
+		if configuration.SSH.User != "" && !validUsernamePattern.MatchString(configuration.SSH.User) {
+			return fmt.Errorf("invalid ssh.user %q: must start with a lowercase letter and contain only lowercase letters, numbers, hyphens, underscores", configuration.SSH.User)
+		}
+		for _, forward := range append(append([]string{}, configuration.SSH.LocalForwards...), configuration.SSH.RemoteForwards...) {
+			if forward == "" || strings.HasPrefix(forward, "-") {
+				return fmt.Errorf("invalid ssh forward %q: use [bind_address:]port:host:hostport", forward)
+			}
+		}
+		for key := range configuration.SSH.Options {
+			if key == "" || strings.ContainsAny(key, "= \t") {
+				return fmt.Errorf("invalid ssh option name %q", key)
+			}
+		}
+	}
+
+	for key, value := range configuration.Tags {
+		if key == "" || len(key) > 128 || len(value) > 256 {
+			return fmt.Errorf("invalid tag %q: keys must be 1-128 characters and values at most 256", key)
+		}
+		if strings.HasPrefix(strings.ToLower(key), "aws:") || strings.HasPrefix(key, "goloo:") {
+			return fmt.Errorf("invalid tag %q: the aws: and goloo: prefixes are reserved", key)
+		}
+	}
+
+	for _, rule := range configuration.Firewall {
+		if err := ValidateFirewallRule(rule); err != nil {
+			return err
+		}
+	}
+
+	if configuration.Hosts != nil {
+		switch configuration.Hosts.Backend {
+		case "", "etc-hosts", "dnsmasq":
+		default:
+			return fmt.Errorf("invalid hosts.backend %q: must be etc-hosts or dnsmasq", configuration.Hosts.Backend)
+		}
+	}
+
 	if configuration.DNS != nil {
 		if len(configuration.DNS.CNAMEAliases) > 0 && configuration.DNS.Domain == "" {
 			return fmt.Errorf("dns.cname_aliases requires dns.domain")
@@ -182,7 +302,259 @@ func Validate(configuration *Config) error {
 		if configuration.DNS.IsApexDomain && configuration.DNS.Domain == "" {
 			return fmt.Errorf("dns.is_apex_domain requires dns.domain")
 		}
+		if configuration.DNS.LocalOnly && (len(configuration.DNS.CNAMEAliases) > 0 || configuration.DNS.IsApexDomain || configuration.DNS.ZoneID != "") {
+			return fmt.Errorf("dns.local_only cannot be combined with Route53 settings: cname_aliases, is_apex_domain or zone_id")
+		}
+	}
+
+	return nil
+}
+
+func ValidateForProvider(configuration *Config, providerName string) error {
+	if providerName == "aws" || configuration.VM == nil {
+		return nil
+	}
+	vm := configuration.VM
+	field := ""
+	switch {
+	case len(vm.Volumes) > 0:
+		field = "vm.volumes"
+	case vm.DiskType != "":
+		field = "vm.disk_type"
+	case vm.DiskIOPS != 0:
+		field = "vm.disk_iops"
+	case vm.DiskEncrypted:
+		field = "vm.disk_encrypted"
+	default:
+		return nil
 	}
+	return fmt.Errorf("%s is only supported on AWS: remove it or create with --aws", field)
+}
 
+func ValidateSnapshotName(name string) error {
+	if !snapshotNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid snapshot name %q: must start with a letter and contain only letters, numbers and hyphens", name)
+	}
 	return nil
 }
+
+func ValidateFirewallRule(rule FirewallRule) error {
+	switch rule.Protocol {
+	case "", "tcp", "udp":
+		if rule.Port < 1 || rule.Port > 65535 {
+			return fmt.Errorf("invalid firewall port %d: must be between 1 and 65535", rule.Port)
+		}
+		if rule.ToPort != 0 && (rule.ToPort < rule.Port || rule.ToPort > 65535) {
+			return fmt.Errorf("invalid firewall to_port %d: must be between port %d and 65535", rule.ToPort, rule.Port)
+		}
+	case "icmp", "all":
+		if rule.Port != 0 || rule.ToPort != 0 {
+			return fmt.Errorf("firewall protocol %s covers every port: remove port and to_port", rule.Protocol)
+		}
+	default:
+		return fmt.Errorf("invalid firewall protocol %q: must be tcp, udp, icmp or all", rule.Protocol)
+	}
+	if rule.CIDR != "" && rule.CIDR != "my-ip" {
+		if _, _, err := net.ParseCIDR(rule.CIDR); err != nil {
+			return fmt.Errorf("invalid firewall cidr %q: use a CIDR like 203.0.113.0/24 or \"my-ip\"", rule.CIDR)
+		}
+	}
+	if len(rule.Description) > 255 || strings.ContainsAny(rule.Description, "\"\n\r") {
+		return fmt.Errorf("invalid firewall description %q: must be a single line of at most 255 characters without quotes", rule.Description)
+	}
+	return nil
+}
+
+func validateDisk(vm *VMConfig) error {
+	if vm.Disk != "" {
+		if _, err := ParseSizeGiB(vm.Disk); err != nil {
+			return fmt.Errorf("invalid vm.disk: %w", err)
+		}
+	}
+	if err := validateVolumeType("vm.disk_type", vm.DiskType, vm.DiskIOPS); err != nil {
+		return err
+	}
+
+	if len(vm.Volumes) > len(volumeDeviceLetters) {
+		return fmt.Errorf("too many vm.volumes: at most %d are supported", len(volumeDeviceLetters))
+	}
+	devices := make(map[byte]bool)
+	mountPoints := make(map[string]bool)
+	for i, volume := range vm.Volumes {
+		field := fmt.Sprintf("vm.volumes[%d]", i)
+		if volume.Size == "" {
+			return fmt.Errorf("%s missing required field: size", field)
+		}
+		if _, err := ParseSizeGiB(volume.Size); err != nil {
+			return fmt.Errorf("invalid %s.size: %w", field, err)
+		}
+		if err := validateVolumeType(field+".type", volume.Type, volume.IOPS); err != nil {
+			return err
+		}
+		if volume.Device != "" {
+			if !volumeDevicePattern.MatchString(volume.Device) {
+				return fmt.Errorf("invalid %s.device %q: use /dev/sdf through /dev/sdp", field, volume.Device)
+			}
+			letter := volume.Device[len(volume.Device)-1]
+			if devices[letter] {
+				return fmt.Errorf("duplicate volume device %q", volume.Device)
+			}
+			devices[letter] = true
+		}
+		if volume.MountPoint != "" {
+			if !filepath.IsAbs(volume.MountPoint) || strings.ContainsAny(volume.MountPoint, " \t\n") {
+				return fmt.Errorf("invalid %s.mount_point %q: must be an absolute path without spaces", field, volume.MountPoint)
+			}
+			if mountPoints[volume.MountPoint] {
+				return fmt.Errorf("duplicate volume mount_point %q", volume.MountPoint)
+			}
+			mountPoints[volume.MountPoint] = true
+		}
+	}
+	return nil
+}
+
+func validateIAM(iam *IAMConfig) error {
+	if iam == nil {
+		return nil
+	}
+	if iam.InstanceProfile != "" && len(iam.ManagedPolicies) > 0 {
+		return fmt.Errorf("vm.iam: set either instance_profile or managed_policies, not both")
+	}
+	if iam.InstanceProfile == "" && len(iam.ManagedPolicies) == 0 {
+		return fmt.Errorf("vm.iam: set instance_profile or managed_policies")
+	}
+	if iam.InstanceProfile != "" && !instanceProfileNamePattern.MatchString(iam.InstanceProfile) && !instanceProfileARNPattern.MatchString(iam.InstanceProfile) {
+		return fmt.Errorf("invalid vm.iam.instance_profile %q: use a profile name or arn:aws:iam::<account>:instance-profile/<name>", iam.InstanceProfile)
+	}
+	for _, policy := range iam.ManagedPolicies {
+		if !managedPolicyARNPattern.MatchString(policy) {
+			return fmt.Errorf("invalid vm.iam.managed_policies entry %q: use a policy ARN like arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess", policy)
+		}
+	}
+	return nil
+}
+
+func validateSpot(vm *VMConfig) error {
+	if vm.Spot == nil {
+		return nil
+	}
+	if vm.Spot.MaxPrice != "" {
+		price, err := strconv.ParseFloat(vm.Spot.MaxPrice, 64)
+		if err != nil || price <= 0 {
+			return fmt.Errorf("invalid vm.spot.max_price %q: use an hourly USD price like \"0.05\"", vm.Spot.MaxPrice)
+		}
+	}
+	switch vm.Spot.InterruptionBehavior {
+	case "", "stop", "terminate":
+	case "hibernate":
+		if !vm.DiskEncrypted {
+			return fmt.Errorf("vm.spot.interruption_behavior hibernate requires vm.disk_encrypted")
+		}
+	default:
+		return fmt.Errorf("invalid vm.spot.interruption_behavior %q: must be stop, hibernate or terminate", vm.Spot.InterruptionBehavior)
+	}
+	return nil
+}
+
+func validateIdleStop(idle *IdleStopConfig) error {
+	if idle == nil {
+		return nil
+	}
+	if idle.Minutes < 0 {
+		return fmt.Errorf("invalid vm.idle_stop.minutes %d: must be positive", idle.Minutes)
+	}
+	if idle.CPUPercent < 0 || idle.CPUPercent > 100 {
+		return fmt.Errorf("invalid vm.idle_stop.cpu_percent %d: must be between 1 and 100", idle.CPUPercent)
+	}
+	return nil
+}
+
+func validateVolumeType(field, volumeType string, iops int) error {
+	if iops < 0 {
+		return fmt.Errorf("invalid %s iops %d: must be positive", field, iops)
+	}
+	switch volumeType {
+	case "", "gp3":
+	case "gp2":
+		if iops != 0 {
+			return fmt.Errorf("%s gp2 does not take iops: use gp3 or io2 for provisioned IOPS", field)
+		}
+	case "io1", "io2":
+		if iops == 0 {
+			return fmt.Errorf("%s %s requires iops", field, volumeType)
+		}
+	default:
+		return fmt.Errorf("invalid %s %q: must be gp3, gp2, io1 or io2", field, volumeType)
+	}
+	return nil
+}
+
+func VolumeDevices(volumes []Volume) []string {
+	used := make(map[byte]bool)
+	for _, volume := range volumes {
+		if volume.Device != "" {
+			used[volume.Device[len(volume.Device)-1]] = true
+		}
+	}
+	devices := make([]string, len(volumes))
+	next := 0
+	for i, volume := range volumes {
+		if volume.Device != "" {
+			devices[i] = volume.Device
+			continue
+		}
+		for next < len(volumeDeviceLetters) {
+			letter := volumeDeviceLetters[next]
+			next++
+			if !used[letter] {
+				devices[i] = "/dev/sd" + string(letter)
+				break
+			}
+		}
+	}
+	return devices
+}
+
+func ParseSizeGiB(size string) (int, error) {
+	match := sizePattern.FindStringSubmatch(strings.TrimSpace(size))
+	if match == nil {
+		return 0, fmt.Errorf("invalid size %q: use a number with a unit like 20G or 1T", size)
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil || value == 0 {
+		return 0, fmt.Errorf("invalid size %q: must be greater than zero", size)
+	}
+	exponent := 0
+	if match[2] != "" {
+		exponent = strings.Index("KMGT", strings.ToUpper(match[2])) + 1
+	}
+	gib := value * math.Pow(1024, float64(exponent-3))
+	return int(math.Ceil(gib)), nil
+}
+
+func ExpandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot expand %s: %w", path, err)
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
+func ParseDuration(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid duration %q: use a number of days like 30d or a Go duration like 8h", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid duration %q: use a number of days like 30d or a Go duration like 8h", value)
+	}
+	return duration, nil
+}
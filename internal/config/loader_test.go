@@ -4,7 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestResolveFolderJoinsComponents(t *testing.T) {
@@ -83,6 +85,29 @@ func TestLoadValidConfig(t *testing.T) {
 	}
 }
 
+func TestLoadLocalConfigWithMultipassDiskSize(t *testing.T) {
+	directory := t.TempDir()
+	vmDirectory := filepath.Join(directory, "devbox")
+	os.MkdirAll(vmDirectory, 0755)
+
+	configJSON := `{
+  "vm": {
+    "name": "devbox",
+    "disk": "20g",
+    "users": [{"username": "ubuntu", "github_username": "gherlein"}]
+  }
+}`
+	os.WriteFile(filepath.Join(vmDirectory, "config.json"), []byte(configJSON), 0644)
+
+	configuration, _, err := Load(directory, "devbox")
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if configuration.VM.Disk != "20g" {
+		t.Errorf("VM.Disk = %q, want %q", configuration.VM.Disk, "20g")
+	}
+}
+
 func TestLoadConfigFolderNotFound(t *testing.T) {
 	_, _, err := Load("/nonexistent", "devbox")
 	if err == nil {
@@ -296,7 +321,7 @@ func TestValidateEmptyUsername(t *testing.T) {
 	}
 }
 
-func TestValidateMissingGitHubUsername(t *testing.T) {
+func TestValidateMissingKeySource(t *testing.T) {
 	configuration := &Config{
 		VM: &VMConfig{
 			Name:  "devbox",
@@ -305,7 +330,37 @@ func TestValidateMissingGitHubUsername(t *testing.T) {
 	}
 	err := Validate(configuration)
 	if err == nil {
-		t.Fatal("Validate() should return error for missing github_username")
+		t.Fatal("Validate() should return error for a user without a key source")
+	}
+	if !strings.Contains(err.Error(), "no SSH key source") {
+		t.Errorf("error should mention missing key source, got: %v", err)
+	}
+}
+
+func TestValidateAlternateKeySources(t *testing.T) {
+	users := []User{
+		{Username: "ubuntu", GitLabUsername: "alice", GitLabURL: "https://gitlab.example.com"},
+		{Username: "bob", SSHKeys: []string{"ssh-ed25519 AAAAC3 bob@laptop"}},
+		{Username: "carol", SSHKeyFiles: []string{"~/.ssh/id_ed25519.pub"}},
+		{Username: "dave", SSHKeysFromAgent: true},
+	}
+	for _, user := range users {
+		configuration := &Config{VM: &VMConfig{Name: "devbox", Users: []User{user}}}
+		if err := Validate(configuration); err != nil {
+			t.Errorf("Validate() with user %+v returned error: %v", user, err)
+		}
+	}
+}
+
+func TestValidateGitLabURLRequiresUsername(t *testing.T) {
+	configuration := &Config{
+		VM: &VMConfig{
+			Name:  "devbox",
+			Users: []User{{Username: "ubuntu", GitHubUsername: "alice", GitLabURL: "https://gitlab.example.com"}},
+		},
+	}
+	if err := Validate(configuration); err == nil {
+		t.Fatal("Validate() should reject gitlab_url without gitlab_username")
 	}
 }
 
@@ -620,3 +675,388 @@ func TestLoadValidatesAfterParsing(t *testing.T) {
 		t.Fatal("Load() should return validation error for empty name")
 	}
 }
+
+func TestParseDurationDays(t *testing.T) {
+	got, err := ParseDuration("30d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 30*24*time.Hour {
+		t.Errorf("ParseDuration(\"30d\") = %v, want %v", got, 30*24*time.Hour)
+	}
+}
+
+func TestParseDurationGoSyntax(t *testing.T) {
+	got, err := ParseDuration("8h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 8*time.Hour {
+		t.Errorf("ParseDuration(\"8h\") = %v, want %v", got, 8*time.Hour)
+	}
+}
+
+func TestParseDurationInvalid(t *testing.T) {
+	for _, value := range []string{"", "d", "abc", "-3d", "-1h", "3 days"} {
+		if _, err := ParseDuration(value); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
+
+func TestValidateSSHSection(t *testing.T) {
+	valid := &Config{
+		VM:  &VMConfig{Name: "devbox", Users: []User{{Username: "ubuntu", GitHubUsername: "test"}}},
+		SSH: &SSHConfig{User: "deploy", Port: 2222, LocalForwards: []string{"8080:localhost:80"}, Options: map[string]string{"ServerAliveInterval": "30"}},
+	}
+	if err := Validate(valid); err != nil {
+		t.Fatalf("Validate() returned error for valid ssh section: %v", err)
+	}
+
+	invalid := []*SSHConfig{
+		{Port: 70000},
+		{User: "Bad User"},
+		{LocalForwards: []string{"-oProxyCommand=evil"}},
+		{Options: map[string]string{"Bad=Key": "x"}},
+	}
+	for _, sshConfig := range invalid {
+		configuration := &Config{
+			VM:  &VMConfig{Name: "devbox", Users: []User{{Username: "ubuntu", GitHubUsername: "test"}}},
+			SSH: sshConfig,
+		}
+		if err := Validate(configuration); err == nil {
+			t.Errorf("Validate() should reject ssh section %+v", sshConfig)
+		}
+	}
+}
+
+func TestValidateDNSLocalOnly(t *testing.T) {
+	valid := &Config{
+		VM:  &VMConfig{Name: "devbox", Users: []User{{Username: "ubuntu", GitHubUsername: "test"}}},
+		DNS: &DNSConfig{Hostname: "devbox", Domain: "example.internal", LocalOnly: true},
+	}
+	if err := Validate(valid); err != nil {
+		t.Fatalf("Validate() returned error for local_only dns: %v", err)
+	}
+
+	for _, dns := range []*DNSConfig{
+		{Domain: "example.internal", LocalOnly: true, CNAMEAliases: []string{"www"}},
+		{Domain: "example.internal", LocalOnly: true, IsApexDomain: true},
+		{Domain: "example.internal", LocalOnly: true, ZoneID: "Z123"},
+	} {
+		configuration := &Config{
+			VM:  &VMConfig{Name: "devbox", Users: []User{{Username: "ubuntu", GitHubUsername: "test"}}},
+			DNS: dns,
+		}
+		if err := Validate(configuration); err == nil {
+			t.Errorf("Validate() should reject local_only with Route53 settings %+v", dns)
+		}
+	}
+}
+
+func TestValidateElasticIPAllocationID(t *testing.T) {
+	for allocationID, wantErr := range map[string]bool{"": false, "eipalloc-0123456789abcdef0": false, "eipalloc-": true, "54.1.2.3": true} {
+		configuration := &Config{
+			VM: &VMConfig{Name: "devbox", Users: []User{{Username: "ubuntu", GitHubUsername: "test"}}, ElasticIPAllocationID: allocationID},
+		}
+		err := Validate(configuration)
+		if wantErr && err == nil {
+			t.Errorf("Validate() should reject vm.elastic_ip_allocation_id %q", allocationID)
+		}
+		if !wantErr && err != nil {
+			t.Errorf("Validate() returned error for vm.elastic_ip_allocation_id %q: %v", allocationID, err)
+		}
+	}
+}
+
+func TestParseSizeGiB(t *testing.T) {
+	for size, want := range map[string]int{"20G": 20, "20GB": 20, "20GiB": 20, "20g": 20, "1.5G": 2, "1T": 1024, "512M": 1, "1536M": 2, "1048577K": 2, "21474836480": 20, "21474836480B": 20} {
+		got, err := ParseSizeGiB(size)
+		if err != nil {
+			t.Errorf("ParseSizeGiB(%q) returned error: %v", size, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseSizeGiB(%q) = %d, want %d", size, got, want)
+		}
+	}
+	for _, size := range []string{"", "0G", "-1G", "twentyG", "20X", "1.G"} {
+		if _, err := ParseSizeGiB(size); err == nil {
+			t.Errorf("ParseSizeGiB(%q) should return error", size)
+		}
+	}
+}
+
+func TestValidateVolumes(t *testing.T) {
+	base := func() *Config {
+		return &Config{VM: &VMConfig{Name: "devbox", Users: []User{{Username: "ubuntu", GitHubUsername: "test"}}, Disk: "40G"}}
+	}
+
+	valid := base()
+	valid.VM.DiskType = "io2"
+	valid.VM.DiskIOPS = 4000
+	valid.VM.DiskEncrypted = true
+	valid.VM.Volumes = []Volume{{Size: "100G", MountPoint: "/data"}, {Size: "1T", Type: "gp3", IOPS: 6000, Device: "/dev/sdh"}}
+	if err := Validate(valid); err != nil {
+		t.Fatalf("Validate() returned error: %v", err)
+	}
+
+	invalid := map[string]func(*VMConfig){
+		"bad disk":         func(vm *VMConfig) { vm.Disk = "big" },
+		"unknown type":     func(vm *VMConfig) { vm.DiskType = "magnetic" },
+		"io2 without iops": func(vm *VMConfig) { vm.DiskType = "io2" },
+		"gp2 with iops":    func(vm *VMConfig) { vm.DiskType = "gp2"; vm.DiskIOPS = 3000 },
+		"missing size":     func(vm *VMConfig) { vm.Volumes = []Volume{{MountPoint: "/data"}} },
+		"bad device":       func(vm *VMConfig) { vm.Volumes = []Volume{{Size: "10G", Device: "/dev/sda1"}} },
+		"duplicate device": func(vm *VMConfig) {
+			vm.Volumes = []Volume{{Size: "10G", Device: "/dev/sdf"}, {Size: "10G", Device: "/dev/xvdf"}}
+		},
+		"relative mount": func(vm *VMConfig) { vm.Volumes = []Volume{{Size: "10G", MountPoint: "data"}} },
+		"duplicate mount": func(vm *VMConfig) {
+			vm.Volumes = []Volume{{Size: "10G", MountPoint: "/data"}, {Size: "10G", MountPoint: "/data"}}
+		},
+		"volume type typo": func(vm *VMConfig) { vm.Volumes = []Volume{{Size: "10G", Type: "gp4"}} },
+		"too many volumes": func(vm *VMConfig) { vm.Volumes = make([]Volume, 12) },
+	}
+	for name, mutate := range invalid {
+		configuration := base()
+		mutate(configuration.VM)
+		if err := Validate(configuration); err == nil {
+			t.Errorf("%s: Validate() should return error", name)
+		}
+	}
+}
+
+func TestValidateForProviderRejectsEBSFieldsOnMultipass(t *testing.T) {
+	for _, vm := range []*VMConfig{
+		{Volumes: []Volume{{Size: "100G"}}},
+		{DiskType: "io2"},
+		{DiskIOPS: 4000},
+		{DiskEncrypted: true},
+	} {
+		configuration := &Config{VM: vm}
+		if err := ValidateForProvider(configuration, "multipass"); err == nil {
+			t.Errorf("ValidateForProvider(multipass) should reject %+v", vm)
+		}
+		if err := ValidateForProvider(configuration, "aws"); err != nil {
+			t.Errorf("ValidateForProvider(aws) returned error for %+v: %v", vm, err)
+		}
+	}
+	if err := ValidateForProvider(&Config{VM: &VMConfig{Disk: "20g"}}, "multipass"); err != nil {
+		t.Errorf("ValidateForProvider(multipass) should accept vm.disk: %v", err)
+	}
+}
+
+func TestValidateIAM(t *testing.T) {
+	valid := []*IAMConfig{
+		{InstanceProfile: "devbox-profile"},
+		{InstanceProfile: "arn:aws:iam::123456789012:instance-profile/dev/devbox-profile"},
+		{ManagedPolicies: []string{"arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess", "arn:aws:iam::123456789012:policy/team/ecr-pull"}},
+	}
+	invalid := []*IAMConfig{
+		{},
+		{InstanceProfile: "devbox-profile", ManagedPolicies: []string{"arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess"}},
+		{InstanceProfile: "has spaces"},
+		{InstanceProfile: "arn:aws:iam::123456789012:role/devbox"},
+		{ManagedPolicies: []string{"AmazonS3ReadOnlyAccess"}},
+	}
+	for _, iam := range valid {
+		configuration := &Config{VM: &VMConfig{Name: "devbox", Users: []User{{Username: "ubuntu", GitHubUsername: "test"}}, IAM: iam}}
+		if err := Validate(configuration); err != nil {
+			t.Errorf("Validate() returned error for %+v: %v", iam, err)
+		}
+	}
+	for _, iam := range invalid {
+		configuration := &Config{VM: &VMConfig{Name: "devbox", Users: []User{{Username: "ubuntu", GitHubUsername: "test"}}, IAM: iam}}
+		if err := Validate(configuration); err == nil {
+			t.Errorf("Validate() should reject %+v", iam)
+		}
+	}
+}
+
+func TestValidateSpot(t *testing.T) {
+	cases := []struct {
+		spot      *SpotConfig
+		encrypted bool
+		wantErr   bool
+	}{
+		{spot: &SpotConfig{}},
+		{spot: &SpotConfig{MaxPrice: "0.05", InterruptionBehavior: "terminate"}},
+		{spot: &SpotConfig{InterruptionBehavior: "hibernate"}, encrypted: true},
+		{spot: &SpotConfig{InterruptionBehavior: "hibernate"}, wantErr: true},
+		{spot: &SpotConfig{InterruptionBehavior: "pause"}, wantErr: true},
+		{spot: &SpotConfig{MaxPrice: "cheap"}, wantErr: true},
+		{spot: &SpotConfig{MaxPrice: "0"}, wantErr: true},
+	}
+	for _, c := range cases {
+		configuration := &Config{VM: &VMConfig{Name: "devbox", Users: []User{{Username: "ubuntu", GitHubUsername: "test"}}, Spot: c.spot, DiskEncrypted: c.encrypted}}
+		err := Validate(configuration)
+		if c.wantErr && err == nil {
+			t.Errorf("Validate() should reject %+v (encrypted=%v)", c.spot, c.encrypted)
+		}
+		if !c.wantErr && err != nil {
+			t.Errorf("Validate() returned error for %+v: %v", c.spot, err)
+		}
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	for tags, wantErr := range map[string]bool{
+		"team=platform":   false,
+		"=empty-key":      true,
+		"aws:createdBy=x": true,
+		"AWS:thing=x":     true,
+		"goloo:owner=bob": true,
+	} {
+		key, value, _ := strings.Cut(tags, "=")
+		configuration := &Config{
+			VM:   &VMConfig{Name: "devbox", Users: []User{{Username: "ubuntu", GitHubUsername: "test"}}},
+			Tags: map[string]string{key: value},
+		}
+		err := Validate(configuration)
+		if wantErr && err == nil {
+			t.Errorf("Validate() should reject tag %q", key)
+		}
+		if !wantErr && err != nil {
+			t.Errorf("Validate() returned error for tag %q: %v", key, err)
+		}
+	}
+}
+
+func TestApplyDefaultsAssignsVolumeDevices(t *testing.T) {
+	configuration := &Config{VM: &VMConfig{Name: "devbox", Volumes: []Volume{{Size: "10G"}, {Size: "10G", Device: "/dev/xvdf"}, {Size: "10G"}}}}
+	ApplyDefaults(configuration)
+
+	got := []string{configuration.VM.Volumes[0].Device, configuration.VM.Volumes[1].Device, configuration.VM.Volumes[2].Device}
+	want := []string{"/dev/sdg", "/dev/xvdf", "/dev/sdh"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("volume devices = %v, want %v", got, want)
+	}
+}
+
+func TestValidateFirewallRule(t *testing.T) {
+	valid := []FirewallRule{
+		{Port: 22},
+		{Protocol: "tcp", Port: 8000, ToPort: 8100, CIDR: "10.0.0.0/8"},
+		{Protocol: "udp", Port: 51820, CIDR: "my-ip"},
+		{Protocol: "icmp", CIDR: "0.0.0.0/0"},
+		{Protocol: "all", CIDR: "2001:db8::/32", Description: "office v6"},
+	}
+	for _, rule := range valid {
+		if err := ValidateFirewallRule(rule); err != nil {
+			t.Errorf("ValidateFirewallRule(%+v) returned error: %v", rule, err)
+		}
+	}
+
+	invalid := []FirewallRule{
+		{},
+		{Port: 70000},
+		{Port: 8100, ToPort: 8000},
+		{Protocol: "gre", Port: 1},
+		{Protocol: "all", Port: 22},
+		{Port: 22, CIDR: "10.0.0.1"},
+		{Port: 22, Description: "bad\"quote"},
+	}
+	for _, rule := range invalid {
+		if err := ValidateFirewallRule(rule); err == nil {
+			t.Errorf("ValidateFirewallRule(%+v) should return error", rule)
+		}
+	}
+}
+
+func TestValidateHostsBackend(t *testing.T) {
+	for backend, wantErr := range map[string]bool{"": false, "etc-hosts": false, "dnsmasq": false, "bind9": true} {
+		configuration := &Config{
+			VM:    &VMConfig{Name: "devbox", Users: []User{{Username: "ubuntu", GitHubUsername: "test"}}},
+			Hosts: &HostsConfig{Backend: backend},
+		}
+		err := Validate(configuration)
+		if wantErr && err == nil {
+			t.Errorf("Validate() should reject hosts.backend %q", backend)
+		}
+		if !wantErr && err != nil {
+			t.Errorf("Validate() returned error for hosts.backend %q: %v", backend, err)
+		}
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	t.Setenv("HOME", "/home/dev")
+	tests := map[string]string{
+		"~/.ssh/id_ed25519": "/home/dev/.ssh/id_ed25519",
+		"~":                 "/home/dev",
+		"/etc/ssh/key":      "/etc/ssh/key",
+		"~other/key":        "~other/key",
+	}
+	for input, want := range tests {
+		got, err := ExpandHome(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("ExpandHome(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestValidateTTL(t *testing.T) {
+	for _, tc := range []struct {
+		ttl, action string
+		wantErr     bool
+	}{
+		{"", "", false},
+		{"8h", "", false},
+		{"3d", "destroy", false},
+		{"90m", "stop", false},
+		{"0h", "", true},
+		{"soon", "", true},
+		{"8h", "hibernate", true},
+	} {
+		configuration := &Config{
+			VM: &VMConfig{Name: "devbox", Users: []User{{Username: "ubuntu", GitHubUsername: "test"}}, TTL: tc.ttl, TTLAction: tc.action},
+		}
+		err := Validate(configuration)
+		if tc.wantErr && err == nil {
+			t.Errorf("Validate() should reject ttl %q action %q", tc.ttl, tc.action)
+		}
+		if !tc.wantErr && err != nil {
+			t.Errorf("Validate() returned error for ttl %q action %q: %v", tc.ttl, tc.action, err)
+		}
+	}
+}
+
+func TestIdleStopDefaultsAndValidation(t *testing.T) {
+	configuration := &Config{VM: &VMConfig{Name: "devbox", IdleStop: &IdleStopConfig{CPUPercent: 20}}}
+	ApplyDefaults(configuration)
+	if configuration.VM.IdleStop.Minutes != DefaultIdleMinutes || configuration.VM.IdleStop.CPUPercent != 20 {
+		t.Errorf("unexpected idle_stop defaults %+v", configuration.VM.IdleStop)
+	}
+
+	for _, idle := range []IdleStopConfig{{Minutes: -5}, {CPUPercent: 101}, {CPUPercent: -1}} {
+		configuration := &Config{
+			VM: &VMConfig{Name: "devbox", Users: []User{{Username: "ubuntu", GitHubUsername: "test"}}, IdleStop: &idle},
+		}
+		if err := Validate(configuration); err == nil {
+			t.Errorf("Validate() should reject idle_stop %+v", idle)
+		}
+	}
+}
+
+func TestValidateSnapshotName(t *testing.T) {
+	for name, wantErr := range map[string]bool{
+		"pre-upgrade":          false,
+		"snap-20260301-120000": false,
+		"1st":                  true,
+		"with space":           true,
+		"dot.name":             true,
+		"":                     true,
+	} {
+		err := ValidateSnapshotName(name)
+		if wantErr && err == nil {
+			t.Errorf("ValidateSnapshotName(%q) should return error", name)
+		}
+		if !wantErr && err != nil {
+			t.Errorf("ValidateSnapshotName(%q) returned error: %v", name, err)
+		}
+	}
+}
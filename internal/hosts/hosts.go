@@ -1,15 +1,34 @@
 package hosts
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"syscall"
+	"time"
 )
 
-const hostsFile = "/etc/hosts"
+const (
+	BackendEtcHosts  = "etc-hosts"
+	BackendDnsmasq   = "dnsmasq"
+	FragmentFileName = "goloo.hosts"
+	BackupSuffix     = ".goloo.bak"
+	hostsFile        = "/etc/hosts"
+	defaultFileMode  = 0644
+	lockFileName     = "goloo-hosts.lock"
+	lockPollInterval = 100 * time.Millisecond
+	sudoWriteScript  = `set -e; cp -p "$1" "$1$4"; cp "$2" "$1.goloo.tmp"; chmod "$3" "$1.goloo.tmp"; mv -f "$1.goloo.tmp" "$1" 2>/dev/null || { cat "$1.goloo.tmp" > "$1"; rm -f "$1.goloo.tmp"; }`
+)
+
+var LockTimeout = 60 * time.Second
+
+var renameFile = os.Rename
 
 var hostnameRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?$`)
 
@@ -84,7 +103,33 @@ func removeBlock(content, vmName string) string {
 	return strings.Join(result, "\n")
 }
 
-func Add(vmName, ip string, hostnames []string, verbose bool) error {
+type Entry struct {
+	Name      string
+	IP        string
+	Hostnames []string
+}
+
+type Backend struct {
+	Name       string
+	Path       string
+	Privileged bool
+}
+
+func NewBackend(name, fragmentPath string) (*Backend, error) {
+	switch name {
+	case "", BackendEtcHosts:
+		return &Backend{Name: BackendEtcHosts, Path: hostsFile, Privileged: true}, nil
+	case BackendDnsmasq:
+		if fragmentPath == "" {
+			return nil, fmt.Errorf("hosts backend %q requires a fragment file path", name)
+		}
+		return &Backend{Name: BackendDnsmasq, Path: fragmentPath}, nil
+	default:
+		return nil, fmt.Errorf("unknown hosts backend %q: use %s or %s", name, BackendEtcHosts, BackendDnsmasq)
+	}
+}
+
+func (b *Backend) Add(vmName, ip string, hostnames []string, verbose bool) error {
 	if err := ValidateIP(ip); err != nil {
 		return err
 	}
@@ -94,65 +139,204 @@ func Add(vmName, ip string, hostnames []string, verbose bool) error {
 		}
 	}
 
-	content, err := os.ReadFile(hostsFile)
+	unlock, err := b.lock()
 	if err != nil {
-		return fmt.Errorf("failed to read %s: %w", hostsFile, err)
+		return err
+	}
+	defer unlock()
+
+	content, err := b.read()
+	if err != nil {
+		return err
 	}
 
-	cleaned := removeBlock(string(content), vmName)
-	if !strings.HasSuffix(cleaned, "\n") {
+	cleaned := removeBlock(content, vmName)
+	if cleaned != "" && !strings.HasSuffix(cleaned, "\n") {
 		cleaned += "\n"
 	}
 	updated := cleaned + buildBlock(vmName, ip, hostnames)
 
-	cmd := exec.Command("sudo", "tee", hostsFile)
-	cmd.Stdin = strings.NewReader(updated)
-	cmd.Stdout = nil
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to write %s (sudo required): %w", hostsFile, err)
+	if err := b.write(updated); err != nil {
+		return err
 	}
 
 	if verbose {
-		fmt.Fprintf(os.Stderr, "[verbose] added /etc/hosts entry: %s -> %s\n", ip, strings.Join(hostnames, " "))
+		fmt.Fprintf(os.Stderr, "[verbose] added %s entry: %s -> %s\n", b.Path, ip, strings.Join(hostnames, " "))
 	}
 	return nil
 }
 
-func Remove(vmName string, verbose bool) error {
-	content, err := os.ReadFile(hostsFile)
+func (b *Backend) Remove(vmName string, verbose bool) error {
+	unlock, err := b.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	content, err := b.read()
 	if err != nil {
-		return fmt.Errorf("failed to read %s: %w", hostsFile, err)
+		return err
 	}
 
-	cleaned := removeBlock(string(content), vmName)
-	if string(content) == cleaned {
+	cleaned := removeBlock(content, vmName)
+	if content == cleaned {
 		return nil
 	}
 
-	cmd := exec.Command("sudo", "tee", hostsFile)
-	cmd.Stdin = strings.NewReader(cleaned)
-	cmd.Stdout = nil
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to write %s (sudo required): %w", hostsFile, err)
+	if err := b.write(cleaned); err != nil {
+		return err
 	}
 
 	if verbose {
-		fmt.Fprintf(os.Stderr, "[verbose] removed /etc/hosts entry for %s\n", vmName)
+		fmt.Fprintf(os.Stderr, "[verbose] removed %s entry for %s\n", b.Path, vmName)
 	}
 	return nil
 }
 
-func HasEntry(vmName string) bool {
-	content, err := os.ReadFile(hostsFile)
+func (b *Backend) HasEntry(vmName string) bool {
+	content, err := os.ReadFile(b.Path)
 	if err != nil {
 		return false
 	}
-	return strings.Contains(string(content), startMarker(vmName))
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == startMarker(vmName) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Backend) Entries() ([]Entry, error) {
+	content, err := b.read()
+	if err != nil {
+		return nil, err
+	}
+	return parseEntries(content), nil
+}
+
+func parseEntries(content string) []Entry {
+	var entries []Entry
+	var current *Entry
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "# goloo:"):
+			current = &Entry{Name: strings.TrimPrefix(trimmed, "# goloo:")}
+		case current != nil && trimmed == endMarker(current.Name):
+			entries = append(entries, *current)
+			current = nil
+		case current != nil && current.IP == "":
+			fields := strings.Fields(trimmed)
+			if len(fields) > 0 {
+				current.IP = fields[0]
+				current.Hostnames = fields[1:]
+			}
+		}
+	}
+	return entries
+}
+
+func (b *Backend) lock() (func(), error) {
+	if !b.Privileged {
+		if err := os.MkdirAll(filepath.Dir(b.Path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", filepath.Dir(b.Path), err)
+		}
+	}
+	return lockFile(filepath.Join(os.TempDir(), lockFileName), LockTimeout)
+}
+
+func (b *Backend) read() (string, error) {
+	content, err := os.ReadFile(b.Path)
+	if os.IsNotExist(err) && !b.Privileged {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", b.Path, err)
+	}
+	return string(content), nil
+}
+
+func (b *Backend) write(content string) error {
+	path := b.Path
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	err := writeAtomic(path, content, b.Privileged)
+	if err == nil || !b.Privileged || !errors.Is(err, fs.ErrPermission) {
+		return err
+	}
+	return sudoWriteAtomic(path, content)
+}
+
+func fileMode(path string) os.FileMode {
+	if info, err := os.Stat(path); err == nil {
+		return info.Mode().Perm()
+	}
+	return defaultFileMode
+}
+
+func writeAtomic(path, content string, backup bool) error {
+	mode := fileMode(path)
+	if existing, err := os.ReadFile(path); err == nil && backup {
+		if err := os.WriteFile(path+BackupSuffix, existing, mode); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+	}
+
+	temporaryFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer os.Remove(temporaryFile.Name())
+
+	if _, err := temporaryFile.WriteString(content); err != nil {
+		temporaryFile.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := temporaryFile.Chmod(mode); err != nil {
+		temporaryFile.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := temporaryFile.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := renameFile(temporaryFile.Name(), path); err != nil {
+		if !errors.Is(err, syscall.EBUSY) && !errors.Is(err, syscall.EXDEV) {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		if err := os.WriteFile(path, []byte(content), mode); err != nil {
+			return fmt.Errorf("failed to write %s in place: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func sudoWriteAtomic(path, content string) error {
+	temporaryFile, err := os.CreateTemp("", "goloo-hosts-*")
+	if err != nil {
+		return fmt.Errorf("failed to stage %s: %w", path, err)
+	}
+	defer os.Remove(temporaryFile.Name())
+
+	if _, err := temporaryFile.WriteString(content); err != nil {
+		temporaryFile.Close()
+		return fmt.Errorf("failed to stage %s: %w", path, err)
+	}
+	if err := temporaryFile.Close(); err != nil {
+		return fmt.Errorf("failed to stage %s: %w", path, err)
+	}
+
+	mode := fmt.Sprintf("%o", fileMode(path))
+	cmd := exec.Command("sudo", "sh", "-c", sudoWriteScript, "sh", path, temporaryFile.Name(), mode, BackupSuffix)
+	cmd.Stdout = nil
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to write %s (sudo required): %w", path, err)
+	}
+	return nil
 }
 
-func ManualInstructions(ip string, hostnames []string, vmName string) string {
-	return fmt.Sprintf("Add this line to /etc/hosts manually:\n  %s    %s",
-		ip, strings.Join(hostnames, " "))
+func (b *Backend) ManualInstructions(ip string, hostnames []string, vmName string) string {
+	return fmt.Sprintf("Add this line to %s manually:\n  %s    %s",
+		b.Path, ip, strings.Join(hostnames, " "))
 }
@@ -1,7 +1,12 @@
 package hosts
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 )
 
@@ -141,3 +146,230 @@ func TestRemoveBlockOnlyTargeted(t *testing.T) {
 		t.Error("expected 'remove' block removed")
 	}
 }
+
+func TestNewBackendDefaultIsEtcHosts(t *testing.T) {
+	backend, err := NewBackend("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend.Name != BackendEtcHosts || backend.Path != "/etc/hosts" || !backend.Privileged {
+		t.Errorf("unexpected default backend: %+v", backend)
+	}
+}
+
+func TestNewBackendDnsmasqRequiresPath(t *testing.T) {
+	if _, err := NewBackend(BackendDnsmasq, ""); err == nil {
+		t.Error("expected error for dnsmasq backend without fragment path")
+	}
+}
+
+func TestNewBackendUnknown(t *testing.T) {
+	if _, err := NewBackend("bind9", ""); err == nil {
+		t.Error("expected error for unknown backend")
+	}
+}
+
+func TestFragmentBackendAddAndRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.d", FragmentFileName)
+	backend, err := NewBackend(BackendDnsmasq, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.Add("devbox", "192.168.64.5", []string{"devbox.local", "devbox"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Add("other", "192.168.64.6", []string{"other"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if !backend.HasEntry("devbox") || !backend.HasEntry("other") {
+		t.Fatal("expected both entries to exist")
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "192.168.64.5    devbox.local devbox\n") {
+		t.Errorf("expected devbox line, got:\n%s", content)
+	}
+
+	if err := backend.Remove("devbox", false); err != nil {
+		t.Fatal(err)
+	}
+	if backend.HasEntry("devbox") {
+		t.Error("expected devbox entry to be removed")
+	}
+	if !backend.HasEntry("other") {
+		t.Error("expected other entry to remain")
+	}
+}
+
+func TestFragmentBackendReplacesEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FragmentFileName)
+	backend, err := NewBackend(BackendDnsmasq, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Add("devbox", "192.168.64.5", []string{"devbox"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Add("devbox", "192.168.64.9", []string{"devbox"}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "192.168.64.5") || strings.Count(string(content), "# goloo:devbox") != 1 {
+		t.Errorf("expected a single updated entry, got:\n%s", content)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != FragmentFileName {
+		t.Errorf("expected only the fragment in its hostsdir, got %v", entries)
+	}
+}
+
+func TestWriteAtomicBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeAtomic(path, "127.0.0.1 localhost\n10.0.0.1 devbox\n", true); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := os.ReadFile(path + BackupSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(backup) != "127.0.0.1 localhost\n" {
+		t.Errorf("expected backup to hold the previous content, got:\n%s", backup)
+	}
+}
+
+func TestWriteAtomicPreservesMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte("127.0.0.1 localhost\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeAtomic(path, "127.0.0.1 localhost\n10.0.0.1 devbox\n", true); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected mode 0640, got %o", info.Mode().Perm())
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected only the file and its backup, got %d entries", len(entries))
+	}
+}
+
+func TestWriteAtomicFallsBackWhenBindMounted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renameFile = func(oldPath, newPath string) error {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: syscall.EBUSY}
+	}
+	defer func() { renameFile = os.Rename }()
+
+	if err := writeAtomic(path, "127.0.0.1 localhost\n10.0.0.1 devbox\n", true); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "127.0.0.1 localhost\n10.0.0.1 devbox\n" {
+		t.Errorf("expected the file to be rewritten in place, got:\n%s", data)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) {
+		t.Error("expected the same file to be rewritten, not replaced")
+	}
+	if backup, err := os.ReadFile(path + BackupSuffix); err != nil || string(backup) != "127.0.0.1 localhost\n" {
+		t.Errorf("expected the backup to be kept, got %q, %v", backup, err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 2 {
+		t.Errorf("expected only the file and its backup, got %d entries", len(entries))
+	}
+}
+
+func TestParseEntries(t *testing.T) {
+	content := "127.0.0.1 localhost\n" +
+		"# goloo:devbox\n192.168.64.5    devbox.local devbox\n# /goloo:devbox\n" +
+		"10.0.0.1 unrelated\n" +
+		"# goloo:web\n192.168.64.6    web\n# /goloo:web\n"
+	entries := parseEntries(content)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Name != "devbox" || entries[0].IP != "192.168.64.5" || strings.Join(entries[0].Hostnames, " ") != "devbox.local devbox" {
+		t.Errorf("unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].Name != "web" || entries[1].IP != "192.168.64.6" {
+		t.Errorf("unexpected second entry: %+v", entries[1])
+	}
+}
+
+func TestParseEntriesIgnoresUnterminatedBlock(t *testing.T) {
+	entries := parseEntries("# goloo:devbox\n192.168.64.5    devbox\n")
+	if len(entries) != 0 {
+		t.Errorf("expected no entries for unterminated block, got %+v", entries)
+	}
+}
+
+func TestFragmentBackendConcurrentAdds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FragmentFileName)
+	backend, err := NewBackend(BackendDnsmasq, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("vm%d", i)
+			errs <- backend.Add(name, fmt.Sprintf("192.168.64.%d", i+10), []string{name}, false)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := backend.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 10 {
+		t.Errorf("expected 10 entries after concurrent adds, got %d", len(entries))
+	}
+}
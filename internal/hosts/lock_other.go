@@ -0,0 +1,9 @@
+//go:build !unix
+
+package hosts
+
+import "time"
+
+func lockFile(path string, timeout time.Duration) (func(), error) {
+	return func() {}, nil
+}
@@ -1,6 +1,7 @@
 package aws
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"fmt"
@@ -24,16 +25,27 @@ var operatingSystemSSMPaths = map[string]string{
 	"debian-11":         "/aws/service/debian/release/11/latest/amd64",
 }
 
+const sshConnectionFailure = 255
+
+var nonInteractiveSSHOptions = []string{
+	"-o", "BatchMode=yes",
+	"-o", "StrictHostKeyChecking=accept-new",
+	"-o", "ConnectTimeout=10",
+}
+
 type Provider struct {
 	Region         string
 	CloudFormation CloudFormationClient
 	EC2            EC2Client
 	Route53        Route53Client
 	SSM            SSMClient
+	LookupPublicIP func(context.Context) (string, error)
+	StackFolder    string
+	Version        string
 }
 
 func New(region string) *Provider {
-	return &Provider{Region: region}
+	return &Provider{Region: region, LookupPublicIP: DetectPublicIP}
 }
 
 func NewWithSDK(region string) (*Provider, error) {
@@ -47,9 +59,18 @@ func NewWithSDK(region string) (*Provider, error) {
 		EC2:            NewSDKEC2Client(awsCfg),
 		Route53:        NewSDKRoute53Client(awsCfg),
 		SSM:            NewSDKSSMClient(awsCfg),
+		LookupPublicIP: DetectPublicIP,
 	}, nil
 }
 
+func DefaultRegion(context context.Context) string {
+	awsCfg, err := awsconfig.LoadDefaultConfig(context)
+	if err != nil || awsCfg.Region == "" {
+		return config.DefaultRegion
+	}
+	return awsCfg.Region
+}
+
 func NewWithClients(region string, cloudFormation CloudFormationClient, ec2 EC2Client, route53 Route53Client, ssm SSMClient) *Provider {
 	return &Provider{
 		Region:         region,
@@ -57,6 +78,7 @@ func NewWithClients(region string, cloudFormation CloudFormationClient, ec2 EC2C
 		EC2:            ec2,
 		Route53:        route53,
 		SSM:            ssm,
+		LookupPublicIP: DetectPublicIP,
 	}
 }
 
@@ -94,7 +116,7 @@ func (p *Provider) Create(context context.Context, configuration *config.Config,
 		return err
 	}
 
-	configuration.AWS = &config.AWSState{}
+	configuration.AWS = &config.AWSState{Region: p.Region}
 
 	cloudInitContent, err := os.ReadFile(cloudInitPath)
 	if err != nil {
@@ -112,14 +134,47 @@ func (p *Provider) Create(context context.Context, configuration *config.Config,
 	}
 	configuration.AWS.AMIID = amiID
 
-	vpcID, subnetID, err := p.discoverOrCreateNetwork(context, configuration)
+	blockDevices, err := BuildBlockDevices(osName, configuration.VM)
+	if err != nil {
+		return err
+	}
+
+	tags := BuildTags(configuration, p.StackFolder, p.Version, CurrentOwner())
+
+	vpcID, subnetID, err := p.discoverOrCreateNetwork(context, configuration, tags)
 	if err != nil {
 		return fmt.Errorf("network setup failed: %w", err)
 	}
 	configuration.AWS.VpcID = vpcID
 	configuration.AWS.SubnetID = subnetID
 
-	template := GenerateTemplate(userData)
+	ingress, err := ResolveIngressRules(context, FirewallRules(configuration), p.LookupPublicIP)
+	if err != nil {
+		return fmt.Errorf("firewall setup failed: %w", err)
+	}
+
+	options := TemplateOptions{
+		UserData:              userData,
+		Ingress:               ingress,
+		ElasticIP:             configuration.VM.ElasticIP,
+		ElasticIPAllocationID: configuration.VM.ElasticIPAllocationID,
+		BlockDevices:          blockDevices,
+		Tags:                  tags,
+	}
+	if configuration.VM.IAM != nil {
+		options.InstanceProfile = configuration.VM.IAM.InstanceProfile
+		options.ManagedPolicies = configuration.VM.IAM.ManagedPolicies
+	}
+	if configuration.VM.Spot != nil {
+		options.Spot = true
+		options.SpotMaxPrice = configuration.VM.Spot.MaxPrice
+		options.SpotInterruption = configuration.VM.Spot.InterruptionBehavior
+		configuration.AWS.Spot = true
+	}
+	template, err := GenerateTemplate(options)
+	if err != nil {
+		return err
+	}
 	stackName := BuildStackName(configuration.VM.Name)
 
 	parameters := map[string]string{
@@ -129,7 +184,7 @@ func (p *Provider) Create(context context.Context, configuration *config.Config,
 		"SubnetId":     subnetID,
 	}
 
-	stackID, err := p.CloudFormation.CreateStack(context, stackName, template, parameters)
+	stackID, err := p.CloudFormation.CreateStack(context, stackName, template, parameters, tags)
 	if err != nil {
 		return fmt.Errorf("CloudFormation stack creation failed: %w", err)
 	}
@@ -147,8 +202,17 @@ func (p *Provider) Create(context context.Context, configuration *config.Config,
 	configuration.AWS.InstanceID = outputs.InstanceID
 	configuration.AWS.PublicIP = outputs.PublicIP
 	configuration.AWS.SecurityGroup = outputs.SecurityGroupID
+	configuration.AWS.ElasticIPAllocationID = outputs.ElasticIPAllocationID
+	configuration.AWS.CreatedElasticIP = outputs.ElasticIPAllocationID != "" && configuration.VM.ElasticIPAllocationID == ""
+	configuration.AWS.InstanceProfile = outputs.InstanceProfile
 
-	if configuration.DNS != nil && configuration.DNS.Domain != "" {
+	if configuration.VM.ElasticIPAllocationID != "" {
+		if _, publicIP, err := p.EC2.DescribeInstance(context, outputs.InstanceID); err == nil && publicIP != "" {
+			configuration.AWS.PublicIP = publicIP
+		}
+	}
+
+	if configuration.DNS != nil && configuration.DNS.Domain != "" && !configuration.DNS.LocalOnly {
 		if err := p.createDNSRecords(context, configuration); err != nil {
 			return fmt.Errorf("DNS record creation failed: %w", err)
 		}
@@ -172,6 +236,12 @@ func (p *Provider) Delete(context context.Context, configuration *config.Config)
 		}
 	}
 
+	if configuration.AWS.Spot && configuration.AWS.InstanceID != "" {
+		if err := p.cancelSpotRequest(context, configuration.AWS.InstanceID); err != nil {
+			return err
+		}
+	}
+
 	if configuration.AWS.StackName != "" {
 		if err := p.CloudFormation.DeleteStack(context, configuration.AWS.StackName); err != nil {
 			return fmt.Errorf("CloudFormation stack deletion failed: %w", err)
@@ -212,30 +282,131 @@ func (p *Provider) Status(context context.Context, configuration *config.Config)
 		return nil, fmt.Errorf("failed to describe instance %s: %w", configuration.AWS.InstanceID, err)
 	}
 
-	return &provider.VMStatus{
-		Name:     configuration.VM.Name,
-		State:    state,
-		IP:       publicIP,
-		Provider: "aws",
-	}, nil
+	status := &provider.VMStatus{
+		Name:       configuration.VM.Name,
+		State:      state,
+		IP:         publicIP,
+		Provider:   "aws",
+		InstanceID: configuration.AWS.InstanceID,
+		FQDN:       configuration.AWS.FQDN,
+		Image:      configuration.AWS.AMIID,
+	}
+	if configuration.AWS.Spot {
+		spot, err := p.EC2.DescribeSpotRequest(context, configuration.AWS.InstanceID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to describe spot request: %v\n", err)
+		} else {
+			status.Spot = spot
+		}
+	}
+	return status, nil
 }
 
-func (p *Provider) List(_ context.Context) ([]provider.VMStatus, error) {
-	return nil, fmt.Errorf("AWS list requires CloudFormation stack enumeration: use 'goloo status <name>' for individual VMs")
+func (p *Provider) List(context context.Context) ([]provider.VMStatus, error) {
+	if err := p.validateClients(); err != nil {
+		return nil, err
+	}
+
+	stacks, err := p.CloudFormation.ListStacks(context)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list goloo stacks in %s: %w", p.Region, err)
+	}
+
+	statuses := make([]provider.VMStatus, 0, len(stacks))
+	for _, stack := range stacks {
+		status := provider.VMStatus{
+			Name:       VMNameFromStack(stack.Name, stack.Tags),
+			State:      strings.ToLower(stack.Status),
+			IP:         stack.Outputs.PublicIP,
+			Provider:   "aws",
+			InstanceID: stack.Outputs.InstanceID,
+		}
+		if !stack.CreatedAt.IsZero() {
+			createdAt := stack.CreatedAt
+			status.CreatedAt = &createdAt
+		}
+		if stack.Outputs.InstanceID != "" {
+			state, publicIP, err := p.EC2.DescribeInstance(context, stack.Outputs.InstanceID)
+			if err != nil {
+				status.State = "unknown"
+			} else {
+				status.State = state
+				status.IP = publicIP
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
 }
 
-func (p *Provider) SSH(_ context.Context, configuration *config.Config) error {
-	if configuration.AWS == nil || configuration.AWS.PublicIP == "" {
-		return fmt.Errorf("no public IP: run 'goloo status %s' to check VM state", configuration.VM.Name)
+func (p *Provider) SSH(_ context.Context, configuration *config.Config, argv []string) error {
+	target, err := sshTarget(configuration)
+	if err != nil {
+		return err
 	}
-	username := sshUsername(configuration.VM.OS)
-	command := exec.Command("ssh", username+"@"+configuration.AWS.PublicIP)
+	command := exec.Command("ssh", provider.BuildInteractiveSSHArgs(configuration.SSH, target, argv)...)
 	command.Stdin = os.Stdin
 	command.Stdout = os.Stdout
 	command.Stderr = os.Stderr
 	return command.Run()
 }
 
+func (p *Provider) Exec(context context.Context, configuration *config.Config, argv []string) (*provider.ExecResult, error) {
+	target, err := sshTarget(configuration)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(context, "ssh", BuildSSHArgs(configuration.SSH, target, argv)...)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	err = command.Run()
+	result := &provider.ExecResult{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+	if err != nil {
+		exitCode, exited := provider.ExitCode(err)
+		if !exited {
+			return nil, fmt.Errorf("ssh failed: %w", err)
+		}
+		if exitCode == sshConnectionFailure {
+			return nil, fmt.Errorf("ssh to %s failed: %s", target, strings.TrimSpace(stderr.String()))
+		}
+		result.ExitCode = exitCode
+	}
+	return result, nil
+}
+
+func (p *Provider) CopyTo(context context.Context, configuration *config.Config, localPath, remotePath string) error {
+	target, err := sshTarget(configuration)
+	if err != nil {
+		return err
+	}
+	arguments := BuildSCPArgs(configuration.SSH, localPath, target+":"+remotePath)
+	if output, err := exec.CommandContext(context, "scp", arguments...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to copy %s to %s:%s: %s", localPath, configuration.VM.Name, remotePath, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (p *Provider) CopyFrom(context context.Context, configuration *config.Config, remotePath, localPath string) error {
+	target, err := sshTarget(configuration)
+	if err != nil {
+		return err
+	}
+	arguments := BuildSCPArgs(configuration.SSH, target+":"+remotePath, localPath)
+	if output, err := exec.CommandContext(context, "scp", arguments...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to copy %s:%s to %s: %s", configuration.VM.Name, remotePath, localPath, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (p *Provider) CloudInitStatus(context context.Context, configuration *config.Config) (*provider.CloudInitStatus, error) {
+	return provider.ExecReadinessChecker{Executor: p}.CloudInitStatus(context, configuration)
+}
+
+func (p *Provider) CloudInitLog(context context.Context, configuration *config.Config) (string, error) {
+	return provider.ExecReadinessChecker{Executor: p}.CloudInitLog(context, configuration)
+}
+
 func (p *Provider) Stop(context context.Context, configuration *config.Config) error {
 	if err := p.validateClients(); err != nil {
 		return err
@@ -256,14 +427,14 @@ func (p *Provider) Start(context context.Context, configuration *config.Config)
 	return p.EC2.StartInstance(context, configuration.AWS.InstanceID)
 }
 
-func (p *Provider) discoverOrCreateNetwork(context context.Context, configuration *config.Config) (string, string, error) {
+func (p *Provider) discoverOrCreateNetwork(context context.Context, configuration *config.Config, tags map[string]string) (string, string, error) {
 	if configuration.VM.VpcID != "" && configuration.VM.SubnetID != "" {
 		return configuration.VM.VpcID, configuration.VM.SubnetID, nil
 	}
 
 	vpcID, err := p.EC2.FindDefaultVPC(context)
 	if err != nil {
-		networkStack, createErr := p.EC2.CreateNetworkStack(context)
+		networkStack, createErr := p.EC2.CreateNetworkStack(context, tags)
 		if createErr != nil {
 			return "", "", fmt.Errorf("no VPC found and failed to create one: %w", createErr)
 		}
@@ -283,7 +454,30 @@ func (p *Provider) discoverOrCreateNetwork(context context.Context, configuratio
 	return vpcID, subnetID, nil
 }
 
-func sshUsername(operatingSystem string) string {
+func sshTarget(configuration *config.Config) (string, error) {
+	if configuration.AWS == nil || configuration.AWS.PublicIP == "" {
+		return "", fmt.Errorf("no public IP: run 'goloo status %s' to check VM state", configuration.VM.Name)
+	}
+	return provider.SSHUser(configuration, SSHUsername(configuration.VM.OS)) + "@" + configuration.AWS.PublicIP, nil
+}
+
+func BuildSSHArgs(sshConfig *config.SSHConfig, target string, argv []string) []string {
+	arguments := append([]string{}, nonInteractiveSSHOptions...)
+	arguments = append(arguments, provider.SSHConnectionArgs(sshConfig, "-p")...)
+	arguments = append(arguments, target)
+	if len(argv) > 0 {
+		arguments = append(arguments, provider.ShellJoin(argv))
+	}
+	return arguments
+}
+
+func BuildSCPArgs(sshConfig *config.SSHConfig, source, destination string) []string {
+	arguments := append([]string{"-r"}, nonInteractiveSSHOptions...)
+	arguments = append(arguments, provider.SSHConnectionArgs(sshConfig, "-P")...)
+	return append(arguments, source, destination)
+}
+
+func SSHUsername(operatingSystem string) string {
 	switch {
 	case strings.HasPrefix(operatingSystem, "amazon-linux"):
 		return "ec2-user"
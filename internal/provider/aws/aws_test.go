@@ -2,6 +2,7 @@ package aws
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/emergingrobotics/goloo/internal/config"
+	"github.com/emergingrobotics/goloo/internal/provider"
 )
 
 type fakeCloudFormation struct {
@@ -20,12 +22,21 @@ type fakeCloudFormation struct {
 	waitCreateError error
 	waitDeleteError error
 	describeError   error
+	listError       error
+	stacks          []StackSummary
 	createdStacks   []string
 	deletedStacks   []string
+	lastTemplate    string
+	lastParameters  map[string]string
+	lastTags        map[string]string
+	callLog         *[]string
 }
 
-func (f *fakeCloudFormation) CreateStack(_ context.Context, name string, _ string, _ map[string]string) (string, error) {
+func (f *fakeCloudFormation) CreateStack(_ context.Context, name string, template string, parameters map[string]string, tags map[string]string) (string, error) {
 	f.createdStacks = append(f.createdStacks, name)
+	f.lastTemplate = template
+	f.lastParameters = parameters
+	f.lastTags = tags
 	if f.createError != nil {
 		return "", f.createError
 	}
@@ -34,6 +45,9 @@ func (f *fakeCloudFormation) CreateStack(_ context.Context, name string, _ strin
 
 func (f *fakeCloudFormation) DeleteStack(_ context.Context, name string) error {
 	f.deletedStacks = append(f.deletedStacks, name)
+	if f.callLog != nil {
+		*f.callLog = append(*f.callLog, "DeleteStack "+name)
+	}
 	return f.deleteError
 }
 
@@ -52,19 +66,43 @@ func (f *fakeCloudFormation) DescribeStack(_ context.Context, _ string) (*StackO
 	return f.stackOutput, nil
 }
 
+func (f *fakeCloudFormation) ListStacks(_ context.Context) ([]StackSummary, error) {
+	if f.listError != nil {
+		return nil, f.listError
+	}
+	return f.stacks, nil
+}
+
 type fakeEC2 struct {
-	defaultVPCID    string
-	subnetID        string
-	networkStack    *NetworkStack
-	instanceState   string
-	instanceIP      string
-	findVPCError    error
-	findSubnetError error
-	createNetError  error
-	deleteNetError  error
-	stoppedInstances []string
-	startedInstances []string
-	deletedNetworks  []*NetworkStack
+	defaultVPCID       string
+	subnetID           string
+	networkStack       *NetworkStack
+	instanceState      string
+	instanceIP         string
+	findVPCError       error
+	findSubnetError    error
+	createNetError     error
+	deleteNetError     error
+	describeError      error
+	describedInstances []string
+	stoppedInstances   []string
+	startedInstances   []string
+	deletedNetworks    []*NetworkStack
+	authorizedRules    []IngressRule
+	revokedRules       []IngressRule
+	ingressError       error
+	networkTags        map[string]string
+	spotStatus         *provider.SpotStatus
+	spotError          error
+	imageName          string
+	imageTags          map[string]string
+	imageError         error
+	deregistered       []string
+	deletedSnapshots   []string
+	replacedRoots      []string
+	cancelledSpot      []string
+	cancelSpotError    error
+	callLog            *[]string
 }
 
 func (f *fakeEC2) FindDefaultVPC(_ context.Context) (string, error) {
@@ -81,7 +119,8 @@ func (f *fakeEC2) FindPublicSubnet(_ context.Context, _ string) (string, error)
 	return f.subnetID, nil
 }
 
-func (f *fakeEC2) CreateNetworkStack(_ context.Context) (*NetworkStack, error) {
+func (f *fakeEC2) CreateNetworkStack(_ context.Context, tags map[string]string) (*NetworkStack, error) {
+	f.networkTags = tags
 	if f.createNetError != nil {
 		return nil, f.createNetError
 	}
@@ -103,10 +142,76 @@ func (f *fakeEC2) StartInstance(_ context.Context, instanceID string) error {
 	return nil
 }
 
-func (f *fakeEC2) DescribeInstance(_ context.Context, _ string) (string, string, error) {
+func (f *fakeEC2) DescribeInstance(_ context.Context, instanceID string) (string, string, error) {
+	f.describedInstances = append(f.describedInstances, instanceID)
+	if f.describeError != nil {
+		return "", "", f.describeError
+	}
 	return f.instanceState, f.instanceIP, nil
 }
 
+func (f *fakeEC2) AuthorizeIngress(_ context.Context, _ string, rules []IngressRule) error {
+	if f.ingressError != nil {
+		return f.ingressError
+	}
+	f.authorizedRules = append(f.authorizedRules, rules...)
+	return nil
+}
+
+func (f *fakeEC2) DescribeSpotRequest(_ context.Context, _ string) (*provider.SpotStatus, error) {
+	if f.spotError != nil {
+		return nil, f.spotError
+	}
+	return f.spotStatus, nil
+}
+
+func (f *fakeEC2) CreateImage(_ context.Context, _ string, name string, tags map[string]string) (string, error) {
+	f.imageName = name
+	f.imageTags = tags
+	return "ami-0fedcba987654321", nil
+}
+
+func (f *fakeEC2) WaitForImage(_ context.Context, _ string) ([]string, error) {
+	if f.imageError != nil {
+		return nil, f.imageError
+	}
+	return []string{"snap-0123456789abcdef0"}, nil
+}
+
+func (f *fakeEC2) DeregisterImage(_ context.Context, imageID string) error {
+	f.deregistered = append(f.deregistered, imageID)
+	return nil
+}
+
+func (f *fakeEC2) DeleteSnapshot(_ context.Context, snapshotID string) error {
+	f.deletedSnapshots = append(f.deletedSnapshots, snapshotID)
+	return nil
+}
+
+func (f *fakeEC2) ReplaceRootVolume(_ context.Context, instanceID string, imageID string) error {
+	f.replacedRoots = append(f.replacedRoots, instanceID+"="+imageID)
+	return nil
+}
+
+func (f *fakeEC2) CancelSpotRequest(_ context.Context, requestID string) error {
+	if f.cancelSpotError != nil {
+		return f.cancelSpotError
+	}
+	f.cancelledSpot = append(f.cancelledSpot, requestID)
+	if f.callLog != nil {
+		*f.callLog = append(*f.callLog, "CancelSpotRequest "+requestID)
+	}
+	return nil
+}
+
+func (f *fakeEC2) RevokeIngress(_ context.Context, _ string, rules []IngressRule) error {
+	if f.ingressError != nil {
+		return f.ingressError
+	}
+	f.revokedRules = append(f.revokedRules, rules...)
+	return nil
+}
+
 type fakeRoute53 struct {
 	zoneID           string
 	findZoneError    error
@@ -187,6 +292,9 @@ func newFakeProvider() (*Provider, *fakeCloudFormation, *fakeEC2, *fakeRoute53,
 		},
 	}
 	provider := NewWithClients("us-east-1", cloudFormation, ec2, route53, ssm)
+	provider.LookupPublicIP = func(context.Context) (string, error) {
+		return "198.51.100.7/32", nil
+	}
 	return provider, cloudFormation, ec2, route53, ssm
 }
 
@@ -212,6 +320,24 @@ func TestNewSetsRegion(t *testing.T) {
 	}
 }
 
+func TestDefaultRegionFromEnvironment(t *testing.T) {
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "missing"))
+	t.Setenv("AWS_REGION", "ap-southeast-2")
+	if region := DefaultRegion(context.Background()); region != "ap-southeast-2" {
+		t.Errorf("DefaultRegion() = %q, want %q", region, "ap-southeast-2")
+	}
+}
+
+func TestDefaultRegionFallback(t *testing.T) {
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "missing"))
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_PROFILE", "")
+	if region := DefaultRegion(context.Background()); region != config.DefaultRegion {
+		t.Errorf("DefaultRegion() = %q, want %q", region, config.DefaultRegion)
+	}
+}
+
 func TestCreateWithDefaultVPC(t *testing.T) {
 	provider, cloudFormation, _, _, _ := newFakeProvider()
 	cloudInitPath := createCloudInitFile(t)
@@ -255,6 +381,94 @@ func TestCreateWithDefaultVPC(t *testing.T) {
 	}
 }
 
+func TestCreateWithNewElasticIP(t *testing.T) {
+	provider, cloudFormation, _, _, _ := newFakeProvider()
+	cloudFormation.stackOutput.PublicIP = "3.3.3.3"
+	cloudFormation.stackOutput.ElasticIPAllocationID = "eipalloc-0123456789abcdef0"
+	cloudInitPath := createCloudInitFile(t)
+
+	configuration := &config.Config{
+		VM: &config.VMConfig{Name: "devbox", InstanceType: "t3.micro", ElasticIP: true},
+	}
+	if err := provider.Create(context.Background(), configuration, cloudInitPath); err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+
+	template, err := parseTemplate(cloudFormation.lastTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !template.hasResource("ElasticIP", "AWS::EC2::EIP") {
+		t.Error("template should allocate an Elastic IP")
+	}
+	if !template.hasResource("ElasticIPAssociation", "AWS::EC2::EIPAssociation") {
+		t.Error("template should associate the Elastic IP with the instance")
+	}
+	if configuration.AWS.ElasticIPAllocationID != "eipalloc-0123456789abcdef0" {
+		t.Errorf("ElasticIPAllocationID = %q, want %q", configuration.AWS.ElasticIPAllocationID, "eipalloc-0123456789abcdef0")
+	}
+	if !configuration.AWS.CreatedElasticIP {
+		t.Error("CreatedElasticIP should be true for an Elastic IP allocated by the stack")
+	}
+	if configuration.AWS.PublicIP != "3.3.3.3" {
+		t.Errorf("PublicIP = %q, want %q", configuration.AWS.PublicIP, "3.3.3.3")
+	}
+}
+
+func TestCreateWithExistingElasticIP(t *testing.T) {
+	provider, cloudFormation, ec2, _, _ := newFakeProvider()
+	cloudFormation.stackOutput.ElasticIPAllocationID = "eipalloc-0fedcba9876543210"
+	ec2.instanceIP = "4.4.4.4"
+	cloudInitPath := createCloudInitFile(t)
+
+	configuration := &config.Config{
+		VM: &config.VMConfig{Name: "devbox", InstanceType: "t3.micro", ElasticIPAllocationID: "eipalloc-0fedcba9876543210"},
+	}
+	if err := provider.Create(context.Background(), configuration, cloudInitPath); err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+
+	template, err := parseTemplate(cloudFormation.lastTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := template.Resources["ElasticIP"]; exists {
+		t.Error("template should not allocate a new Elastic IP when attaching an existing allocation")
+	}
+	association := template.Resources["ElasticIPAssociation"]
+	if association.Properties["AllocationId"] != "eipalloc-0fedcba9876543210" {
+		t.Errorf("ElasticIPAssociation AllocationId = %v", association.Properties["AllocationId"])
+	}
+	if configuration.AWS.CreatedElasticIP {
+		t.Error("CreatedElasticIP should be false for an existing allocation")
+	}
+	if configuration.AWS.PublicIP != "4.4.4.4" {
+		t.Errorf("PublicIP = %q, want the associated address %q", configuration.AWS.PublicIP, "4.4.4.4")
+	}
+}
+
+func TestCreateWithoutElasticIPOmitsResources(t *testing.T) {
+	provider, cloudFormation, _, _, _ := newFakeProvider()
+	cloudInitPath := createCloudInitFile(t)
+
+	configuration := &config.Config{VM: &config.VMConfig{Name: "devbox", InstanceType: "t3.micro"}}
+	if err := provider.Create(context.Background(), configuration, cloudInitPath); err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+	template, err := parseTemplate(cloudFormation.lastTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ElasticIP", "ElasticIPAssociation"} {
+		if _, exists := template.Resources[name]; exists {
+			t.Errorf("resource %s should not be in the template without elastic_ip", name)
+		}
+	}
+	if configuration.AWS.ElasticIPAllocationID != "" {
+		t.Errorf("ElasticIPAllocationID = %q, want empty", configuration.AWS.ElasticIPAllocationID)
+	}
+}
+
 func TestCreateDefaultsToUbuntu2404(t *testing.T) {
 	provider, _, _, _, _ := newFakeProvider()
 	cloudInitPath := createCloudInitFile(t)
@@ -317,6 +531,49 @@ func TestCreateWithDNS(t *testing.T) {
 	}
 }
 
+func TestCreateWithLocalOnlyDNSSkipsRoute53(t *testing.T) {
+	provider, _, _, route53, _ := newFakeProvider()
+	cloudInitPath := createCloudInitFile(t)
+
+	configuration := &config.Config{
+		VM: &config.VMConfig{
+			Name:         "devbox",
+			InstanceType: "t3.micro",
+		},
+		DNS: &config.DNSConfig{
+			Hostname:  "devbox",
+			Domain:    "example.internal",
+			LocalOnly: true,
+		},
+	}
+
+	err := provider.Create(context.Background(), configuration, cloudInitPath)
+	if err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+
+	if configuration.AWS.ZoneID != "" || configuration.AWS.FQDN != "" {
+		t.Errorf("expected no Route53 state, got ZoneID=%q FQDN=%q", configuration.AWS.ZoneID, configuration.AWS.FQDN)
+	}
+	if len(route53.upsertedRecords) != 0 {
+		t.Errorf("expected no upserted records, got %v", route53.upsertedRecords)
+	}
+}
+
+func TestSwapDNSFailsWithLocalOnlyDNS(t *testing.T) {
+	provider, _, _, _, _ := newFakeProvider()
+
+	configuration := &config.Config{
+		VM:  &config.VMConfig{Name: "devbox"},
+		DNS: &config.DNSConfig{Domain: "example.internal", LocalOnly: true},
+		AWS: &config.AWSState{PublicIP: "54.1.2.3"},
+	}
+
+	if err := provider.SwapDNS(context.Background(), configuration); err == nil {
+		t.Fatal("SwapDNS() should return error for local_only DNS")
+	}
+}
+
 func TestCreateCreatesNetworkWhenNoDefaultVPC(t *testing.T) {
 	provider, _, ec2, _, _ := newFakeProvider()
 	ec2.findVPCError = fmt.Errorf("no default VPC")
@@ -598,6 +855,119 @@ func TestStatusFailsWithoutInstanceID(t *testing.T) {
 	}
 }
 
+func TestListResolvesInstanceState(t *testing.T) {
+	provider, cloudFormation, ec2, _, _ := newFakeProvider()
+	cloudFormation.stacks = []StackSummary{
+		{
+			Name:    "goloo-devbox",
+			Status:  "CREATE_COMPLETE",
+			Outputs: StackOutput{InstanceID: "i-0123456789abcdef0", PublicIP: "54.9.9.9"},
+		},
+		{
+			Name:    "team-web",
+			Status:  "CREATE_COMPLETE",
+			Tags:    map[string]string{"goloo:name": "web"},
+			Outputs: StackOutput{InstanceID: "i-0fedcba9876543210"},
+		},
+	}
+
+	statuses, err := provider.List(context.Background())
+	if err != nil {
+		t.Fatalf("List() returned error: %v", err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("expected 2 VMs, got %d", len(statuses))
+	}
+	if statuses[0].Name != "devbox" || statuses[1].Name != "web" {
+		t.Errorf("names = [%s %s], want [devbox web]", statuses[0].Name, statuses[1].Name)
+	}
+	for _, status := range statuses {
+		if status.State != "running" {
+			t.Errorf("%s: State = %q, want %q", status.Name, status.State, "running")
+		}
+		if status.IP != "54.1.2.3" {
+			t.Errorf("%s: IP = %q, want %q", status.Name, status.IP, "54.1.2.3")
+		}
+		if status.Provider != "aws" {
+			t.Errorf("%s: Provider = %q, want %q", status.Name, status.Provider, "aws")
+		}
+	}
+	if len(ec2.describedInstances) != 2 {
+		t.Errorf("expected 2 DescribeInstance calls, got %v", ec2.describedInstances)
+	}
+}
+
+func TestListStackWithoutInstanceUsesStackStatus(t *testing.T) {
+	provider, cloudFormation, ec2, _, _ := newFakeProvider()
+	cloudFormation.stacks = []StackSummary{
+		{Name: "goloo-devbox", Status: "CREATE_IN_PROGRESS"},
+	}
+
+	statuses, err := provider.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].State != "create_in_progress" {
+		t.Errorf("expected one VM in create_in_progress, got %v", statuses)
+	}
+	if len(ec2.describedInstances) != 0 {
+		t.Errorf("DescribeInstance should not be called without an instance ID, got %v", ec2.describedInstances)
+	}
+}
+
+func TestListMarksUnknownWhenDescribeFails(t *testing.T) {
+	provider, cloudFormation, ec2, _, _ := newFakeProvider()
+	cloudFormation.stacks = []StackSummary{
+		{Name: "goloo-devbox", Status: "CREATE_COMPLETE", Outputs: StackOutput{InstanceID: "i-0123456789abcdef0"}},
+	}
+	ec2.describeError = fmt.Errorf("instance not found")
+
+	statuses, err := provider.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].State != "unknown" {
+		t.Errorf("expected one VM in unknown state, got %v", statuses)
+	}
+}
+
+func TestListFailsOnStackError(t *testing.T) {
+	provider, cloudFormation, _, _, _ := newFakeProvider()
+	cloudFormation.listError = fmt.Errorf("access denied")
+
+	if _, err := provider.List(context.Background()); err == nil {
+		t.Fatal("expected error when ListStacks fails")
+	}
+}
+
+func TestIsGolooStack(t *testing.T) {
+	cases := []struct {
+		name string
+		tags map[string]string
+		want bool
+	}{
+		{"goloo-devbox", nil, true},
+		{"other-stack", nil, false},
+		{"other-stack", map[string]string{"goloo:name": "devbox"}, true},
+		{"other-stack", map[string]string{"ManagedBy": "goloo"}, true},
+		{"other-stack", map[string]string{"ManagedBy": "terraform"}, false},
+	}
+	for _, tc := range cases {
+		if got := IsGolooStack(tc.name, tc.tags); got != tc.want {
+			t.Errorf("IsGolooStack(%q, %v) = %v, want %v", tc.name, tc.tags, got, tc.want)
+		}
+	}
+}
+
+func TestVMNameFromStack(t *testing.T) {
+	if got := VMNameFromStack("goloo-devbox", nil); got != "devbox" {
+		t.Errorf("VMNameFromStack() = %q, want %q", got, "devbox")
+	}
+	if got := VMNameFromStack("goloo-devbox", map[string]string{"goloo:name": "web"}); got != "web" {
+		t.Errorf("VMNameFromStack() with tag = %q, want %q", got, "web")
+	}
+}
+
 func TestStopCallsEC2(t *testing.T) {
 	provider, _, ec2, _, _ := newFakeProvider()
 
@@ -662,7 +1032,7 @@ func TestSSHFailsWithoutPublicIP(t *testing.T) {
 		VM: &config.VMConfig{Name: "devbox"},
 	}
 
-	err := provider.SSH(context.Background(), configuration)
+	err := provider.SSH(context.Background(), configuration, nil)
 	if err == nil {
 		t.Fatal("SSH() should return error when no public IP")
 	}
@@ -1002,32 +1372,32 @@ func TestSwapDNSWithApexAndCNAME(t *testing.T) {
 }
 
 func TestSSHUsernameForUbuntu(t *testing.T) {
-	if sshUsername("ubuntu-24.04") != "ubuntu" {
-		t.Errorf("SSH username for ubuntu-24.04 = %q, want %q", sshUsername("ubuntu-24.04"), "ubuntu")
+	if SSHUsername("ubuntu-24.04") != "ubuntu" {
+		t.Errorf("SSH username for ubuntu-24.04 = %q, want %q", SSHUsername("ubuntu-24.04"), "ubuntu")
 	}
-	if sshUsername("ubuntu-22.04") != "ubuntu" {
-		t.Errorf("SSH username for ubuntu-22.04 = %q, want %q", sshUsername("ubuntu-22.04"), "ubuntu")
+	if SSHUsername("ubuntu-22.04") != "ubuntu" {
+		t.Errorf("SSH username for ubuntu-22.04 = %q, want %q", SSHUsername("ubuntu-22.04"), "ubuntu")
 	}
 }
 
 func TestSSHUsernameForAmazonLinux(t *testing.T) {
-	if sshUsername("amazon-linux-2023") != "ec2-user" {
-		t.Errorf("SSH username for amazon-linux-2023 = %q, want %q", sshUsername("amazon-linux-2023"), "ec2-user")
+	if SSHUsername("amazon-linux-2023") != "ec2-user" {
+		t.Errorf("SSH username for amazon-linux-2023 = %q, want %q", SSHUsername("amazon-linux-2023"), "ec2-user")
 	}
-	if sshUsername("amazon-linux-2") != "ec2-user" {
-		t.Errorf("SSH username for amazon-linux-2 = %q, want %q", sshUsername("amazon-linux-2"), "ec2-user")
+	if SSHUsername("amazon-linux-2") != "ec2-user" {
+		t.Errorf("SSH username for amazon-linux-2 = %q, want %q", SSHUsername("amazon-linux-2"), "ec2-user")
 	}
 }
 
 func TestSSHUsernameForDebian(t *testing.T) {
-	if sshUsername("debian-12") != "admin" {
-		t.Errorf("SSH username for debian-12 = %q, want %q", sshUsername("debian-12"), "admin")
+	if SSHUsername("debian-12") != "admin" {
+		t.Errorf("SSH username for debian-12 = %q, want %q", SSHUsername("debian-12"), "admin")
 	}
 }
 
 func TestSSHUsernameDefaultsToUbuntu(t *testing.T) {
-	if sshUsername("") != "ubuntu" {
-		t.Errorf("SSH username for empty OS = %q, want %q", sshUsername(""), "ubuntu")
+	if SSHUsername("") != "ubuntu" {
+		t.Errorf("SSH username for empty OS = %q, want %q", SSHUsername(""), "ubuntu")
 	}
 }
 
@@ -1066,27 +1436,125 @@ func TestSupportedOperatingSystems(t *testing.T) {
 	}
 }
 
+func generateAndParse(t *testing.T, options TemplateOptions) *Template {
+	t.Helper()
+	body, err := GenerateTemplate(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := parseTemplate(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return template
+}
+
+func parseTemplate(body string) (*Template, error) {
+	var template Template
+	if err := json.Unmarshal([]byte(body), &template); err != nil {
+		return nil, fmt.Errorf("failed to parse CloudFormation template: %w", err)
+	}
+	return &template, nil
+}
+
+func (t *Template) hasResource(name, resourceType string) bool {
+	resource, exists := t.Resources[name]
+	return exists && resource.Type == resourceType
+}
+
 func TestGenerateTemplateContainsUserData(t *testing.T) {
-	template := GenerateTemplate("base64encodeddata")
-	if !strings.Contains(template, "base64encodeddata") {
-		t.Error("GenerateTemplate() should embed UserData in template")
+	template := generateAndParse(t, TemplateOptions{UserData: "base64encodeddata"})
+	if template.Resources["EC2Instance"].Properties["UserData"] != "base64encodeddata" {
+		t.Error("GenerateTemplate() should embed UserData in the instance properties")
 	}
 }
 
 func TestGenerateTemplateContainsRequiredResources(t *testing.T) {
-	template := GenerateTemplate("test")
-	if !TemplateContainsResource(template, "SSHSecurityGroup") {
+	template := generateAndParse(t, TemplateOptions{UserData: "test"})
+	if !template.hasResource("SSHSecurityGroup", "AWS::EC2::SecurityGroup") {
 		t.Error("Template should contain SSHSecurityGroup resource")
 	}
-	if !TemplateContainsResource(template, "EC2Instance") {
+	if !template.hasResource("EC2Instance", "AWS::EC2::Instance") {
 		t.Error("Template should contain EC2Instance resource")
 	}
+	if len(template.Resources) != 2 {
+		t.Errorf("expected only the required resources by default, got %d", len(template.Resources))
+	}
+}
+
+func TestGenerateTemplateWithElasticIP(t *testing.T) {
+	template := generateAndParse(t, TemplateOptions{UserData: "test", ElasticIP: true})
+	if !template.hasResource("ElasticIP", "AWS::EC2::EIP") {
+		t.Error("Template should contain ElasticIP resource")
+	}
+	if !template.hasResource("ElasticIPAssociation", "AWS::EC2::EIPAssociation") {
+		t.Error("Template should contain ElasticIPAssociation resource")
+	}
+	if _, exists := template.Outputs["ElasticIPAllocationId"]; !exists {
+		t.Error("Template should output ElasticIPAllocationId")
+	}
+}
+
+func TestGenerateTemplateWithExistingInstanceProfile(t *testing.T) {
+	template := generateAndParse(t, TemplateOptions{UserData: "test", InstanceProfile: "arn:aws:iam::123456789012:instance-profile/dev/devbox-profile"})
+	if template.Resources["EC2Instance"].Properties["IamInstanceProfile"] != "devbox-profile" {
+		t.Errorf("IamInstanceProfile = %v, want the profile name", template.Resources["EC2Instance"].Properties["IamInstanceProfile"])
+	}
+	if _, exists := template.Resources["InstanceRole"]; exists {
+		t.Error("an existing instance profile should not generate a role")
+	}
+}
+
+func TestGenerateTemplateWithManagedPolicies(t *testing.T) {
+	policies := []string{"arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess", "arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly"}
+	template := generateAndParse(t, TemplateOptions{UserData: "test", ManagedPolicies: policies})
+
+	if !template.hasResource("InstanceRole", "AWS::IAM::Role") {
+		t.Fatal("Template should contain InstanceRole resource")
+	}
+	if !template.hasResource("InstanceProfile", "AWS::IAM::InstanceProfile") {
+		t.Fatal("Template should contain InstanceProfile resource")
+	}
+	attached, _ := template.Resources["InstanceRole"].Properties["ManagedPolicyArns"].([]interface{})
+	if len(attached) != 2 || attached[0] != policies[0] || attached[1] != policies[1] {
+		t.Errorf("ManagedPolicyArns = %v, want %v", attached, policies)
+	}
+	profile, _ := template.Resources["EC2Instance"].Properties["IamInstanceProfile"].(map[string]interface{})
+	if profile["Ref"] != "InstanceProfile" {
+		t.Errorf("IamInstanceProfile = %v, want Ref InstanceProfile", profile)
+	}
+}
+
+func TestCreateRecordsInstanceProfile(t *testing.T) {
+	provider, cloudFormation, _, _, _ := newFakeProvider()
+	cloudFormation.stackOutput.InstanceProfile = "goloo-devbox-InstanceProfile-ABC123"
+	cloudInitPath := createCloudInitFile(t)
+
+	configuration := &config.Config{VM: &config.VMConfig{
+		Name:         "devbox",
+		InstanceType: "t3.micro",
+		IAM:          &config.IAMConfig{ManagedPolicies: []string{"arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess"}},
+	}}
+	if err := provider.Create(context.Background(), configuration, cloudInitPath); err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+
+	template, err := parseTemplate(cloudFormation.lastTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !template.hasResource("InstanceRole", "AWS::IAM::Role") {
+		t.Error("stack template should declare the instance role")
+	}
+	if configuration.AWS.InstanceProfile != "goloo-devbox-InstanceProfile-ABC123" {
+		t.Errorf("InstanceProfile = %q", configuration.AWS.InstanceProfile)
+	}
 }
 
 func TestGenerateTemplateContainsOutputs(t *testing.T) {
-	template := GenerateTemplate("test")
-	for _, output := range []string{"InstanceId:", "PublicIP:", "SecurityGroupId:"} {
-		if !strings.Contains(template, output) {
+	template := generateAndParse(t, TemplateOptions{UserData: "test"})
+	for _, output := range []string{"InstanceId", "PublicIP", "SecurityGroupId"} {
+		if _, exists := template.Outputs[output]; !exists {
 			t.Errorf("Template should contain output %s", output)
 		}
 	}
@@ -1117,3 +1585,81 @@ func TestAllAMIPathsStartWithAWSServicePrefix(t *testing.T) {
 		}
 	}
 }
+
+func TestExecFailsWithoutPublicIP(t *testing.T) {
+	provider := New("us-east-1")
+	configuration := &config.Config{VM: &config.VMConfig{Name: "devbox"}}
+
+	if _, err := provider.Exec(context.Background(), configuration, []string{"true"}); err == nil {
+		t.Fatal("Exec() should return error when no public IP")
+	}
+	if err := provider.CopyTo(context.Background(), configuration, "a", "/tmp/a"); err == nil {
+		t.Fatal("CopyTo() should return error when no public IP")
+	}
+}
+
+func TestBuildSSHArgsQuotesRemoteCommand(t *testing.T) {
+	arguments := BuildSSHArgs(nil, "ubuntu@54.1.2.3", []string{"echo", "hello world", "it's", "$HOME"})
+	last := arguments[len(arguments)-1]
+	want := `echo 'hello world' 'it'\''s' '$HOME'`
+	if last != want {
+		t.Errorf("remote command = %s, want %s", last, want)
+	}
+	if arguments[len(arguments)-2] != "ubuntu@54.1.2.3" {
+		t.Errorf("target should precede the remote command: %v", arguments)
+	}
+	if !strings.Contains(strings.Join(arguments, " "), "BatchMode=yes") {
+		t.Errorf("non-interactive ssh should use BatchMode: %v", arguments)
+	}
+}
+
+func TestBuildSCPArgs(t *testing.T) {
+	arguments := BuildSCPArgs(nil, "./app", "ubuntu@54.1.2.3:/opt/app")
+	if arguments[0] != "-r" {
+		t.Errorf("scp should copy recursively: %v", arguments)
+	}
+	if arguments[len(arguments)-2] != "./app" || arguments[len(arguments)-1] != "ubuntu@54.1.2.3:/opt/app" {
+		t.Errorf("unexpected scp arguments: %v", arguments)
+	}
+}
+
+func TestBuildSSHArgsHonoursSSHConfig(t *testing.T) {
+	sshConfig := &config.SSHConfig{
+		IdentityFile: "/keys/bastion",
+		Port:         2222,
+		ProxyJump:    "jump@bastion.example.com",
+		Options:      map[string]string{"ServerAliveInterval": "30"},
+	}
+	arguments := strings.Join(BuildSSHArgs(sshConfig, "ubuntu@10.0.1.5", []string{"uptime"}), " ")
+	for _, want := range []string{"-i /keys/bastion", "-p 2222", "-J jump@bastion.example.com", "-o ServerAliveInterval=30", "ubuntu@10.0.1.5 uptime"} {
+		if !strings.Contains(arguments, want) {
+			t.Errorf("ssh arguments %q missing %q", arguments, want)
+		}
+	}
+
+	scpArguments := strings.Join(BuildSCPArgs(sshConfig, "a", "ubuntu@10.0.1.5:/tmp/a"), " ")
+	if !strings.Contains(scpArguments, "-P 2222") || strings.Contains(scpArguments, "-p 2222") {
+		t.Errorf("scp should use -P for the port: %q", scpArguments)
+	}
+}
+
+func TestSSHTargetUsesUserOverride(t *testing.T) {
+	configuration := &config.Config{
+		VM:  &config.VMConfig{Name: "web", OS: "amazon-linux-2023"},
+		SSH: &config.SSHConfig{User: "deploy"},
+		AWS: &config.AWSState{PublicIP: "54.1.2.3"},
+	}
+	target, err := sshTarget(configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "deploy@54.1.2.3" {
+		t.Errorf("sshTarget() = %q, want deploy@54.1.2.3", target)
+	}
+
+	configuration.SSH = nil
+	target, _ = sshTarget(configuration)
+	if target != "ec2-user@54.1.2.3" {
+		t.Errorf("sshTarget() = %q, want ec2-user@54.1.2.3", target)
+	}
+}
@@ -1,23 +1,38 @@
 package aws
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/emergingrobotics/goloo/internal/provider"
+)
 
 type CloudFormationClient interface {
-	CreateStack(context context.Context, name string, templateBody string, parameters map[string]string) (string, error)
+	CreateStack(context context.Context, name string, templateBody string, parameters map[string]string, tags map[string]string) (string, error)
 	DeleteStack(context context.Context, name string) error
 	WaitForCreateComplete(context context.Context, name string) error
 	WaitForDeleteComplete(context context.Context, name string) error
 	DescribeStack(context context.Context, name string) (*StackOutput, error)
+	ListStacks(context context.Context) ([]StackSummary, error)
 }
 
 type EC2Client interface {
 	FindDefaultVPC(context context.Context) (string, error)
 	FindPublicSubnet(context context.Context, vpcID string) (string, error)
-	CreateNetworkStack(context context.Context) (*NetworkStack, error)
+	CreateNetworkStack(context context.Context, tags map[string]string) (*NetworkStack, error)
 	DeleteNetworkStack(context context.Context, stack *NetworkStack) error
 	StopInstance(context context.Context, instanceID string) error
 	StartInstance(context context.Context, instanceID string) error
 	DescribeInstance(context context.Context, instanceID string) (string, string, error)
+	AuthorizeIngress(context context.Context, groupID string, rules []IngressRule) error
+	RevokeIngress(context context.Context, groupID string, rules []IngressRule) error
+	DescribeSpotRequest(context context.Context, instanceID string) (*provider.SpotStatus, error)
+	CancelSpotRequest(context context.Context, requestID string) error
+	CreateImage(context context.Context, instanceID string, name string, tags map[string]string) (string, error)
+	WaitForImage(context context.Context, imageID string) ([]string, error)
+	DeregisterImage(context context.Context, imageID string) error
+	DeleteSnapshot(context context.Context, snapshotID string) error
+	ReplaceRootVolume(context context.Context, instanceID string, imageID string) error
 }
 
 type Route53Client interface {
@@ -33,7 +48,17 @@ type SSMClient interface {
 }
 
 type StackOutput struct {
-	InstanceID      string
-	PublicIP        string
-	SecurityGroupID string
+	InstanceID            string
+	PublicIP              string
+	SecurityGroupID       string
+	ElasticIPAllocationID string
+	InstanceProfile       string
+}
+
+type StackSummary struct {
+	Name      string
+	Status    string
+	CreatedAt time.Time
+	Tags      map[string]string
+	Outputs   StackOutput
 }
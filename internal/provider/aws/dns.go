@@ -119,6 +119,9 @@ func (p *Provider) SwapDNS(context context.Context, configuration *config.Config
 	if configuration.DNS == nil || configuration.DNS.Domain == "" {
 		return fmt.Errorf("DNS configuration required for dns swap: add 'dns' section to config")
 	}
+	if configuration.DNS.LocalOnly {
+		return fmt.Errorf("dns.local_only is set: there are no Route53 records to swap (goloo start refreshes the hosts entry)")
+	}
 	if configuration.AWS == nil || configuration.AWS.PublicIP == "" {
 		return fmt.Errorf("no public IP: VM must be running for dns swap")
 	}
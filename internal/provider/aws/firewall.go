@@ -0,0 +1,172 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+const MyIP = "my-ip"
+
+var PublicIPURL = "https://checkip.amazonaws.com"
+
+var PublicIPTimeout = 10 * time.Second
+
+var DefaultFirewall = []config.FirewallRule{
+	{Protocol: "tcp", Port: 22, CIDR: MyIP, Description: "SSH from goloo host"},
+}
+
+type IngressRule struct {
+	Protocol    string
+	FromPort    int
+	ToPort      int
+	CIDR        string
+	Description string
+}
+
+func (r IngressRule) String() string {
+	ports := ""
+	switch {
+	case r.Protocol == "-1":
+		return "all traffic from " + r.CIDR
+	case r.Protocol == "icmp":
+		return "icmp from " + r.CIDR
+	case r.FromPort == r.ToPort:
+		ports = strconv.Itoa(r.FromPort)
+	default:
+		ports = fmt.Sprintf("%d-%d", r.FromPort, r.ToPort)
+	}
+	return fmt.Sprintf("%s %s from %s", r.Protocol, ports, r.CIDR)
+}
+
+func FirewallRules(configuration *config.Config) []config.FirewallRule {
+	if configuration.Firewall == nil {
+		return DefaultFirewall
+	}
+	return configuration.Firewall
+}
+
+func ResolveIngressRules(context context.Context, rules []config.FirewallRule, lookupPublicIP func(context.Context) (string, error)) ([]IngressRule, error) {
+	myIP := ""
+	resolved := make([]IngressRule, 0, len(rules))
+	for _, rule := range rules {
+		if err := config.ValidateFirewallRule(rule); err != nil {
+			return nil, err
+		}
+		cidr := rule.CIDR
+		if cidr == "" || cidr == MyIP {
+			if myIP == "" {
+				if lookupPublicIP == nil {
+					return nil, fmt.Errorf("cannot resolve %q: no public IP lookup configured", MyIP)
+				}
+				ip, err := lookupPublicIP(context)
+				if err != nil {
+					return nil, fmt.Errorf("cannot resolve %q for firewall rules: %w", MyIP, err)
+				}
+				myIP = ip
+			}
+			cidr = myIP
+		}
+		resolved = append(resolved, buildIngressRule(rule, cidr))
+	}
+	return resolved, nil
+}
+
+func buildIngressRule(rule config.FirewallRule, cidr string) IngressRule {
+	ingress := IngressRule{Protocol: rule.Protocol, CIDR: cidr, Description: rule.Description}
+	switch rule.Protocol {
+	case "", "tcp", "udp":
+		if ingress.Protocol == "" {
+			ingress.Protocol = "tcp"
+		}
+		ingress.FromPort = rule.Port
+		ingress.ToPort = rule.Port
+		if rule.ToPort != 0 {
+			ingress.ToPort = rule.ToPort
+		}
+	case "icmp":
+		ingress.FromPort = -1
+		ingress.ToPort = -1
+	case "all":
+		ingress.Protocol = "-1"
+	}
+	return ingress
+}
+
+func DetectPublicIP(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, PublicIPTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, PublicIPURL, nil)
+	if err != nil {
+		return "", err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up public IP: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to look up public IP: %s returned HTTP %d", PublicIPURL, response.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 256))
+	if err != nil {
+		return "", fmt.Errorf("failed to look up public IP: %w", err)
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return "", fmt.Errorf("failed to look up public IP: %s returned %q", PublicIPURL, strings.TrimSpace(string(body)))
+	}
+	if ip.To4() != nil {
+		return ip.String() + "/32", nil
+	}
+	return ip.String() + "/128", nil
+}
+
+func isIPv6CIDR(cidr string) bool {
+	return strings.Contains(cidr, ":")
+}
+
+func (p *Provider) AllowIngress(context context.Context, configuration *config.Config, rules []config.FirewallRule) ([]IngressRule, error) {
+	groupID, resolved, err := p.prepareIngress(context, configuration, rules)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.EC2.AuthorizeIngress(context, groupID, resolved); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+func (p *Provider) RevokeIngress(context context.Context, configuration *config.Config, rules []config.FirewallRule) ([]IngressRule, error) {
+	groupID, resolved, err := p.prepareIngress(context, configuration, rules)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.EC2.RevokeIngress(context, groupID, resolved); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+func (p *Provider) prepareIngress(context context.Context, configuration *config.Config, rules []config.FirewallRule) (string, []IngressRule, error) {
+	if err := p.validateClients(); err != nil {
+		return "", nil, err
+	}
+	if configuration.AWS == nil || configuration.AWS.SecurityGroup == "" {
+		return "", nil, fmt.Errorf("no security group: VM may not have been created with AWS")
+	}
+	resolved, err := ResolveIngressRules(context, rules, p.LookupPublicIP)
+	if err != nil {
+		return "", nil, err
+	}
+	return configuration.AWS.SecurityGroup, resolved, nil
+}
@@ -0,0 +1,240 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+func fixedPublicIP(ip string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) {
+		return ip, nil
+	}
+}
+
+func TestFirewallRulesDefaultsToSSHFromMyIP(t *testing.T) {
+	rules := FirewallRules(&config.Config{})
+	if len(rules) != 1 || rules[0].Port != 22 || rules[0].CIDR != MyIP {
+		t.Errorf("expected default SSH rule from my-ip, got %+v", rules)
+	}
+
+	explicit := FirewallRules(&config.Config{Firewall: []config.FirewallRule{}})
+	if len(explicit) != 0 {
+		t.Errorf("expected an explicit empty firewall to have no rules, got %+v", explicit)
+	}
+}
+
+func TestResolveIngressRules(t *testing.T) {
+	lookups := 0
+	lookup := func(context.Context) (string, error) {
+		lookups++
+		return "198.51.100.7/32", nil
+	}
+	rules := []config.FirewallRule{
+		{Port: 22},
+		{Protocol: "tcp", Port: 8000, ToPort: 8100, CIDR: "10.0.0.0/8"},
+		{Protocol: "udp", Port: 51820, CIDR: MyIP},
+		{Protocol: "icmp", CIDR: "0.0.0.0/0"},
+		{Protocol: "all", CIDR: "2001:db8::/32"},
+	}
+
+	resolved, err := ResolveIngressRules(context.Background(), rules, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []IngressRule{
+		{Protocol: "tcp", FromPort: 22, ToPort: 22, CIDR: "198.51.100.7/32"},
+		{Protocol: "tcp", FromPort: 8000, ToPort: 8100, CIDR: "10.0.0.0/8"},
+		{Protocol: "udp", FromPort: 51820, ToPort: 51820, CIDR: "198.51.100.7/32"},
+		{Protocol: "icmp", FromPort: -1, ToPort: -1, CIDR: "0.0.0.0/0"},
+		{Protocol: "-1", CIDR: "2001:db8::/32"},
+	}
+	if len(resolved) != len(expected) {
+		t.Fatalf("expected %d rules, got %d", len(expected), len(resolved))
+	}
+	for i := range expected {
+		if resolved[i] != expected[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, resolved[i], expected[i])
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("expected my-ip to be looked up once, got %d", lookups)
+	}
+}
+
+func TestResolveIngressRulesLookupFailure(t *testing.T) {
+	lookup := func(context.Context) (string, error) {
+		return "", fmt.Errorf("offline")
+	}
+	_, err := ResolveIngressRules(context.Background(), []config.FirewallRule{{Port: 22}}, lookup)
+	if err == nil || !strings.Contains(err.Error(), "offline") {
+		t.Errorf("expected lookup error, got %v", err)
+	}
+}
+
+func TestResolveIngressRulesRejectsInvalidRule(t *testing.T) {
+	_, err := ResolveIngressRules(context.Background(), []config.FirewallRule{{Protocol: "gre", Port: 1}}, fixedPublicIP("198.51.100.7/32"))
+	if err == nil {
+		t.Error("expected error for invalid protocol")
+	}
+}
+
+func securityGroupIngress(t *testing.T, body string) []interface{} {
+	t.Helper()
+	template, err := parseTemplate(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !template.hasResource("SSHSecurityGroup", "AWS::EC2::SecurityGroup") {
+		t.Fatal("template has no SSHSecurityGroup")
+	}
+	ingress, _ := template.Resources["SSHSecurityGroup"].Properties["SecurityGroupIngress"].([]interface{})
+	return ingress
+}
+
+func TestGenerateTemplateRendersIngress(t *testing.T) {
+	body, err := GenerateTemplate(TemplateOptions{
+		UserData: "userdata",
+		Ingress: []IngressRule{
+			{Protocol: "tcp", FromPort: 443, ToPort: 443, CIDR: "0.0.0.0/0", Description: "HTTPS"},
+			{Protocol: "-1", CIDR: "2001:db8::/32"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ingress := securityGroupIngress(t, body)
+	if len(ingress) != 2 {
+		t.Fatalf("expected 2 ingress rules, got %d", len(ingress))
+	}
+	https := ingress[0].(map[string]interface{})
+	if https["IpProtocol"] != "tcp" || https["FromPort"] != float64(443) || https["ToPort"] != float64(443) ||
+		https["CidrIp"] != "0.0.0.0/0" || https["Description"] != "HTTPS" {
+		t.Errorf("unexpected HTTPS rule: %v", https)
+	}
+	all := ingress[1].(map[string]interface{})
+	if all["IpProtocol"] != "-1" || all["CidrIpv6"] != "2001:db8::/32" {
+		t.Errorf("unexpected all-traffic rule: %v", all)
+	}
+	if _, hasPort := all["FromPort"]; hasPort {
+		t.Error("all-traffic rule should not set ports")
+	}
+}
+
+func TestGenerateTemplateWithoutIngress(t *testing.T) {
+	body, err := GenerateTemplate(TemplateOptions{UserData: "userdata"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ingress := securityGroupIngress(t, body); len(ingress) != 0 {
+		t.Errorf("expected no SecurityGroupIngress for an empty rule list, got %v", ingress)
+	}
+}
+
+func TestCreateUsesDefaultFirewall(t *testing.T) {
+	provider, cloudFormation, _, _, _ := newFakeProvider()
+	cloudInitPath := createCloudInitFile(t)
+
+	configuration := &config.Config{VM: &config.VMConfig{Name: "devbox", InstanceType: "t3.micro"}}
+	if err := provider.Create(context.Background(), configuration, cloudInitPath); err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+
+	ingress := securityGroupIngress(t, cloudFormation.lastTemplate)
+	if len(ingress) != 1 {
+		t.Fatalf("expected only the default SSH rule, got %v", ingress)
+	}
+	ssh := ingress[0].(map[string]interface{})
+	if ssh["FromPort"] != float64(22) || ssh["ToPort"] != float64(22) || ssh["CidrIp"] != "198.51.100.7/32" {
+		t.Errorf("expected SSH from the caller's IP, got %v", ssh)
+	}
+}
+
+func TestCreateFailsWhenMyIPCannotBeResolved(t *testing.T) {
+	provider, cloudFormation, _, _, _ := newFakeProvider()
+	provider.LookupPublicIP = func(context.Context) (string, error) {
+		return "", fmt.Errorf("offline")
+	}
+	cloudInitPath := createCloudInitFile(t)
+
+	configuration := &config.Config{VM: &config.VMConfig{Name: "devbox", InstanceType: "t3.micro"}}
+	if err := provider.Create(context.Background(), configuration, cloudInitPath); err == nil {
+		t.Fatal("Create() should fail when my-ip cannot be resolved")
+	}
+	if len(cloudFormation.createdStacks) != 0 {
+		t.Error("no stack should be created when firewall rules cannot be resolved")
+	}
+}
+
+func TestAllowAndRevokeIngress(t *testing.T) {
+	provider, _, ec2, _, _ := newFakeProvider()
+	configuration := &config.Config{
+		VM:  &config.VMConfig{Name: "devbox"},
+		AWS: &config.AWSState{SecurityGroup: "sg-0123456789abcdef0"},
+	}
+	rules := []config.FirewallRule{{Protocol: "tcp", Port: 443, CIDR: "0.0.0.0/0"}}
+
+	allowed, err := provider.AllowIngress(context.Background(), configuration, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allowed) != 1 || len(ec2.authorizedRules) != 1 || ec2.authorizedRules[0].FromPort != 443 {
+		t.Errorf("expected 443 to be authorized, got %+v", ec2.authorizedRules)
+	}
+	if allowed[0].String() != "tcp 443 from 0.0.0.0/0" {
+		t.Errorf("unexpected rule description %q", allowed[0].String())
+	}
+
+	if _, err := provider.RevokeIngress(context.Background(), configuration, rules); err != nil {
+		t.Fatal(err)
+	}
+	if len(ec2.revokedRules) != 1 || ec2.revokedRules[0].CIDR != "0.0.0.0/0" {
+		t.Errorf("expected 443 to be revoked, got %+v", ec2.revokedRules)
+	}
+}
+
+func TestAllowIngressRequiresSecurityGroup(t *testing.T) {
+	provider, _, _, _, _ := newFakeProvider()
+	configuration := &config.Config{VM: &config.VMConfig{Name: "devbox"}, AWS: &config.AWSState{}}
+	if _, err := provider.AllowIngress(context.Background(), configuration, []config.FirewallRule{{Port: 22}}); err == nil {
+		t.Error("expected error without a security group")
+	}
+}
+
+func TestDetectPublicIP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "203.0.113.9")
+	}))
+	defer server.Close()
+	original := PublicIPURL
+	PublicIPURL = server.URL
+	defer func() { PublicIPURL = original }()
+
+	cidr, err := DetectPublicIP(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cidr != "203.0.113.9/32" {
+		t.Errorf("DetectPublicIP() = %q, want %q", cidr, "203.0.113.9/32")
+	}
+}
+
+func TestDetectPublicIPRejectsGarbage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "<html>captive portal</html>")
+	}))
+	defer server.Close()
+	original := PublicIPURL
+	PublicIPURL = server.URL
+	defer func() { PublicIPURL = original }()
+
+	if _, err := DetectPublicIP(context.Background()); err == nil {
+		t.Error("expected error for a non-IP response")
+	}
+}
@@ -1,6 +1,15 @@
 package aws
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	stackNamePrefix = "goloo-"
+	vmNameTag       = "goloo:name"
+	managedByTag    = "ManagedBy"
+)
 
 type NetworkStack struct {
 	VpcID                 string
@@ -11,7 +20,24 @@ type NetworkStack struct {
 }
 
 func BuildStackName(vmName string) string {
-	return fmt.Sprintf("goloo-%s", vmName)
+	return fmt.Sprintf("%s%s", stackNamePrefix, vmName)
+}
+
+func IsGolooStack(stackName string, tags map[string]string) bool {
+	if _, exists := tags[vmNameTag]; exists {
+		return true
+	}
+	if tags[managedByTag] == "goloo" {
+		return true
+	}
+	return strings.HasPrefix(stackName, stackNamePrefix)
+}
+
+func VMNameFromStack(stackName string, tags map[string]string) string {
+	if name := tags[vmNameTag]; name != "" {
+		return name
+	}
+	return strings.TrimPrefix(stackName, stackNamePrefix)
 }
 
 func BuildNetworkStackName(vmName string) string {
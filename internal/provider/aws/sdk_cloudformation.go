@@ -18,7 +18,7 @@ func NewSDKCloudFormationClient(configuration awssdk.Config) CloudFormationClien
 	return &sdkCloudFormationClient{client: cloudformation.NewFromConfig(configuration)}
 }
 
-func (c *sdkCloudFormationClient) CreateStack(context context.Context, name string, templateBody string, parameters map[string]string) (string, error) {
+func (c *sdkCloudFormationClient) CreateStack(context context.Context, name string, templateBody string, parameters map[string]string, tags map[string]string) (string, error) {
 	cfnParameters := make([]types.Parameter, 0, len(parameters))
 	for key, value := range parameters {
 		cfnParameters = append(cfnParameters, types.Parameter{
@@ -27,10 +27,19 @@ func (c *sdkCloudFormationClient) CreateStack(context context.Context, name stri
 		})
 	}
 
+	cfnTags := make([]types.Tag, 0, len(tags))
+	for _, key := range SortedTagKeys(tags) {
+		cfnTags = append(cfnTags, types.Tag{
+			Key:   awssdk.String(key),
+			Value: awssdk.String(tags[key]),
+		})
+	}
+
 	result, err := c.client.CreateStack(context, &cloudformation.CreateStackInput{
 		StackName:    &name,
 		TemplateBody: &templateBody,
 		Parameters:   cfnParameters,
+		Tags:         cfnTags,
 		Capabilities: []types.Capability{
 			types.CapabilityCapabilityIam,
 		},
@@ -76,16 +85,56 @@ func (c *sdkCloudFormationClient) DescribeStack(context context.Context, name st
 		return nil, fmt.Errorf("stack %s not found", name)
 	}
 
+	return parseStackOutputs(result.Stacks[0].Outputs), nil
+}
+
+func (c *sdkCloudFormationClient) ListStacks(context context.Context) ([]StackSummary, error) {
+	var summaries []StackSummary
+	paginator := cloudformation.NewDescribeStacksPaginator(c.client, &cloudformation.DescribeStacksInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context)
+		if err != nil {
+			return nil, fmt.Errorf("CloudFormation DescribeStacks failed: %w", err)
+		}
+		for _, stack := range page.Stacks {
+			tags := make(map[string]string, len(stack.Tags))
+			for _, tag := range stack.Tags {
+				tags[awssdk.ToString(tag.Key)] = awssdk.ToString(tag.Value)
+			}
+			name := awssdk.ToString(stack.StackName)
+			if !IsGolooStack(name, tags) {
+				continue
+			}
+			summary := StackSummary{
+				Name:    name,
+				Status:  string(stack.StackStatus),
+				Tags:    tags,
+				Outputs: *parseStackOutputs(stack.Outputs),
+			}
+			if stack.CreationTime != nil {
+				summary.CreatedAt = *stack.CreationTime
+			}
+			summaries = append(summaries, summary)
+		}
+	}
+	return summaries, nil
+}
+
+func parseStackOutputs(outputs []types.Output) *StackOutput {
 	output := &StackOutput{}
-	for _, stackOutput := range result.Stacks[0].Outputs {
-		switch *stackOutput.OutputKey {
+	for _, stackOutput := range outputs {
+		switch awssdk.ToString(stackOutput.OutputKey) {
 		case "InstanceId":
-			output.InstanceID = *stackOutput.OutputValue
+			output.InstanceID = awssdk.ToString(stackOutput.OutputValue)
 		case "PublicIP":
-			output.PublicIP = *stackOutput.OutputValue
+			output.PublicIP = awssdk.ToString(stackOutput.OutputValue)
 		case "SecurityGroupId":
-			output.SecurityGroupID = *stackOutput.OutputValue
+			output.SecurityGroupID = awssdk.ToString(stackOutput.OutputValue)
+		case "ElasticIPAllocationId":
+			output.ElasticIPAllocationID = awssdk.ToString(stackOutput.OutputValue)
+		case "InstanceProfile":
+			output.InstanceProfile = awssdk.ToString(stackOutput.OutputValue)
 		}
 	}
-	return output, nil
+	return output
 }
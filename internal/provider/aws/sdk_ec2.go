@@ -8,6 +8,8 @@ import (
 	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"github.com/emergingrobotics/goloo/internal/provider"
 )
 
 type sdkEC2Client struct {
@@ -61,7 +63,7 @@ func (e *sdkEC2Client) FindPublicSubnet(context context.Context, vpcID string) (
 	return *result.Subnets[0].SubnetId, nil
 }
 
-func (e *sdkEC2Client) CreateNetworkStack(context context.Context) (*NetworkStack, error) {
+func (e *sdkEC2Client) CreateNetworkStack(context context.Context, tags map[string]string) (*NetworkStack, error) {
 	stack := &NetworkStack{}
 
 	vpcOutput, err := e.client.CreateVpc(context, &ec2.CreateVpcInput{
@@ -69,10 +71,7 @@ func (e *sdkEC2Client) CreateNetworkStack(context context.Context) (*NetworkStac
 		TagSpecifications: []ec2types.TagSpecification{
 			{
 				ResourceType: ec2types.ResourceTypeVpc,
-				Tags: []ec2types.Tag{
-					{Key: awssdk.String("Name"), Value: awssdk.String("goloo-vpc")},
-					{Key: awssdk.String("ManagedBy"), Value: awssdk.String("goloo")},
-				},
+				Tags:         buildEC2Tags(tags, "goloo-vpc"),
 			},
 		},
 	})
@@ -101,10 +100,7 @@ func (e *sdkEC2Client) CreateNetworkStack(context context.Context) (*NetworkStac
 		TagSpecifications: []ec2types.TagSpecification{
 			{
 				ResourceType: ec2types.ResourceTypeInternetGateway,
-				Tags: []ec2types.Tag{
-					{Key: awssdk.String("Name"), Value: awssdk.String("goloo-igw")},
-					{Key: awssdk.String("ManagedBy"), Value: awssdk.String("goloo")},
-				},
+				Tags:         buildEC2Tags(tags, "goloo-igw"),
 			},
 		},
 	})
@@ -144,10 +140,7 @@ func (e *sdkEC2Client) CreateNetworkStack(context context.Context) (*NetworkStac
 		TagSpecifications: []ec2types.TagSpecification{
 			{
 				ResourceType: ec2types.ResourceTypeSubnet,
-				Tags: []ec2types.Tag{
-					{Key: awssdk.String("Name"), Value: awssdk.String("goloo-public-subnet")},
-					{Key: awssdk.String("ManagedBy"), Value: awssdk.String("goloo")},
-				},
+				Tags:         buildEC2Tags(tags, "goloo-public-subnet"),
 			},
 		},
 	})
@@ -169,10 +162,7 @@ func (e *sdkEC2Client) CreateNetworkStack(context context.Context) (*NetworkStac
 		TagSpecifications: []ec2types.TagSpecification{
 			{
 				ResourceType: ec2types.ResourceTypeRouteTable,
-				Tags: []ec2types.Tag{
-					{Key: awssdk.String("Name"), Value: awssdk.String("goloo-public-rt")},
-					{Key: awssdk.String("ManagedBy"), Value: awssdk.String("goloo")},
-				},
+				Tags:         buildEC2Tags(tags, "goloo-public-rt"),
 			},
 		},
 	})
@@ -259,6 +249,20 @@ func (e *sdkEC2Client) DeleteNetworkStack(context context.Context, stack *Networ
 	return nil
 }
 
+func buildEC2Tags(tags map[string]string, name string) []ec2types.Tag {
+	merged := map[string]string{"Name": name, managedByTag: "goloo"}
+	for key, value := range tags {
+		if key != "Name" {
+			merged[key] = value
+		}
+	}
+	ec2Tags := make([]ec2types.Tag, 0, len(merged))
+	for _, key := range SortedTagKeys(merged) {
+		ec2Tags = append(ec2Tags, ec2types.Tag{Key: awssdk.String(key), Value: awssdk.String(merged[key])})
+	}
+	return ec2Tags
+}
+
 func (e *sdkEC2Client) StopInstance(context context.Context, instanceID string) error {
 	_, err := e.client.StopInstances(context, &ec2.StopInstancesInput{
 		InstanceIds: []string{instanceID},
@@ -298,3 +302,183 @@ func (e *sdkEC2Client) DescribeInstance(context context.Context, instanceID stri
 	}
 	return state, publicIP, nil
 }
+
+func (e *sdkEC2Client) DescribeSpotRequest(context context.Context, instanceID string) (*provider.SpotStatus, error) {
+	result, err := e.client.DescribeSpotInstanceRequests(context, &ec2.DescribeSpotInstanceRequestsInput{
+		Filters: []ec2types.Filter{
+			{
+				Name:   awssdk.String("instance-id"),
+				Values: []string{instanceID},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("DescribeSpotInstanceRequests %s failed: %w", instanceID, err)
+	}
+	if len(result.SpotInstanceRequests) == 0 {
+		return nil, fmt.Errorf("no spot request found for instance %s", instanceID)
+	}
+
+	request := result.SpotInstanceRequests[0]
+	status := &provider.SpotStatus{
+		RequestID:    awssdk.ToString(request.SpotInstanceRequestId),
+		RequestState: string(request.State),
+	}
+	if request.Status != nil {
+		status.StatusCode = awssdk.ToString(request.Status.Code)
+		status.Message = awssdk.ToString(request.Status.Message)
+	}
+	status.InterruptionNotice = IsSpotInterruption(status.StatusCode)
+	return status, nil
+}
+
+func (e *sdkEC2Client) CancelSpotRequest(context context.Context, requestID string) error {
+	_, err := e.client.CancelSpotInstanceRequests(context, &ec2.CancelSpotInstanceRequestsInput{
+		SpotInstanceRequestIds: []string{requestID},
+	})
+	if err != nil {
+		return fmt.Errorf("CancelSpotInstanceRequests %s failed: %w", requestID, err)
+	}
+	return nil
+}
+
+func (e *sdkEC2Client) AuthorizeIngress(context context.Context, groupID string, rules []IngressRule) error {
+	_, err := e.client.AuthorizeSecurityGroupIngress(context, &ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId:       &groupID,
+		IpPermissions: buildIPPermissions(rules),
+	})
+	if err != nil {
+		return fmt.Errorf("AuthorizeSecurityGroupIngress %s failed: %w", groupID, err)
+	}
+	return nil
+}
+
+func (e *sdkEC2Client) RevokeIngress(context context.Context, groupID string, rules []IngressRule) error {
+	_, err := e.client.RevokeSecurityGroupIngress(context, &ec2.RevokeSecurityGroupIngressInput{
+		GroupId:       &groupID,
+		IpPermissions: buildIPPermissions(rules),
+	})
+	if err != nil {
+		return fmt.Errorf("RevokeSecurityGroupIngress %s failed: %w", groupID, err)
+	}
+	return nil
+}
+
+func buildIPPermissions(rules []IngressRule) []ec2types.IpPermission {
+	permissions := make([]ec2types.IpPermission, 0, len(rules))
+	for _, rule := range rules {
+		permission := ec2types.IpPermission{IpProtocol: awssdk.String(rule.Protocol)}
+		if rule.Protocol != "-1" {
+			permission.FromPort = awssdk.Int32(int32(rule.FromPort))
+			permission.ToPort = awssdk.Int32(int32(rule.ToPort))
+		}
+		var description *string
+		if rule.Description != "" {
+			description = awssdk.String(rule.Description)
+		}
+		if isIPv6CIDR(rule.CIDR) {
+			permission.Ipv6Ranges = []ec2types.Ipv6Range{{CidrIpv6: awssdk.String(rule.CIDR), Description: description}}
+		} else {
+			permission.IpRanges = []ec2types.IpRange{{CidrIp: awssdk.String(rule.CIDR), Description: description}}
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions
+}
+
+func (e *sdkEC2Client) CreateImage(context context.Context, instanceID string, name string, tags map[string]string) (string, error) {
+	result, err := e.client.CreateImage(context, createImageInput(instanceID, name, tags))
+	if err != nil {
+		return "", fmt.Errorf("CreateImage %s failed: %w", instanceID, err)
+	}
+	return awssdk.ToString(result.ImageId), nil
+}
+
+func createImageInput(instanceID string, name string, tags map[string]string) *ec2.CreateImageInput {
+	ec2Tags := buildEC2Tags(tags, name)
+	return &ec2.CreateImageInput{
+		InstanceId:  awssdk.String(instanceID),
+		Name:        awssdk.String(name),
+		Description: awssdk.String("goloo snapshot of " + instanceID),
+		NoReboot:    awssdk.Bool(false),
+		TagSpecifications: []ec2types.TagSpecification{
+			{ResourceType: ec2types.ResourceTypeImage, Tags: ec2Tags},
+			{ResourceType: ec2types.ResourceTypeSnapshot, Tags: ec2Tags},
+		},
+	}
+}
+
+func (e *sdkEC2Client) WaitForImage(context context.Context, imageID string) ([]string, error) {
+	waiter := ec2.NewImageAvailableWaiter(e.client)
+	result, err := waiter.WaitForOutput(context, &ec2.DescribeImagesInput{
+		ImageIds: []string{imageID},
+	}, 30*time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("image %s not available: %w", imageID, err)
+	}
+	var snapshotIDs []string
+	for _, image := range result.Images {
+		for _, mapping := range image.BlockDeviceMappings {
+			if mapping.Ebs != nil && mapping.Ebs.SnapshotId != nil {
+				snapshotIDs = append(snapshotIDs, *mapping.Ebs.SnapshotId)
+			}
+		}
+	}
+	return snapshotIDs, nil
+}
+
+func (e *sdkEC2Client) DeregisterImage(context context.Context, imageID string) error {
+	_, err := e.client.DeregisterImage(context, &ec2.DeregisterImageInput{
+		ImageId: awssdk.String(imageID),
+	})
+	if err != nil {
+		return fmt.Errorf("DeregisterImage %s failed: %w", imageID, err)
+	}
+	return nil
+}
+
+func (e *sdkEC2Client) DeleteSnapshot(context context.Context, snapshotID string) error {
+	_, err := e.client.DeleteSnapshot(context, &ec2.DeleteSnapshotInput{
+		SnapshotId: awssdk.String(snapshotID),
+	})
+	if err != nil {
+		return fmt.Errorf("DeleteSnapshot %s failed: %w", snapshotID, err)
+	}
+	return nil
+}
+
+func (e *sdkEC2Client) ReplaceRootVolume(context context.Context, instanceID string, imageID string) error {
+	result, err := e.client.CreateReplaceRootVolumeTask(context, &ec2.CreateReplaceRootVolumeTaskInput{
+		InstanceId:               awssdk.String(instanceID),
+		ImageId:                  awssdk.String(imageID),
+		DeleteReplacedRootVolume: awssdk.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("CreateReplaceRootVolumeTask %s failed: %w", instanceID, err)
+	}
+	taskID := awssdk.ToString(result.ReplaceRootVolumeTask.ReplaceRootVolumeTaskId)
+
+	deadline := time.Now().Add(15 * time.Minute)
+	for time.Now().Before(deadline) {
+		tasks, err := e.client.DescribeReplaceRootVolumeTasks(context, &ec2.DescribeReplaceRootVolumeTasksInput{
+			ReplaceRootVolumeTaskIds: []string{taskID},
+		})
+		if err != nil {
+			return fmt.Errorf("DescribeReplaceRootVolumeTasks %s failed: %w", taskID, err)
+		}
+		if len(tasks.ReplaceRootVolumeTasks) > 0 {
+			switch state := tasks.ReplaceRootVolumeTasks[0].TaskState; state {
+			case ec2types.ReplaceRootVolumeTaskStateSucceeded:
+				return nil
+			case ec2types.ReplaceRootVolumeTaskStateFailed, ec2types.ReplaceRootVolumeTaskStateFailedDetached:
+				return fmt.Errorf("root volume replacement %s on %s %s", taskID, instanceID, state)
+			}
+		}
+		select {
+		case <-context.Done():
+			return context.Err()
+		case <-time.After(10 * time.Second):
+		}
+	}
+	return fmt.Errorf("timed out waiting for root volume replacement %s on %s", taskID, instanceID)
+}
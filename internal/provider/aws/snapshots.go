@@ -0,0 +1,61 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+const snapshotTag = "goloo:snapshot"
+
+func ImageName(vmName, snapshotName string) string {
+	return "goloo-" + vmName + "-" + snapshotName
+}
+
+func (p *Provider) CreateSnapshot(context context.Context, configuration *config.Config, name string) (*config.Snapshot, error) {
+	if err := p.validateClients(); err != nil {
+		return nil, err
+	}
+	if configuration.AWS == nil || configuration.AWS.InstanceID == "" {
+		return nil, fmt.Errorf("no instance ID: VM may not have been created with AWS")
+	}
+
+	tags := BuildTags(configuration, p.StackFolder, p.Version, CurrentOwner())
+	tags[snapshotTag] = name
+	imageID, err := p.EC2.CreateImage(context, configuration.AWS.InstanceID, ImageName(configuration.VM.Name, name), tags)
+	if err != nil {
+		return nil, err
+	}
+	snapshotIDs, err := p.EC2.WaitForImage(context, imageID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: deregister %s by hand if it never becomes available", err, imageID)
+	}
+	return &config.Snapshot{Name: name, ID: imageID, SnapshotIDs: snapshotIDs, CreatedAt: time.Now().UTC()}, nil
+}
+
+func (p *Provider) RestoreSnapshot(context context.Context, configuration *config.Config, snapshot config.Snapshot) error {
+	if err := p.validateClients(); err != nil {
+		return err
+	}
+	if configuration.AWS == nil || configuration.AWS.InstanceID == "" {
+		return fmt.Errorf("no instance ID: VM may not have been created with AWS")
+	}
+	return p.EC2.ReplaceRootVolume(context, configuration.AWS.InstanceID, snapshot.ID)
+}
+
+func (p *Provider) DeleteSnapshot(context context.Context, configuration *config.Config, snapshot config.Snapshot) error {
+	if err := p.validateClients(); err != nil {
+		return err
+	}
+	if err := p.EC2.DeregisterImage(context, snapshot.ID); err != nil {
+		return err
+	}
+	for _, snapshotID := range snapshot.SnapshotIDs {
+		if err := p.EC2.DeleteSnapshot(context, snapshotID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+	"github.com/emergingrobotics/goloo/internal/provider"
+)
+
+var _ provider.Snapshotter = (*Provider)(nil)
+
+func snapshotConfig() *config.Config {
+	return &config.Config{
+		VM:   &config.VMConfig{Name: "devbox"},
+		Tags: map[string]string{"team": "platform"},
+		AWS:  &config.AWSState{InstanceID: "i-0123456789abcdef0"},
+	}
+}
+
+func TestCreateSnapshot(t *testing.T) {
+	awsProvider, _, ec2, _, _ := newFakeProvider()
+
+	snapshot, err := awsProvider.CreateSnapshot(context.Background(), snapshotConfig(), "pre-upgrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Name != "pre-upgrade" || snapshot.ID != "ami-0fedcba987654321" || len(snapshot.SnapshotIDs) != 1 {
+		t.Errorf("unexpected snapshot %+v", snapshot)
+	}
+	if ec2.imageName != "goloo-devbox-pre-upgrade" {
+		t.Errorf("unexpected image name %q", ec2.imageName)
+	}
+	if ec2.imageTags[snapshotTag] != "pre-upgrade" || ec2.imageTags["team"] != "platform" || ec2.imageTags[managedByTag] != "goloo" {
+		t.Errorf("expected image to carry goloo and user tags, got %v", ec2.imageTags)
+	}
+}
+
+func TestCreateSnapshotTagsMatchStack(t *testing.T) {
+	awsProvider, _, ec2, _, _ := newFakeProvider()
+	awsProvider.StackFolder = "/projects/stacks/devbox"
+	awsProvider.Version = "1.2.3"
+
+	if _, err := awsProvider.CreateSnapshot(context.Background(), snapshotConfig(), "pre-upgrade"); err != nil {
+		t.Fatal(err)
+	}
+	if ec2.imageTags[stackFolderTag] != "/projects/stacks/devbox" {
+		t.Errorf("%s = %q, want %q", stackFolderTag, ec2.imageTags[stackFolderTag], "/projects/stacks/devbox")
+	}
+	if ec2.imageTags[versionTag] != "1.2.3" {
+		t.Errorf("%s = %q, want %q", versionTag, ec2.imageTags[versionTag], "1.2.3")
+	}
+}
+
+func TestCreateImageInputRebootsInstance(t *testing.T) {
+	input := createImageInput("i-0123456789abcdef0", "goloo-devbox-pre-upgrade", map[string]string{"goloo:name": "devbox"})
+	if input.NoReboot == nil || *input.NoReboot {
+		t.Error("CreateImage should reboot the instance so the image is consistent")
+	}
+	if len(input.TagSpecifications) != 2 {
+		t.Errorf("expected image and snapshot tag specifications, got %d", len(input.TagSpecifications))
+	}
+}
+
+func TestCreateSnapshotImageNeverAvailable(t *testing.T) {
+	awsProvider, _, ec2, _, _ := newFakeProvider()
+	ec2.imageError = fmt.Errorf("image ami-0fedcba987654321 not available: timed out")
+
+	_, err := awsProvider.CreateSnapshot(context.Background(), snapshotConfig(), "pre-upgrade")
+	if err == nil || !strings.Contains(err.Error(), "ami-0fedcba987654321") {
+		t.Errorf("expected error naming the image, got %v", err)
+	}
+}
+
+func TestCreateSnapshotRequiresInstance(t *testing.T) {
+	awsProvider, _, _, _, _ := newFakeProvider()
+	configuration := &config.Config{VM: &config.VMConfig{Name: "devbox"}}
+	if _, err := awsProvider.CreateSnapshot(context.Background(), configuration, "pre-upgrade"); err == nil {
+		t.Error("expected error without an instance ID")
+	}
+}
+
+func TestRestoreAndDeleteSnapshot(t *testing.T) {
+	awsProvider, _, ec2, _, _ := newFakeProvider()
+	snapshot := config.Snapshot{Name: "pre-upgrade", ID: "ami-0fedcba987654321", SnapshotIDs: []string{"snap-1", "snap-2"}}
+
+	if err := awsProvider.RestoreSnapshot(context.Background(), snapshotConfig(), snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if len(ec2.replacedRoots) != 1 || ec2.replacedRoots[0] != "i-0123456789abcdef0=ami-0fedcba987654321" {
+		t.Errorf("expected the root volume to be replaced from the image, got %v", ec2.replacedRoots)
+	}
+
+	if err := awsProvider.DeleteSnapshot(context.Background(), snapshotConfig(), snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if len(ec2.deregistered) != 1 || len(ec2.deletedSnapshots) != 2 {
+		t.Errorf("expected image deregistered and both EBS snapshots deleted, got %v %v", ec2.deregistered, ec2.deletedSnapshots)
+	}
+}
@@ -0,0 +1,43 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const DefaultSpotInterruption = "stop"
+
+var spotInterruptedPrefixes = []string{"instance-stopped-", "instance-terminated-", "instance-hibernated-"}
+
+func IsSpotInterruption(statusCode string) bool {
+	if strings.HasPrefix(statusCode, "marked-for-") {
+		return true
+	}
+	if strings.HasSuffix(statusCode, "-by-user") {
+		return false
+	}
+	for _, prefix := range spotInterruptedPrefixes {
+		if strings.HasPrefix(statusCode, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Provider) cancelSpotRequest(context context.Context, instanceID string) error {
+	spot, err := p.EC2.DescribeSpotRequest(context, instanceID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: no spot request to cancel for %s: %v\n", instanceID, err)
+		return nil
+	}
+	switch spot.RequestState {
+	case "cancelled", "closed":
+		return nil
+	}
+	if err := p.EC2.CancelSpotRequest(context, spot.RequestID); err != nil {
+		return fmt.Errorf("failed to cancel spot request %s (a persistent request would relaunch the instance): %w", spot.RequestID, err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+	"github.com/emergingrobotics/goloo/internal/provider"
+)
+
+func TestIsSpotInterruption(t *testing.T) {
+	for code, want := range map[string]bool{
+		"fulfilled":                       false,
+		"pending-fulfillment":             false,
+		"marked-for-stop":                 true,
+		"marked-for-termination":          true,
+		"instance-stopped-by-price":       true,
+		"instance-stopped-no-capacity":    true,
+		"instance-terminated-no-capacity": true,
+		"instance-stopped-by-user":        false,
+		"instance-terminated-by-user":     false,
+	} {
+		if got := IsSpotInterruption(code); got != want {
+			t.Errorf("IsSpotInterruption(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestGenerateTemplateWithSpot(t *testing.T) {
+	template := generateAndParse(t, TemplateOptions{UserData: "test", Spot: true, SpotMaxPrice: "0.05"})
+	if !template.hasResource("LaunchTemplate", "AWS::EC2::LaunchTemplate") {
+		t.Fatal("Template should contain a LaunchTemplate for spot market options")
+	}
+
+	data := template.Resources["LaunchTemplate"].Properties["LaunchTemplateData"].(map[string]interface{})
+	market := data["InstanceMarketOptions"].(map[string]interface{})
+	spotOptions := market["SpotOptions"].(map[string]interface{})
+	if market["MarketType"] != "spot" || spotOptions["MaxPrice"] != "0.05" {
+		t.Errorf("unexpected market options: %v", market)
+	}
+	if spotOptions["InstanceInterruptionBehavior"] != "stop" || spotOptions["SpotInstanceType"] != "persistent" {
+		t.Errorf("expected a persistent request that stops on interruption by default, got %v", spotOptions)
+	}
+	if _, exists := template.Resources["EC2Instance"].Properties["LaunchTemplate"]; !exists {
+		t.Error("EC2Instance should reference the launch template")
+	}
+}
+
+func TestGenerateTemplateSpotInterruptionBehaviors(t *testing.T) {
+	terminate := generateAndParse(t, TemplateOptions{Spot: true, SpotInterruption: "terminate"})
+	spotOptions := terminate.Resources["LaunchTemplate"].Properties["LaunchTemplateData"].(map[string]interface{})["InstanceMarketOptions"].(map[string]interface{})["SpotOptions"].(map[string]interface{})
+	if spotOptions["SpotInstanceType"] != "one-time" {
+		t.Errorf("terminate should use a one-time request, got %v", spotOptions["SpotInstanceType"])
+	}
+
+	hibernate := generateAndParse(t, TemplateOptions{Spot: true, SpotInterruption: "hibernate"})
+	if _, exists := hibernate.Resources["EC2Instance"].Properties["HibernationOptions"]; !exists {
+		t.Error("hibernate should configure HibernationOptions on the instance")
+	}
+
+	onDemand := generateAndParse(t, TemplateOptions{})
+	if _, exists := onDemand.Resources["LaunchTemplate"]; exists {
+		t.Error("on-demand instances should not get a launch template")
+	}
+}
+
+func TestCreateRecordsSpot(t *testing.T) {
+	provider, cloudFormation, _, _, _ := newFakeProvider()
+	cloudInitPath := createCloudInitFile(t)
+
+	configuration := &config.Config{VM: &config.VMConfig{Name: "devbox", InstanceType: "t3.micro", Spot: &config.SpotConfig{}}}
+	if err := provider.Create(context.Background(), configuration, cloudInitPath); err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+	if !configuration.AWS.Spot {
+		t.Error("AWSState.Spot should be recorded")
+	}
+	template, err := parseTemplate(cloudFormation.lastTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !template.hasResource("LaunchTemplate", "AWS::EC2::LaunchTemplate") {
+		t.Error("stack template should request spot capacity")
+	}
+}
+
+func TestStatusIncludesSpotRequest(t *testing.T) {
+	notice := &provider.SpotStatus{RequestID: "sir-0123", RequestState: "active", StatusCode: "marked-for-stop", InterruptionNotice: true}
+	awsProvider, _, ec2, _, _ := newFakeProvider()
+	ec2.instanceState = "running"
+	ec2.spotStatus = notice
+
+	configuration := &config.Config{
+		VM:  &config.VMConfig{Name: "devbox"},
+		AWS: &config.AWSState{InstanceID: "i-0123", Spot: true},
+	}
+	status, err := awsProvider.Status(context.Background(), configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Spot != notice {
+		t.Errorf("Status().Spot = %+v, want %+v", status.Spot, notice)
+	}
+
+	ec2.spotError = fmt.Errorf("throttled")
+	status, err = awsProvider.Status(context.Background(), configuration)
+	if err != nil {
+		t.Fatalf("a spot lookup failure should not fail Status(): %v", err)
+	}
+	if status.Spot != nil || status.State != "running" {
+		t.Errorf("expected instance state without spot details, got %+v", status)
+	}
+
+	configuration.AWS.Spot = false
+	ec2.spotError = nil
+	status, _ = awsProvider.Status(context.Background(), configuration)
+	if status.Spot != nil {
+		t.Error("on-demand instances should not report spot details")
+	}
+}
+
+func spotDeleteConfig() *config.Config {
+	return &config.Config{
+		VM: &config.VMConfig{Name: "devbox"},
+		AWS: &config.AWSState{
+			InstanceID: "i-0123456789abcdef0",
+			StackName:  "goloo-devbox",
+			Spot:       true,
+		},
+	}
+}
+
+func TestDeleteCancelsSpotRequestBeforeStack(t *testing.T) {
+	spot := &provider.SpotStatus{RequestID: "sir-abc123", RequestState: "active", StatusCode: "fulfilled"}
+	awsProvider, cloudFormation, ec2, _, _ := newFakeProvider()
+	ec2.spotStatus = spot
+	var calls []string
+	cloudFormation.callLog = &calls
+	ec2.callLog = &calls
+
+	if err := awsProvider.Delete(context.Background(), spotDeleteConfig()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"CancelSpotRequest sir-abc123", "DeleteStack goloo-devbox"}
+	if len(calls) != len(want) || calls[0] != want[0] || calls[1] != want[1] {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestDeleteStopsWhenSpotCancelFails(t *testing.T) {
+	spot := &provider.SpotStatus{RequestID: "sir-abc123", RequestState: "active"}
+	awsProvider, cloudFormation, ec2, _, _ := newFakeProvider()
+	ec2.spotStatus = spot
+	ec2.cancelSpotError = fmt.Errorf("access denied")
+
+	if err := awsProvider.Delete(context.Background(), spotDeleteConfig()); err == nil {
+		t.Fatal("Delete() should fail when the spot request cannot be cancelled")
+	}
+	if len(cloudFormation.deletedStacks) != 0 {
+		t.Error("the stack should not be deleted while the spot request is still open")
+	}
+}
+
+func TestDeleteSkipsClosedSpotRequest(t *testing.T) {
+	spot := &provider.SpotStatus{RequestID: "sir-abc123", RequestState: "cancelled"}
+	awsProvider, cloudFormation, ec2, _, _ := newFakeProvider()
+	ec2.spotStatus = spot
+
+	if err := awsProvider.Delete(context.Background(), spotDeleteConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if len(ec2.cancelledSpot) != 0 || len(cloudFormation.deletedStacks) != 1 {
+		t.Errorf("expected only the stack delete, got cancelled=%v deleted=%v", ec2.cancelledSpot, cloudFormation.deletedStacks)
+	}
+}
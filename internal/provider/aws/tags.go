@@ -0,0 +1,60 @@
+package aws
+
+import (
+	"os"
+	"os/user"
+	"sort"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+const (
+	ownerTag       = "goloo:owner"
+	stackFolderTag = "goloo:stack-folder"
+	versionTag     = "goloo:version"
+)
+
+const maxTagValueLength = 256
+
+func BuildTags(configuration *config.Config, stackFolder, version, owner string) map[string]string {
+	tags := map[string]string{"Name": configuration.VM.Name}
+	for key, value := range configuration.Tags {
+		tags[key] = value
+	}
+	tags[vmNameTag] = configuration.VM.Name
+	tags[managedByTag] = "goloo"
+	if owner != "" {
+		tags[ownerTag] = owner
+	}
+	if stackFolder != "" && len(stackFolder) <= maxTagValueLength {
+		tags[stackFolderTag] = stackFolder
+	}
+	if version != "" {
+		tags[versionTag] = version
+	}
+	return tags
+}
+
+func CurrentOwner() string {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return current.Username
+	}
+	return os.Getenv("USER")
+}
+
+func SortedTagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func tagProperties(tags map[string]string) []map[string]interface{} {
+	properties := make([]map[string]interface{}, 0, len(tags))
+	for _, key := range SortedTagKeys(tags) {
+		properties = append(properties, map[string]interface{}{"Key": key, "Value": tags[key]})
+	}
+	return properties
+}
@@ -0,0 +1,126 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+func TestBuildTags(t *testing.T) {
+	configuration := &config.Config{
+		VM:   &config.VMConfig{Name: "devbox"},
+		Tags: map[string]string{"team": "platform", "cost-center": "42", "Name": "alice-devbox"},
+	}
+	tags := BuildTags(configuration, "stacks/devbox", "1.2.3", "alice")
+
+	expected := map[string]string{
+		"Name":               "alice-devbox",
+		"team":               "platform",
+		"cost-center":        "42",
+		"goloo:name":         "devbox",
+		"ManagedBy":          "goloo",
+		"goloo:owner":        "alice",
+		"goloo:stack-folder": "stacks/devbox",
+		"goloo:version":      "1.2.3",
+	}
+	if len(tags) != len(expected) {
+		t.Errorf("expected %d tags, got %v", len(expected), tags)
+	}
+	for key, value := range expected {
+		if tags[key] != value {
+			t.Errorf("tag %s = %q, want %q", key, tags[key], value)
+		}
+	}
+}
+
+func TestBuildTagsDefaultsNameAndSkipsUnknowns(t *testing.T) {
+	tags := BuildTags(&config.Config{VM: &config.VMConfig{Name: "devbox"}}, "", "", "")
+	if tags["Name"] != "devbox" {
+		t.Errorf("Name = %q, want the VM name", tags["Name"])
+	}
+	for _, key := range []string{ownerTag, stackFolderTag, versionTag} {
+		if _, exists := tags[key]; exists {
+			t.Errorf("tag %s should be omitted when empty", key)
+		}
+	}
+}
+
+func TestBuildTagsSkipsLongStackFolder(t *testing.T) {
+	stackFolder := "/" + strings.Repeat("deep/", 60) + "devbox"
+	tags := BuildTags(&config.Config{VM: &config.VMConfig{Name: "devbox"}}, stackFolder, "1.2.3", "alice")
+	if _, exists := tags[stackFolderTag]; exists {
+		t.Errorf("%s should be omitted when longer than %d characters", stackFolderTag, maxTagValueLength)
+	}
+	if tags[versionTag] != "1.2.3" {
+		t.Errorf("%s = %q, want %q", versionTag, tags[versionTag], "1.2.3")
+	}
+}
+
+func TestGenerateTemplateAppliesTags(t *testing.T) {
+	template := generateAndParse(t, TemplateOptions{
+		ElasticIP:       true,
+		ManagedPolicies: []string{"arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess"},
+		Spot:            true,
+		Tags:            map[string]string{"goloo:name": "devbox", "team": "platform"},
+	})
+
+	for _, name := range []string{"SSHSecurityGroup", "EC2Instance", "ElasticIP", "InstanceRole"} {
+		tags, _ := template.Resources[name].Properties["Tags"].([]interface{})
+		if len(tags) != 2 {
+			t.Errorf("%s tags = %v, want 2 tags", name, tags)
+			continue
+		}
+		first := tags[0].(map[string]interface{})
+		if first["Key"] != "goloo:name" || first["Value"] != "devbox" {
+			t.Errorf("%s tags should be sorted by key, got %v", name, tags)
+		}
+	}
+	specifications, _ := template.Resources["LaunchTemplate"].Properties["TagSpecifications"].([]interface{})
+	if len(specifications) != 1 {
+		t.Fatalf("LaunchTemplate TagSpecifications = %v, want 1 specification", specifications)
+	}
+	specification := specifications[0].(map[string]interface{})
+	if tags, _ := specification["Tags"].([]interface{}); specification["ResourceType"] != "launch-template" || len(tags) != 2 {
+		t.Errorf("unexpected LaunchTemplate tag specification %v", specification)
+	}
+	if template.Resources["EC2Instance"].Properties["PropagateTagsToVolumeOnCreation"] != true {
+		t.Error("instance tags should propagate to its volumes")
+	}
+}
+
+func TestCreateTagsStackAndNetwork(t *testing.T) {
+	provider, cloudFormation, ec2, _, _ := newFakeProvider()
+	provider.StackFolder = "stacks/devbox"
+	provider.Version = "1.2.3"
+	ec2.findVPCError = fmt.Errorf("no default VPC")
+	ec2.networkStack = &NetworkStack{VpcID: "vpc-new123", SubnetID: "subnet-new456"}
+	cloudInitPath := createCloudInitFile(t)
+
+	configuration := &config.Config{
+		VM:   &config.VMConfig{Name: "devbox", InstanceType: "t3.micro"},
+		Tags: map[string]string{"team": "platform"},
+	}
+	if err := provider.Create(context.Background(), configuration, cloudInitPath); err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+
+	for source, tags := range map[string]map[string]string{"stack": cloudFormation.lastTags, "network": ec2.networkTags} {
+		if tags["goloo:name"] != "devbox" || tags["team"] != "platform" || tags["goloo:version"] != "1.2.3" || tags["goloo:stack-folder"] != "stacks/devbox" {
+			t.Errorf("%s tags = %v", source, tags)
+		}
+	}
+}
+
+func TestBuildEC2TagsKeepsResourceName(t *testing.T) {
+	tags := buildEC2Tags(map[string]string{"Name": "devbox", "team": "platform"}, "goloo-vpc")
+	values := make(map[string]string)
+	for _, tag := range tags {
+		values[*tag.Key] = *tag.Value
+	}
+	if values["Name"] != "goloo-vpc" || values["ManagedBy"] != "goloo" || values["team"] != "platform" {
+		t.Errorf("unexpected network tags: %v", values)
+	}
+}
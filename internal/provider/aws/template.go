@@ -1,69 +1,267 @@
 package aws
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 )
 
-const cloudFormationTemplate = `AWSTemplateFormatVersion: '2010-09-09'
-Description: Goloo EC2 instance with SSH access
-
-Parameters:
-  ImageId:
-    Type: String
-  InstanceType:
-    Type: String
-    Default: t3.micro
-  VpcId:
-    Type: String
-  SubnetId:
-    Type: String
-
-Resources:
-  SSHSecurityGroup:
-    Type: AWS::EC2::SecurityGroup
-    Properties:
-      GroupDescription: Allow SSH/HTTP/HTTPS
-      VpcId: !Ref VpcId
-      SecurityGroupIngress:
-        - IpProtocol: tcp
-          FromPort: 22
-          ToPort: 22
-          CidrIp: 0.0.0.0/0
-        - IpProtocol: tcp
-          FromPort: 80
-          ToPort: 80
-          CidrIp: 0.0.0.0/0
-        - IpProtocol: tcp
-          FromPort: 443
-          ToPort: 443
-          CidrIp: 0.0.0.0/0
-
-  EC2Instance:
-    Type: AWS::EC2::Instance
-    Properties:
-      InstanceType: !Ref InstanceType
-      ImageId: !Ref ImageId
-      NetworkInterfaces:
-        - DeviceIndex: "0"
-          SubnetId: !Ref SubnetId
-          AssociatePublicIpAddress: true
-          GroupSet:
-            - !GetAtt SSHSecurityGroup.GroupId
-      UserData: %s
-
-Outputs:
-  InstanceId:
-    Value: !Ref EC2Instance
-  PublicIP:
-    Value: !GetAtt EC2Instance.PublicIp
-  SecurityGroupId:
-    Value: !Ref SSHSecurityGroup`
-
-func GenerateTemplate(userData string) string {
-	return fmt.Sprintf(cloudFormationTemplate, userData)
-}
-
-func TemplateContainsResource(template string, resourceName string) bool {
-	return strings.Contains(template, resourceName+":")
+const templateDescription = "Goloo EC2 instance with SSH access"
+
+type Template struct {
+	AWSTemplateFormatVersion string               `json:"AWSTemplateFormatVersion"`
+	Description              string               `json:"Description,omitempty"`
+	Parameters               map[string]Parameter `json:"Parameters,omitempty"`
+	Resources                map[string]Resource  `json:"Resources"`
+	Outputs                  map[string]Output    `json:"Outputs,omitempty"`
+}
+
+type Parameter struct {
+	Type    string `json:"Type"`
+	Default string `json:"Default,omitempty"`
+}
+
+type Resource struct {
+	Type       string                 `json:"Type"`
+	Properties map[string]interface{} `json:"Properties,omitempty"`
+}
+
+type Output struct {
+	Value interface{} `json:"Value"`
+}
+
+type TemplateOptions struct {
+	UserData              string
+	Ingress               []IngressRule
+	ElasticIP             bool
+	ElasticIPAllocationID string
+	BlockDevices          []BlockDevice
+	InstanceProfile       string
+	ManagedPolicies       []string
+	Spot                  bool
+	SpotMaxPrice          string
+	SpotInterruption      string
+	Tags                  map[string]string
+}
+
+func Ref(name string) map[string]interface{} {
+	return map[string]interface{}{"Ref": name}
+}
+
+func GetAtt(resource, attribute string) map[string]interface{} {
+	return map[string]interface{}{"Fn::GetAtt": []string{resource, attribute}}
+}
+
+func BuildTemplate(options TemplateOptions) *Template {
+	template := &Template{
+		AWSTemplateFormatVersion: "2010-09-09",
+		Description:              templateDescription,
+		Parameters: map[string]Parameter{
+			"ImageId":      {Type: "String"},
+			"InstanceType": {Type: "String", Default: "t3.micro"},
+			"VpcId":        {Type: "String"},
+			"SubnetId":     {Type: "String"},
+		},
+		Resources: map[string]Resource{},
+		Outputs: map[string]Output{
+			"InstanceId":      {Value: Ref("EC2Instance")},
+			"PublicIP":        {Value: GetAtt("EC2Instance", "PublicIp")},
+			"SecurityGroupId": {Value: Ref("SSHSecurityGroup")},
+		},
+	}
+
+	securityGroup := map[string]interface{}{
+		"GroupDescription": "Goloo instance ingress",
+		"VpcId":            Ref("VpcId"),
+	}
+	if len(options.Ingress) > 0 {
+		securityGroup["SecurityGroupIngress"] = ingressProperties(options.Ingress)
+	}
+	template.Resources["SSHSecurityGroup"] = Resource{Type: "AWS::EC2::SecurityGroup", Properties: securityGroup}
+
+	template.Resources["EC2Instance"] = Resource{
+		Type: "AWS::EC2::Instance",
+		Properties: map[string]interface{}{
+			"InstanceType": Ref("InstanceType"),
+			"ImageId":      Ref("ImageId"),
+			"NetworkInterfaces": []map[string]interface{}{
+				{
+					"DeviceIndex":              "0",
+					"SubnetId":                 Ref("SubnetId"),
+					"AssociatePublicIpAddress": true,
+					"GroupSet":                 []interface{}{GetAtt("SSHSecurityGroup", "GroupId")},
+				},
+			},
+			"UserData": options.UserData,
+		},
+	}
+
+	if len(options.BlockDevices) > 0 {
+		template.Resources["EC2Instance"].Properties["BlockDeviceMappings"] = blockDeviceMappings(options.BlockDevices)
+	}
+
+	addElasticIP(template, options)
+	addInstanceProfile(template, options)
+	addSpotMarket(template, options)
+	addTags(template, options)
+	return template
+}
+
+func addElasticIP(template *Template, options TemplateOptions) {
+	var allocationID interface{}
+	switch {
+	case options.ElasticIPAllocationID != "":
+		allocationID = options.ElasticIPAllocationID
+	case options.ElasticIP:
+		template.Resources["ElasticIP"] = Resource{
+			Type:       "AWS::EC2::EIP",
+			Properties: map[string]interface{}{"Domain": "vpc"},
+		}
+		allocationID = GetAtt("ElasticIP", "AllocationId")
+		template.Outputs["PublicIP"] = Output{Value: Ref("ElasticIP")}
+	default:
+		return
+	}
+
+	template.Resources["ElasticIPAssociation"] = Resource{
+		Type: "AWS::EC2::EIPAssociation",
+		Properties: map[string]interface{}{
+			"InstanceId":   Ref("EC2Instance"),
+			"AllocationId": allocationID,
+		},
+	}
+	template.Outputs["ElasticIPAllocationId"] = Output{Value: allocationID}
+}
+
+func addInstanceProfile(template *Template, options TemplateOptions) {
+	var profile interface{}
+	switch {
+	case options.InstanceProfile != "":
+		profile = InstanceProfileName(options.InstanceProfile)
+	case len(options.ManagedPolicies) > 0:
+		template.Resources["InstanceRole"] = Resource{
+			Type: "AWS::IAM::Role",
+			Properties: map[string]interface{}{
+				"AssumeRolePolicyDocument": map[string]interface{}{
+					"Version": "2012-10-17",
+					"Statement": []map[string]interface{}{
+						{
+							"Effect":    "Allow",
+							"Principal": map[string]interface{}{"Service": "ec2.amazonaws.com"},
+							"Action":    "sts:AssumeRole",
+						},
+					},
+				},
+				"ManagedPolicyArns": options.ManagedPolicies,
+			},
+		}
+		template.Resources["InstanceProfile"] = Resource{
+			Type:       "AWS::IAM::InstanceProfile",
+			Properties: map[string]interface{}{"Roles": []interface{}{Ref("InstanceRole")}},
+		}
+		profile = Ref("InstanceProfile")
+	default:
+		return
+	}
+
+	template.Resources["EC2Instance"].Properties["IamInstanceProfile"] = profile
+	template.Outputs["InstanceProfile"] = Output{Value: profile}
+}
+
+func addSpotMarket(template *Template, options TemplateOptions) {
+	if !options.Spot {
+		return
+	}
+	interruption := options.SpotInterruption
+	if interruption == "" {
+		interruption = DefaultSpotInterruption
+	}
+	spotOptions := map[string]interface{}{
+		"SpotInstanceType":             "persistent",
+		"InstanceInterruptionBehavior": interruption,
+	}
+	if interruption == "terminate" {
+		spotOptions["SpotInstanceType"] = "one-time"
+	}
+	if options.SpotMaxPrice != "" {
+		spotOptions["MaxPrice"] = options.SpotMaxPrice
+	}
+
+	template.Resources["LaunchTemplate"] = Resource{
+		Type: "AWS::EC2::LaunchTemplate",
+		Properties: map[string]interface{}{
+			"LaunchTemplateData": map[string]interface{}{
+				"InstanceMarketOptions": map[string]interface{}{
+					"MarketType":  "spot",
+					"SpotOptions": spotOptions,
+				},
+			},
+		},
+	}
+	instance := template.Resources["EC2Instance"].Properties
+	instance["LaunchTemplate"] = map[string]interface{}{
+		"LaunchTemplateId": Ref("LaunchTemplate"),
+		"Version":          GetAtt("LaunchTemplate", "LatestVersionNumber"),
+	}
+	if interruption == "hibernate" {
+		instance["HibernationOptions"] = map[string]interface{}{"Configured": true}
+	}
+}
+
+func addTags(template *Template, options TemplateOptions) {
+	if len(options.Tags) == 0 {
+		return
+	}
+	tags := tagProperties(options.Tags)
+	for _, name := range []string{"SSHSecurityGroup", "EC2Instance", "ElasticIP", "InstanceRole"} {
+		if resource, exists := template.Resources[name]; exists {
+			resource.Properties["Tags"] = tags
+		}
+	}
+	if launchTemplate, exists := template.Resources["LaunchTemplate"]; exists {
+		launchTemplate.Properties["TagSpecifications"] = []map[string]interface{}{
+			{"ResourceType": "launch-template", "Tags": tags},
+		}
+	}
+	template.Resources["EC2Instance"].Properties["PropagateTagsToVolumeOnCreation"] = true
+}
+
+func InstanceProfileName(reference string) string {
+	if strings.HasPrefix(reference, "arn:") {
+		return reference[strings.LastIndex(reference, "/")+1:]
+	}
+	return reference
+}
+
+func ingressProperties(rules []IngressRule) []map[string]interface{} {
+	properties := make([]map[string]interface{}, 0, len(rules))
+	for _, rule := range rules {
+		property := map[string]interface{}{"IpProtocol": rule.Protocol}
+		if rule.Protocol != "-1" {
+			property["FromPort"] = rule.FromPort
+			property["ToPort"] = rule.ToPort
+		}
+		if isIPv6CIDR(rule.CIDR) {
+			property["CidrIpv6"] = rule.CIDR
+		} else {
+			property["CidrIp"] = rule.CIDR
+		}
+		if rule.Description != "" {
+			property["Description"] = rule.Description
+		}
+		properties = append(properties, property)
+	}
+	return properties
+}
+
+func (t *Template) Render() (string, error) {
+	body, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to render CloudFormation template: %w", err)
+	}
+	return string(body), nil
+}
+
+func GenerateTemplate(options TemplateOptions) (string, error) {
+	return BuildTemplate(options).Render()
 }
@@ -0,0 +1,81 @@
+package aws
+
+import (
+	"fmt"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+const defaultVolumeType = "gp3"
+
+var operatingSystemRootDevices = map[string]string{
+	"ubuntu-24.04":      "/dev/sda1",
+	"ubuntu-22.04":      "/dev/sda1",
+	"ubuntu-20.04":      "/dev/sda1",
+	"amazon-linux-2023": "/dev/xvda",
+	"amazon-linux-2":    "/dev/xvda",
+	"debian-12":         "/dev/xvda",
+	"debian-11":         "/dev/xvda",
+}
+
+type BlockDevice struct {
+	DeviceName string
+	SizeGiB    int
+	Type       string
+	IOPS       int
+	Encrypted  bool
+}
+
+func BuildBlockDevices(operatingSystem string, vm *config.VMConfig) ([]BlockDevice, error) {
+	var devices []BlockDevice
+	if vm.Disk != "" {
+		rootDevice, exists := operatingSystemRootDevices[operatingSystem]
+		if !exists {
+			return nil, fmt.Errorf("unknown root device for OS %q", operatingSystem)
+		}
+		size, err := config.ParseSizeGiB(vm.Disk)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vm.disk: %w", err)
+		}
+		devices = append(devices, newBlockDevice(rootDevice, size, vm.DiskType, vm.DiskIOPS, vm.DiskEncrypted))
+	}
+
+	for i, deviceName := range config.VolumeDevices(vm.Volumes) {
+		volume := vm.Volumes[i]
+		size, err := config.ParseSizeGiB(volume.Size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vm.volumes[%d].size: %w", i, err)
+		}
+		devices = append(devices, newBlockDevice(deviceName, size, volume.Type, volume.IOPS, volume.Encrypted))
+	}
+	return devices, nil
+}
+
+func newBlockDevice(deviceName string, size int, volumeType string, iops int, encrypted bool) BlockDevice {
+	if volumeType == "" {
+		volumeType = defaultVolumeType
+	}
+	return BlockDevice{DeviceName: deviceName, SizeGiB: size, Type: volumeType, IOPS: iops, Encrypted: encrypted}
+}
+
+func blockDeviceMappings(devices []BlockDevice) []map[string]interface{} {
+	mappings := make([]map[string]interface{}, 0, len(devices))
+	for _, device := range devices {
+		ebs := map[string]interface{}{
+			"VolumeSize":          device.SizeGiB,
+			"VolumeType":          device.Type,
+			"DeleteOnTermination": true,
+		}
+		if device.IOPS != 0 {
+			ebs["Iops"] = device.IOPS
+		}
+		if device.Encrypted {
+			ebs["Encrypted"] = true
+		}
+		mappings = append(mappings, map[string]interface{}{
+			"DeviceName": device.DeviceName,
+			"Ebs":        ebs,
+		})
+	}
+	return mappings
+}
@@ -0,0 +1,105 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+func TestBuildBlockDevices(t *testing.T) {
+	vm := &config.VMConfig{
+		Disk:          "40G",
+		DiskType:      "io2",
+		DiskIOPS:      4000,
+		DiskEncrypted: true,
+		Volumes: []config.Volume{
+			{Size: "1T", MountPoint: "/data"},
+			{Size: "100G", Type: "gp3", IOPS: 6000, Device: "/dev/sdf"},
+		},
+	}
+
+	devices, err := BuildBlockDevices("ubuntu-24.04", vm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []BlockDevice{
+		{DeviceName: "/dev/sda1", SizeGiB: 40, Type: "io2", IOPS: 4000, Encrypted: true},
+		{DeviceName: "/dev/sdg", SizeGiB: 1024, Type: "gp3"},
+		{DeviceName: "/dev/sdf", SizeGiB: 100, Type: "gp3", IOPS: 6000},
+	}
+	if len(devices) != len(expected) {
+		t.Fatalf("expected %d block devices, got %d", len(expected), len(devices))
+	}
+	for i := range expected {
+		if devices[i] != expected[i] {
+			t.Errorf("device %d = %+v, want %+v", i, devices[i], expected[i])
+		}
+	}
+}
+
+func TestBuildBlockDevicesUsesOSRootDevice(t *testing.T) {
+	devices, err := BuildBlockDevices("amazon-linux-2023", &config.VMConfig{Disk: "20G"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].DeviceName != "/dev/xvda" {
+		t.Errorf("expected /dev/xvda root device, got %+v", devices)
+	}
+
+	devices, err = BuildBlockDevices("ubuntu-24.04", &config.VMConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 0 {
+		t.Errorf("expected the AMI default root volume without vm.disk, got %+v", devices)
+	}
+}
+
+func TestEveryOperatingSystemHasRootDevice(t *testing.T) {
+	for operatingSystem := range operatingSystemSSMPaths {
+		if _, exists := operatingSystemRootDevices[operatingSystem]; !exists {
+			t.Errorf("no root device for %q", operatingSystem)
+		}
+	}
+}
+
+func TestCreateSetsBlockDeviceMappings(t *testing.T) {
+	provider, cloudFormation, _, _, _ := newFakeProvider()
+	cloudInitPath := createCloudInitFile(t)
+
+	configuration := &config.Config{VM: &config.VMConfig{
+		Name:          "devbox",
+		InstanceType:  "t3.micro",
+		Disk:          "30G",
+		DiskEncrypted: true,
+		Volumes:       []config.Volume{{Size: "200G", Type: "io2", IOPS: 8000}},
+	}}
+	if err := provider.Create(context.Background(), configuration, cloudInitPath); err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+
+	template, err := parseTemplate(cloudFormation.lastTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mappings, _ := template.Resources["EC2Instance"].Properties["BlockDeviceMappings"].([]interface{})
+	if len(mappings) != 2 {
+		t.Fatalf("expected root and data volume mappings, got %v", mappings)
+	}
+
+	root := mappings[0].(map[string]interface{})
+	rootEBS := root["Ebs"].(map[string]interface{})
+	if root["DeviceName"] != "/dev/sda1" || rootEBS["VolumeSize"] != float64(30) || rootEBS["VolumeType"] != "gp3" || rootEBS["Encrypted"] != true {
+		t.Errorf("unexpected root volume mapping: %v", root)
+	}
+
+	data := mappings[1].(map[string]interface{})
+	dataEBS := data["Ebs"].(map[string]interface{})
+	if data["DeviceName"] != "/dev/sdf" || dataEBS["VolumeSize"] != float64(200) || dataEBS["VolumeType"] != "io2" || dataEBS["Iops"] != float64(8000) {
+		t.Errorf("unexpected data volume mapping: %v", data)
+	}
+	if _, encrypted := dataEBS["Encrypted"]; encrypted {
+		t.Error("data volume should not set Encrypted unless requested")
+	}
+}
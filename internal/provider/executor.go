@@ -0,0 +1,29 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+type Executor interface {
+	Exec(context context.Context, configuration *config.Config, argv []string) (*ExecResult, error)
+	CopyTo(context context.Context, configuration *config.Config, localPath, remotePath string) error
+	CopyFrom(context context.Context, configuration *config.Config, remotePath, localPath string) error
+}
+
+type ExecResult struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+func ExitCode(err error) (int, bool) {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), true
+	}
+	return 0, false
+}
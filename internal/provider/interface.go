@@ -13,15 +13,41 @@ type VMProvider interface {
 	Delete(context context.Context, configuration *config.Config) error
 	Status(context context.Context, configuration *config.Config) (*VMStatus, error)
 	List(context context.Context) ([]VMStatus, error)
-	SSH(context context.Context, configuration *config.Config) error
+	SSH(context context.Context, configuration *config.Config, argv []string) error
 	Stop(context context.Context, configuration *config.Config) error
 	Start(context context.Context, configuration *config.Config) error
 }
 
+type Snapshotter interface {
+	CreateSnapshot(context context.Context, configuration *config.Config, name string) (*config.Snapshot, error)
+	RestoreSnapshot(context context.Context, configuration *config.Config, snapshot config.Snapshot) error
+	DeleteSnapshot(context context.Context, configuration *config.Config, snapshot config.Snapshot) error
+}
+
 type VMStatus struct {
-	Name      string
-	State     string
-	IP        string
-	Provider  string
-	CreatedAt time.Time
+	Name       string      `json:"name" yaml:"name"`
+	State      string      `json:"state" yaml:"state"`
+	IP         string      `json:"ip" yaml:"ip"`
+	Provider   string      `json:"provider" yaml:"provider"`
+	InstanceID string      `json:"instance_id" yaml:"instance_id"`
+	FQDN       string      `json:"fqdn" yaml:"fqdn"`
+	Image      string      `json:"image" yaml:"image"`
+	CreatedAt  *time.Time  `json:"created_at" yaml:"created_at"`
+	Spot       *SpotStatus `json:"spot,omitempty" yaml:"spot,omitempty"`
+	Idle       *IdleStatus `json:"idle,omitempty" yaml:"idle,omitempty"`
+}
+
+type IdleStatus struct {
+	Minutes      int        `json:"minutes" yaml:"minutes"`
+	CPUPercent   int        `json:"cpu_percent" yaml:"cpu_percent"`
+	IdleSince    *time.Time `json:"idle_since,omitempty" yaml:"idle_since,omitempty"`
+	LastIdleStop *time.Time `json:"last_idle_stop,omitempty" yaml:"last_idle_stop,omitempty"`
+}
+
+type SpotStatus struct {
+	RequestID          string `json:"request_id" yaml:"request_id"`
+	RequestState       string `json:"request_state" yaml:"request_state"`
+	StatusCode         string `json:"status_code" yaml:"status_code"`
+	Message            string `json:"message,omitempty" yaml:"message,omitempty"`
+	InterruptionNotice bool   `json:"interruption_notice" yaml:"interruption_notice"`
 }
@@ -1,6 +1,7 @@
 package multipass
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -13,6 +14,8 @@ import (
 	"github.com/emergingrobotics/goloo/internal/provider"
 )
 
+const DefaultSSHUser = "ubuntu"
+
 type Provider struct {
 	Verbose bool
 }
@@ -86,6 +89,7 @@ func (p *Provider) Status(ctx context.Context, configuration *config.Config) (*p
 		State:    info.State,
 		IP:       ip,
 		Provider: "multipass",
+		Image:    info.Release,
 	}, nil
 }
 
@@ -109,13 +113,19 @@ func (p *Provider) List(ctx context.Context) ([]provider.VMStatus, error) {
 			State:    vm.State,
 			IP:       ip,
 			Provider: "multipass",
+			Image:    vm.Release,
 		})
 	}
 	return statuses, nil
 }
 
-func (p *Provider) SSH(ctx context.Context, configuration *config.Config) error {
-	command := exec.CommandContext(ctx, "multipass", "shell", configuration.VM.Name)
+func (p *Provider) SSH(ctx context.Context, configuration *config.Config, argv []string) error {
+	arguments, err := BuildSSHArgs(configuration, argv)
+	if err != nil {
+		return err
+	}
+	p.verboseLog("exec: %s", strings.Join(arguments, " "))
+	command := exec.CommandContext(ctx, arguments[0], arguments[1:]...)
 	command.Stdin = os.Stdin
 	command.Stdout = os.Stdout
 	command.Stderr = os.Stderr
@@ -136,6 +146,107 @@ func (p *Provider) Start(ctx context.Context, configuration *config.Config) erro
 	return nil
 }
 
+func (p *Provider) CreateSnapshot(ctx context.Context, configuration *config.Config, name string) (*config.Snapshot, error) {
+	if err := p.requireStopped(ctx, configuration.VM.Name); err != nil {
+		return nil, err
+	}
+	if output, err := p.runCommand(ctx, "snapshot", configuration.VM.Name, "--name", name); err != nil {
+		return nil, fmt.Errorf("failed to snapshot %s: %s", configuration.VM.Name, strings.TrimSpace(string(output)))
+	}
+	return &config.Snapshot{Name: name, ID: SnapshotRef(configuration.VM.Name, name), CreatedAt: time.Now().UTC()}, nil
+}
+
+func (p *Provider) RestoreSnapshot(ctx context.Context, configuration *config.Config, snapshot config.Snapshot) error {
+	if err := p.requireStopped(ctx, configuration.VM.Name); err != nil {
+		return err
+	}
+	if output, err := p.runCommand(ctx, "restore", snapshot.ID, "--destructive"); err != nil {
+		return fmt.Errorf("failed to restore %s: %s", snapshot.ID, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (p *Provider) DeleteSnapshot(ctx context.Context, configuration *config.Config, snapshot config.Snapshot) error {
+	if output, err := p.runCommand(ctx, "delete", "--purge", snapshot.ID); err != nil {
+		return fmt.Errorf("failed to delete snapshot %s: %s", snapshot.ID, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (p *Provider) requireStopped(ctx context.Context, name string) error {
+	info, err := p.getInfo(ctx, name)
+	if err != nil {
+		return err
+	}
+	if info.State != "Stopped" {
+		return fmt.Errorf("%s is %s: multipass snapshots need a stopped VM, run 'goloo stop %s' first", name, strings.ToLower(info.State), name)
+	}
+	return nil
+}
+
+func SnapshotRef(vmName, snapshotName string) string {
+	return vmName + "." + snapshotName
+}
+
+func (p *Provider) Exec(ctx context.Context, configuration *config.Config, argv []string) (*provider.ExecResult, error) {
+	return p.runCaptured(ctx, BuildExecArgs(configuration.VM.Name, argv)...)
+}
+
+func (p *Provider) CopyTo(ctx context.Context, configuration *config.Config, localPath, remotePath string) error {
+	recursive := false
+	if info, err := os.Stat(localPath); err == nil && info.IsDir() {
+		recursive = true
+	}
+	arguments := BuildTransferArgs(localPath, configuration.VM.Name+":"+remotePath, recursive)
+	if output, err := p.runCommand(ctx, arguments...); err != nil {
+		return fmt.Errorf("failed to copy %s to %s:%s: %s", localPath, configuration.VM.Name, remotePath, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (p *Provider) CopyFrom(ctx context.Context, configuration *config.Config, remotePath, localPath string) error {
+	arguments := BuildTransferArgs(configuration.VM.Name+":"+remotePath, localPath, true)
+	if output, err := p.runCommand(ctx, arguments...); err != nil {
+		return fmt.Errorf("failed to copy %s:%s to %s: %s", configuration.VM.Name, remotePath, localPath, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (p *Provider) CloudInitStatus(ctx context.Context, configuration *config.Config) (*provider.CloudInitStatus, error) {
+	return provider.ExecReadinessChecker{Executor: p}.CloudInitStatus(ctx, configuration)
+}
+
+func (p *Provider) CloudInitLog(ctx context.Context, configuration *config.Config) (string, error) {
+	return provider.ExecReadinessChecker{Executor: p}.CloudInitLog(ctx, configuration)
+}
+
+func BuildSSHArgs(configuration *config.Config, argv []string) ([]string, error) {
+	if configuration.SSH == nil {
+		if len(argv) == 0 {
+			return []string{"multipass", "shell", configuration.VM.Name}, nil
+		}
+		return append([]string{"multipass"}, BuildExecArgs(configuration.VM.Name, argv)...), nil
+	}
+	if configuration.Local == nil || configuration.Local.IP == "" {
+		return nil, fmt.Errorf("no IP recorded for %s: run 'goloo status %s' to check VM state", configuration.VM.Name, configuration.VM.Name)
+	}
+	target := provider.SSHUser(configuration, DefaultSSHUser) + "@" + configuration.Local.IP
+	return append([]string{"ssh"}, provider.BuildInteractiveSSHArgs(configuration.SSH, target, argv)...), nil
+}
+
+func BuildExecArgs(name string, argv []string) []string {
+	arguments := []string{"exec", name, "--"}
+	return append(arguments, argv...)
+}
+
+func BuildTransferArgs(source, destination string, recursive bool) []string {
+	arguments := []string{"transfer"}
+	if recursive {
+		arguments = append(arguments, "--recursive")
+	}
+	return append(arguments, source, destination)
+}
+
 func BuildLaunchArgs(configuration *config.Config, cloudInitPath string) []string {
 	arguments := []string{"launch", configuration.VM.Image}
 	arguments = append(arguments, "--name", configuration.VM.Name)
@@ -215,6 +326,24 @@ func (p *Provider) runCommand(ctx context.Context, arguments ...string) ([]byte,
 	return command.CombinedOutput()
 }
 
+func (p *Provider) runCaptured(ctx context.Context, arguments ...string) (*provider.ExecResult, error) {
+	p.verboseLog("exec: multipass %s", strings.Join(arguments, " "))
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(ctx, "multipass", arguments...)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	err := command.Run()
+	result := &provider.ExecResult{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+	if err != nil {
+		exitCode, exited := provider.ExitCode(err)
+		if !exited {
+			return nil, fmt.Errorf("multipass exec failed: %w", err)
+		}
+		result.ExitCode = exitCode
+	}
+	return result, nil
+}
+
 func (p *Provider) runStreamingCommand(ctx context.Context, arguments ...string) error {
 	p.verboseLog("exec: multipass %s", strings.Join(arguments, " "))
 	command := exec.CommandContext(ctx, "multipass", arguments...)
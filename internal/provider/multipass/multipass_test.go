@@ -5,8 +5,11 @@ import (
 	"testing"
 
 	"github.com/emergingrobotics/goloo/internal/config"
+	"github.com/emergingrobotics/goloo/internal/provider"
 )
 
+var _ provider.Snapshotter = (*Provider)(nil)
+
 func TestProviderName(t *testing.T) {
 	provider := New(false)
 	if provider.Name() != "multipass" {
@@ -244,3 +247,70 @@ func TestBuildLaunchArgsStartsWithLaunchAndImage(t *testing.T) {
 		t.Errorf("Second arg (image) = %q, want %q", arguments[1], "22.04")
 	}
 }
+
+func TestBuildExecArgs(t *testing.T) {
+	arguments := BuildExecArgs("devbox", []string{"ls", "-la", "/tmp"})
+	expected := []string{"exec", "devbox", "--", "ls", "-la", "/tmp"}
+	if !reflect.DeepEqual(arguments, expected) {
+		t.Errorf("BuildExecArgs() = %v, want %v", arguments, expected)
+	}
+}
+
+func TestBuildTransferArgs(t *testing.T) {
+	arguments := BuildTransferArgs("./app", "devbox:/opt/app", true)
+	expected := []string{"transfer", "--recursive", "./app", "devbox:/opt/app"}
+	if !reflect.DeepEqual(arguments, expected) {
+		t.Errorf("BuildTransferArgs() = %v, want %v", arguments, expected)
+	}
+
+	arguments = BuildTransferArgs("devbox:/etc/hosts", "hosts", false)
+	expected = []string{"transfer", "devbox:/etc/hosts", "hosts"}
+	if !reflect.DeepEqual(arguments, expected) {
+		t.Errorf("BuildTransferArgs() = %v, want %v", arguments, expected)
+	}
+}
+
+func TestBuildSSHArgsUsesMultipassShellByDefault(t *testing.T) {
+	configuration := &config.Config{VM: &config.VMConfig{Name: "devbox"}}
+
+	arguments, err := BuildSSHArgs(configuration, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(arguments, []string{"multipass", "shell", "devbox"}) {
+		t.Errorf("BuildSSHArgs() = %v", arguments)
+	}
+
+	arguments, _ = BuildSSHArgs(configuration, []string{"uptime"})
+	if !reflect.DeepEqual(arguments, []string{"multipass", "exec", "devbox", "--", "uptime"}) {
+		t.Errorf("BuildSSHArgs() with command = %v", arguments)
+	}
+}
+
+func TestBuildSSHArgsWithSSHConfig(t *testing.T) {
+	configuration := &config.Config{
+		VM:    &config.VMConfig{Name: "devbox"},
+		SSH:   &config.SSHConfig{User: "dev", LocalForwards: []string{"8080:localhost:80"}},
+		Local: &config.LocalState{IP: "192.168.64.5"},
+	}
+
+	arguments, err := BuildSSHArgs(configuration, []string{"ls", "-la"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"ssh", "-L", "8080:localhost:80", "dev@192.168.64.5", "ls -la"}
+	if !reflect.DeepEqual(arguments, expected) {
+		t.Errorf("BuildSSHArgs() = %v, want %v", arguments, expected)
+	}
+
+	configuration.Local = nil
+	if _, err := BuildSSHArgs(configuration, nil); err == nil {
+		t.Error("BuildSSHArgs() should fail without a recorded IP")
+	}
+}
+
+func TestSnapshotRef(t *testing.T) {
+	if ref := SnapshotRef("devbox", "pre-upgrade"); ref != "devbox.pre-upgrade" {
+		t.Errorf("SnapshotRef() = %q, want %q", ref, "devbox.pre-upgrade")
+	}
+}
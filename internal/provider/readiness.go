@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+const CloudInitOutputLog = "/var/log/cloud-init-output.log"
+
+type ReadinessChecker interface {
+	CloudInitStatus(context context.Context, configuration *config.Config) (*CloudInitStatus, error)
+	CloudInitLog(context context.Context, configuration *config.Config) (string, error)
+}
+
+type ExecReadinessChecker struct {
+	Executor Executor
+}
+
+func (c ExecReadinessChecker) CloudInitStatus(ctx context.Context, configuration *config.Config) (*CloudInitStatus, error) {
+	result, err := c.Executor.Exec(ctx, configuration, []string{"cloud-init", "status", "--format", "json"})
+	if err != nil {
+		return nil, err
+	}
+	status, parseErr := ParseCloudInitStatus(result.Stdout)
+	if parseErr != nil && result.ExitCode != 0 {
+		return nil, fmt.Errorf("cloud-init status failed on %s: exit %d: %s", configuration.VM.Name, result.ExitCode, strings.TrimSpace(string(result.Stderr)))
+	}
+	return status, parseErr
+}
+
+func (c ExecReadinessChecker) CloudInitLog(ctx context.Context, configuration *config.Config) (string, error) {
+	result, err := c.Executor.Exec(ctx, configuration, []string{"sudo", "cat", CloudInitOutputLog})
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("failed to read %s on %s: %s", CloudInitOutputLog, configuration.VM.Name, strings.TrimSpace(string(result.Stderr)))
+	}
+	return string(result.Stdout), nil
+}
+
+type CloudInitStatus struct {
+	Status         string   `json:"status"`
+	ExtendedStatus string   `json:"extended_status"`
+	Errors         []string `json:"errors"`
+}
+
+type CloudInitError struct {
+	Name   string
+	Status *CloudInitStatus
+	Log    string
+}
+
+func (e *CloudInitError) Error() string {
+	message := fmt.Sprintf("cloud-init failed on %s: status %q", e.Name, e.Status.Status)
+	if len(e.Status.Errors) > 0 {
+		message += ": " + strings.Join(e.Status.Errors, "; ")
+	}
+	return message
+}
+
+func ParseCloudInitStatus(data []byte) (*CloudInitStatus, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if start := strings.Index(trimmed, "{"); start > 0 {
+		trimmed = trimmed[start:]
+	}
+	var status CloudInitStatus
+	if err := json.Unmarshal([]byte(trimmed), &status); err != nil {
+		return nil, fmt.Errorf("failed to parse cloud-init status output: %w", err)
+	}
+	if status.Status == "" {
+		return nil, fmt.Errorf("cloud-init status output has no status field")
+	}
+	return &status, nil
+}
+
+func (s *CloudInitStatus) Finished() bool {
+	return s.Status == "done" || s.Status == "disabled" || s.Status == "error"
+}
+
+func (s *CloudInitStatus) Failed() bool {
+	return s.Status == "error" || len(s.Errors) > 0
+}
+
+func WaitForCloudInit(ctx context.Context, checker ReadinessChecker, configuration *config.Config, interval time.Duration, progress func(status string)) error {
+	lastStatus := ""
+	for {
+		status, err := checker.CloudInitStatus(ctx, configuration)
+		if err == nil && status.Finished() {
+			if !status.Failed() {
+				return nil
+			}
+			log, logErr := checker.CloudInitLog(ctx, configuration)
+			if logErr != nil {
+				log = fmt.Sprintf("(failed to read %s: %v)", CloudInitOutputLog, logErr)
+			}
+			return &CloudInitError{Name: configuration.VM.Name, Status: status, Log: log}
+		}
+
+		current := "unreachable"
+		if err == nil {
+			current = status.Status
+		}
+		if progress != nil && current != lastStatus {
+			progress(current)
+			lastStatus = current
+		}
+
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("timed out waiting for cloud-init on %s: %w", configuration.VM.Name, err)
+			}
+			return fmt.Errorf("timed out waiting for cloud-init on %s: last status %q", configuration.VM.Name, current)
+		case <-time.After(interval):
+		}
+	}
+}
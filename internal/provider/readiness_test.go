@@ -0,0 +1,163 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+type fakeChecker struct {
+	responses []*CloudInitStatus
+	errs      []error
+	calls     int
+	log       string
+}
+
+func (f *fakeChecker) CloudInitStatus(_ context.Context, _ *config.Config) (*CloudInitStatus, error) {
+	index := f.calls
+	if index >= len(f.responses) {
+		index = len(f.responses) - 1
+	}
+	f.calls++
+	return f.responses[index], f.errs[index]
+}
+
+func (f *fakeChecker) CloudInitLog(_ context.Context, _ *config.Config) (string, error) {
+	return f.log, nil
+}
+
+func waitConfig() *config.Config {
+	return &config.Config{VM: &config.VMConfig{Name: "devbox"}}
+}
+
+func TestParseCloudInitStatus(t *testing.T) {
+	status, err := ParseCloudInitStatus([]byte(`{"status": "done", "extended_status": "done", "errors": []}`))
+	if err != nil {
+		t.Fatalf("ParseCloudInitStatus() returned error: %v", err)
+	}
+	if !status.Finished() || status.Failed() {
+		t.Errorf("status %+v should be finished without failure", status)
+	}
+}
+
+func TestParseCloudInitStatusSkipsLeadingNoise(t *testing.T) {
+	status, err := ParseCloudInitStatus([]byte("......\n{\"status\": \"running\"}"))
+	if err != nil {
+		t.Fatalf("ParseCloudInitStatus() returned error: %v", err)
+	}
+	if status.Finished() {
+		t.Error("running status should not be finished")
+	}
+}
+
+func TestParseCloudInitStatusInvalid(t *testing.T) {
+	for _, input := range []string{"", "not json", `{"boot_status_code": "enabled"}`} {
+		if _, err := ParseCloudInitStatus([]byte(input)); err == nil {
+			t.Errorf("ParseCloudInitStatus(%q) should return error", input)
+		}
+	}
+}
+
+func TestWaitForCloudInitPollsUntilDone(t *testing.T) {
+	checker := &fakeChecker{
+		responses: []*CloudInitStatus{nil, {Status: "running"}, {Status: "done"}},
+		errs:      []error{fmt.Errorf("connection refused"), nil, nil},
+	}
+	var progress []string
+	err := WaitForCloudInit(context.Background(), checker, waitConfig(), time.Millisecond, func(status string) {
+		progress = append(progress, status)
+	})
+	if err != nil {
+		t.Fatalf("WaitForCloudInit() returned error: %v", err)
+	}
+	if checker.calls != 3 {
+		t.Errorf("expected 3 status checks, got %d", checker.calls)
+	}
+	if strings.Join(progress, ",") != "unreachable,running" {
+		t.Errorf("progress = %v", progress)
+	}
+}
+
+func TestWaitForCloudInitReportsErrors(t *testing.T) {
+	checker := &fakeChecker{
+		responses: []*CloudInitStatus{{Status: "error", Errors: []string{"package install failed"}}},
+		errs:      []error{nil},
+		log:       "E: Unable to locate package nosuchpackage",
+	}
+	err := WaitForCloudInit(context.Background(), checker, waitConfig(), time.Millisecond, nil)
+	var cloudInitErr *CloudInitError
+	if !errors.As(err, &cloudInitErr) {
+		t.Fatalf("expected CloudInitError, got %v", err)
+	}
+	if !strings.Contains(cloudInitErr.Log, "nosuchpackage") {
+		t.Errorf("error should carry cloud-init output log, got %q", cloudInitErr.Log)
+	}
+	if !strings.Contains(err.Error(), "package install failed") {
+		t.Errorf("error message should include cloud-init errors, got %v", err)
+	}
+}
+
+func TestWaitForCloudInitTimeout(t *testing.T) {
+	checker := &fakeChecker{
+		responses: []*CloudInitStatus{{Status: "running"}},
+		errs:      []error{nil},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := WaitForCloudInit(ctx, checker, waitConfig(), time.Millisecond, nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
+
+type fakeExecutor struct {
+	results map[string]*ExecResult
+}
+
+func (f *fakeExecutor) Exec(_ context.Context, _ *config.Config, argv []string) (*ExecResult, error) {
+	result, exists := f.results[strings.Join(argv, " ")]
+	if !exists {
+		return nil, fmt.Errorf("unexpected command %v", argv)
+	}
+	return result, nil
+}
+
+func (f *fakeExecutor) CopyTo(_ context.Context, _ *config.Config, _, _ string) error   { return nil }
+func (f *fakeExecutor) CopyFrom(_ context.Context, _ *config.Config, _, _ string) error { return nil }
+
+func TestExecReadinessChecker(t *testing.T) {
+	executor := &fakeExecutor{results: map[string]*ExecResult{
+		"cloud-init status --format json": {Stdout: []byte(`{"status": "error", "errors": ["boom"]}`), ExitCode: 1},
+		"sudo cat " + CloudInitOutputLog:  {Stdout: []byte("log contents")},
+	}}
+	checker := ExecReadinessChecker{Executor: executor}
+
+	status, err := checker.CloudInitStatus(context.Background(), waitConfig())
+	if err != nil {
+		t.Fatalf("CloudInitStatus() returned error: %v", err)
+	}
+	if !status.Failed() {
+		t.Errorf("status %+v should be failed even though cloud-init exited non-zero", status)
+	}
+
+	log, err := checker.CloudInitLog(context.Background(), waitConfig())
+	if err != nil || log != "log contents" {
+		t.Errorf("CloudInitLog() = %q, %v", log, err)
+	}
+}
+
+func TestExecReadinessCheckerUnparseableOutput(t *testing.T) {
+	executor := &fakeExecutor{results: map[string]*ExecResult{
+		"cloud-init status --format json": {Stderr: []byte("cloud-init: command not found"), ExitCode: 127},
+	}}
+	_, err := ExecReadinessChecker{Executor: executor}.CloudInitStatus(context.Background(), waitConfig())
+	if err == nil || !strings.Contains(err.Error(), "command not found") {
+		t.Errorf("expected error with stderr, got %v", err)
+	}
+}
@@ -16,7 +16,7 @@ func (f *fakeProvider) Create(_ context.Context, _ *config.Config, _ string) err
 func (f *fakeProvider) Delete(_ context.Context, _ *config.Config) error                      { return nil }
 func (f *fakeProvider) Status(_ context.Context, _ *config.Config) (*VMStatus, error)         { return nil, nil }
 func (f *fakeProvider) List(_ context.Context) ([]VMStatus, error)                            { return nil, nil }
-func (f *fakeProvider) SSH(_ context.Context, _ *config.Config) error                         { return nil }
+func (f *fakeProvider) SSH(_ context.Context, _ *config.Config, _ []string) error             { return nil }
 func (f *fakeProvider) Stop(_ context.Context, _ *config.Config) error                        { return nil }
 func (f *fakeProvider) Start(_ context.Context, _ *config.Config) error                       { return nil }
 
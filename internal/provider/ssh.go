@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+func SSHUser(configuration *config.Config, defaultUser string) string {
+	if configuration.SSH != nil && configuration.SSH.User != "" {
+		return configuration.SSH.User
+	}
+	return defaultUser
+}
+
+func SSHConnectionArgs(sshConfig *config.SSHConfig, portFlag string) []string {
+	if sshConfig == nil {
+		return nil
+	}
+	var arguments []string
+	if sshConfig.IdentityFile != "" {
+		identityFile, err := config.ExpandHome(sshConfig.IdentityFile)
+		if err != nil {
+			identityFile = sshConfig.IdentityFile
+		}
+		arguments = append(arguments, "-i", identityFile)
+	}
+	if sshConfig.Port != 0 {
+		arguments = append(arguments, portFlag, strconv.Itoa(sshConfig.Port))
+	}
+	if sshConfig.ProxyJump != "" {
+		arguments = append(arguments, "-J", sshConfig.ProxyJump)
+	}
+	keys := make([]string, 0, len(sshConfig.Options))
+	for key := range sshConfig.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		arguments = append(arguments, "-o", key+"="+sshConfig.Options[key])
+	}
+	return arguments
+}
+
+func BuildInteractiveSSHArgs(sshConfig *config.SSHConfig, target string, argv []string) []string {
+	arguments := SSHConnectionArgs(sshConfig, "-p")
+	if sshConfig != nil {
+		for _, forward := range sshConfig.LocalForwards {
+			arguments = append(arguments, "-L", forward)
+		}
+		for _, forward := range sshConfig.RemoteForwards {
+			arguments = append(arguments, "-R", forward)
+		}
+		arguments = append(arguments, sshConfig.ExtraArgs...)
+	}
+	arguments = append(arguments, target)
+	if len(argv) > 0 {
+		arguments = append(arguments, ShellJoin(argv))
+	}
+	return arguments
+}
+
+func ShellJoin(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, argument := range argv {
+		quoted[i] = ShellQuote(argument)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func ShellQuote(argument string) string {
+	if argument != "" && strings.Trim(argument, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:@,+%") == "" {
+		return argument
+	}
+	return "'" + strings.ReplaceAll(argument, "'", `'\''`) + "'"
+}
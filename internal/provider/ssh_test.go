@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+func TestSSHConnectionArgsNil(t *testing.T) {
+	if arguments := SSHConnectionArgs(nil, "-p"); len(arguments) != 0 {
+		t.Errorf("SSHConnectionArgs(nil) = %v, want empty", arguments)
+	}
+}
+
+func TestBuildInteractiveSSHArgs(t *testing.T) {
+	t.Setenv("HOME", "/home/dev")
+	sshConfig := &config.SSHConfig{
+		IdentityFile:   "~/.ssh/work",
+		Port:           2222,
+		ProxyJump:      "bastion",
+		LocalForwards:  []string{"5432:db:5432"},
+		RemoteForwards: []string{"9000:localhost:9000"},
+		Options:        map[string]string{"StrictHostKeyChecking": "no", "ForwardAgent": "yes"},
+		ExtraArgs:      []string{"-A"},
+	}
+
+	arguments := BuildInteractiveSSHArgs(sshConfig, "ubuntu@10.0.0.5", []string{"echo", "hi there"})
+	expected := []string{
+		"-i", "/home/dev/.ssh/work",
+		"-p", "2222",
+		"-J", "bastion",
+		"-o", "ForwardAgent=yes",
+		"-o", "StrictHostKeyChecking=no",
+		"-L", "5432:db:5432",
+		"-R", "9000:localhost:9000",
+		"-A",
+		"ubuntu@10.0.0.5",
+		"echo 'hi there'",
+	}
+	if !reflect.DeepEqual(arguments, expected) {
+		t.Errorf("BuildInteractiveSSHArgs() =\n%v\nwant:\n%v", arguments, expected)
+	}
+}
+
+func TestSSHUser(t *testing.T) {
+	configuration := &config.Config{}
+	if got := SSHUser(configuration, "ubuntu"); got != "ubuntu" {
+		t.Errorf("SSHUser() = %q, want ubuntu", got)
+	}
+	configuration.SSH = &config.SSHConfig{User: "admin"}
+	if got := SSHUser(configuration, "ubuntu"); got != "admin" {
+		t.Errorf("SSHUser() = %q, want admin", got)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"plain":       "plain",
+		"/usr/bin/ls": "/usr/bin/ls",
+		"":            "''",
+		"two words":   "'two words'",
+		"it's":        `'it'\''s'`,
+		"$HOME":       "'$HOME'",
+	}
+	for input, want := range tests {
+		if got := ShellQuote(input); got != want {
+			t.Errorf("ShellQuote(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package sshconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	configFileName  = "config"
+	golooFileName   = "goloo.conf"
+	includeLine     = "Include " + golooFileName
+	includeComment  = "# Added by goloo: per-VM Host entries"
+	defaultFileMode = 0600
+)
+
+var hostAliasRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+type Entry struct {
+	Name         string
+	HostName     string
+	User         string
+	IdentityFile string
+	Port         int
+	ProxyJump    string
+}
+
+func DefaultDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve ~/.ssh: %w", err)
+	}
+	return filepath.Join(home, ".ssh"), nil
+}
+
+func GolooPath(sshDir string) string {
+	return filepath.Join(sshDir, golooFileName)
+}
+
+func ConfigPath(sshDir string) string {
+	return filepath.Join(sshDir, configFileName)
+}
+
+func Validate(entry Entry) error {
+	if !hostAliasRegex.MatchString(entry.Name) {
+		return fmt.Errorf("invalid ssh host alias %q", entry.Name)
+	}
+	if entry.HostName == "" {
+		return fmt.Errorf("no address for %s: the VM has no recorded IP", entry.Name)
+	}
+	for field, value := range map[string]string{
+		"HostName":     entry.HostName,
+		"User":         entry.User,
+		"IdentityFile": entry.IdentityFile,
+		"ProxyJump":    entry.ProxyJump,
+	} {
+		if strings.ContainsAny(value, "\n\r") {
+			return fmt.Errorf("invalid %s for %s: must be a single line", field, entry.Name)
+		}
+	}
+	return nil
+}
+
+func startMarker(name string) string {
+	return "# goloo:" + name
+}
+
+func endMarker(name string) string {
+	return "# /goloo:" + name
+}
+
+func buildBlock(entry Entry) string {
+	var builder strings.Builder
+	builder.WriteString(startMarker(entry.Name) + "\n")
+	builder.WriteString("Host " + entry.Name + "\n")
+	builder.WriteString("    HostName " + entry.HostName + "\n")
+	if entry.User != "" {
+		builder.WriteString("    User " + entry.User + "\n")
+	}
+	if entry.Port != 0 {
+		builder.WriteString("    Port " + strconv.Itoa(entry.Port) + "\n")
+	}
+	if entry.IdentityFile != "" {
+		builder.WriteString("    IdentityFile " + quoteValue(entry.IdentityFile) + "\n")
+		builder.WriteString("    IdentitiesOnly yes\n")
+	}
+	if entry.ProxyJump != "" {
+		builder.WriteString("    ProxyJump " + entry.ProxyJump + "\n")
+	}
+	builder.WriteString(endMarker(entry.Name) + "\n")
+	return builder.String()
+}
+
+func quoteValue(value string) string {
+	if strings.ContainsAny(value, " \t") {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+func removeBlock(content, name string) string {
+	start := startMarker(name)
+	end := endMarker(name)
+
+	lines := strings.Split(content, "\n")
+	var result []string
+	inside := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == start {
+			inside = true
+			continue
+		}
+		if inside && strings.TrimSpace(line) == end {
+			inside = false
+			continue
+		}
+		if !inside {
+			result = append(result, line)
+		}
+	}
+	return strings.Join(result, "\n")
+}
+
+func hasInclude(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "Include") {
+			continue
+		}
+		for _, target := range fields[1:] {
+			if filepath.Base(target) == golooFileName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func EnsureInclude(sshDir string) error {
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", sshDir, err)
+	}
+	path := ConfigPath(sshDir)
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if hasInclude(string(content)) {
+		return nil
+	}
+	updated := includeComment + "\n" + includeLine + "\n\n" + string(content)
+	return writeFile(path, updated)
+}
+
+func Add(sshDir string, entry Entry) error {
+	if err := Validate(entry); err != nil {
+		return err
+	}
+	if err := EnsureInclude(sshDir); err != nil {
+		return err
+	}
+
+	path := GolooPath(sshDir)
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	cleaned := removeBlock(string(content), entry.Name)
+	if cleaned != "" && !strings.HasSuffix(cleaned, "\n") {
+		cleaned += "\n"
+	}
+	return writeFile(path, cleaned+buildBlock(entry))
+}
+
+func Remove(sshDir, name string) error {
+	path := GolooPath(sshDir)
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	cleaned := removeBlock(string(content), name)
+	if string(content) == cleaned {
+		return nil
+	}
+	return writeFile(path, cleaned)
+}
+
+func HasEntry(sshDir, name string) bool {
+	content, err := os.ReadFile(GolooPath(sshDir))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == startMarker(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeFile(path, content string) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	mode := os.FileMode(defaultFileMode)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	temporaryPath := path + ".tmp"
+	if err := os.WriteFile(temporaryPath, []byte(content), mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(temporaryPath, path); err != nil {
+		os.Remove(temporaryPath)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateValid(t *testing.T) {
+	entry := Entry{Name: "devbox", HostName: "10.0.0.5", User: "ubuntu"}
+	if err := Validate(entry); err != nil {
+		t.Errorf("expected valid entry, got error: %v", err)
+	}
+}
+
+func TestValidateInvalid(t *testing.T) {
+	for _, entry := range []Entry{
+		{Name: "", HostName: "10.0.0.5"},
+		{Name: "has space", HostName: "10.0.0.5"},
+		{Name: "*", HostName: "10.0.0.5"},
+		{Name: "devbox", HostName: ""},
+		{Name: "devbox", HostName: "10.0.0.5", User: "ubuntu\nHost *"},
+	} {
+		if err := Validate(entry); err == nil {
+			t.Errorf("expected error for entry %+v", entry)
+		}
+	}
+}
+
+func TestBuildBlock(t *testing.T) {
+	block := buildBlock(Entry{
+		Name:         "devbox",
+		HostName:     "10.0.0.5",
+		User:         "ubuntu",
+		IdentityFile: "~/.ssh/id_ed25519",
+		Port:         2222,
+		ProxyJump:    "bastion",
+	})
+	expected := "# goloo:devbox\n" +
+		"Host devbox\n" +
+		"    HostName 10.0.0.5\n" +
+		"    User ubuntu\n" +
+		"    Port 2222\n" +
+		"    IdentityFile ~/.ssh/id_ed25519\n" +
+		"    IdentitiesOnly yes\n" +
+		"    ProxyJump bastion\n" +
+		"# /goloo:devbox\n"
+	if block != expected {
+		t.Errorf("unexpected block:\n%s", block)
+	}
+}
+
+func TestBuildBlockQuotesIdentityFileWithSpaces(t *testing.T) {
+	block := buildBlock(Entry{Name: "devbox", HostName: "10.0.0.5", IdentityFile: "/keys/my key"})
+	if !strings.Contains(block, `IdentityFile "/keys/my key"`) {
+		t.Errorf("expected quoted IdentityFile, got:\n%s", block)
+	}
+}
+
+func TestAddCreatesFilesAndInclude(t *testing.T) {
+	sshDir := filepath.Join(t.TempDir(), ".ssh")
+	if err := Add(sshDir, Entry{Name: "devbox", HostName: "10.0.0.5", User: "ubuntu"}); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := os.ReadFile(ConfigPath(sshDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(config), includeComment+"\n"+includeLine+"\n") {
+		t.Errorf("expected Include at top of ssh config, got:\n%s", config)
+	}
+
+	golooConfig, err := os.ReadFile(GolooPath(sshDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(golooConfig), "Host devbox\n    HostName 10.0.0.5\n") {
+		t.Errorf("expected devbox entry, got:\n%s", golooConfig)
+	}
+
+	info, err := os.Stat(GolooPath(sshDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %o", info.Mode().Perm())
+	}
+}
+
+func TestEnsureIncludePreservesExistingConfig(t *testing.T) {
+	sshDir := t.TempDir()
+	existing := "Host github.com\n    User git\n"
+	if err := os.WriteFile(ConfigPath(sshDir), []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := EnsureInclude(sshDir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := os.ReadFile(ConfigPath(sshDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(content), includeLine) != 1 {
+		t.Errorf("expected exactly one Include line, got:\n%s", content)
+	}
+	if !strings.HasSuffix(string(content), existing) {
+		t.Errorf("expected existing config to be preserved, got:\n%s", content)
+	}
+	info, err := os.Stat(ConfigPath(sshDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("expected mode 0644 to be preserved, got %o", info.Mode().Perm())
+	}
+}
+
+func TestEnsureIncludeRecognizesExistingInclude(t *testing.T) {
+	sshDir := t.TempDir()
+	existing := "Include ~/.ssh/goloo.conf\n"
+	if err := os.WriteFile(ConfigPath(sshDir), []byte(existing), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureInclude(sshDir); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(ConfigPath(sshDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != existing {
+		t.Errorf("expected config unchanged, got:\n%s", content)
+	}
+}
+
+func TestAddReplacesExistingEntry(t *testing.T) {
+	sshDir := t.TempDir()
+	if err := Add(sshDir, Entry{Name: "devbox", HostName: "10.0.0.5"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add(sshDir, Entry{Name: "other", HostName: "10.0.0.6"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add(sshDir, Entry{Name: "devbox", HostName: "10.0.0.7"}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(GolooPath(sshDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(content), "Host devbox") != 1 {
+		t.Errorf("expected one devbox entry, got:\n%s", content)
+	}
+	if strings.Contains(string(content), "10.0.0.5") {
+		t.Errorf("expected old address to be replaced, got:\n%s", content)
+	}
+	if !strings.Contains(string(content), "HostName 10.0.0.7") || !strings.Contains(string(content), "Host other") {
+		t.Errorf("expected updated devbox and untouched other, got:\n%s", content)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	sshDir := t.TempDir()
+	if err := Add(sshDir, Entry{Name: "devbox", HostName: "10.0.0.5"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add(sshDir, Entry{Name: "devbox2", HostName: "10.0.0.6"}); err != nil {
+		t.Fatal(err)
+	}
+	if !HasEntry(sshDir, "devbox") {
+		t.Fatal("expected devbox entry to exist")
+	}
+
+	if err := Remove(sshDir, "devbox"); err != nil {
+		t.Fatal(err)
+	}
+	if HasEntry(sshDir, "devbox") {
+		t.Error("expected devbox entry to be removed")
+	}
+	if !HasEntry(sshDir, "devbox2") {
+		t.Error("expected devbox2 entry to remain")
+	}
+}
+
+func TestRemoveMissingFile(t *testing.T) {
+	if err := Remove(t.TempDir(), "devbox"); err != nil {
+		t.Errorf("expected no error removing from missing file, got: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type ArchiveEntry struct {
+	Entry string
+	State *State
+}
+
+func (s *Store) ListArchive() ([]ArchiveEntry, error) {
+	entries, err := os.ReadDir(s.ArchiveDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive directory: %w", err)
+	}
+	var archived []ArchiveEntry
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		state, err := readState(filepath.Join(s.ArchiveDir(), entry.Name(), stateFileName))
+		if err != nil {
+			continue
+		}
+		archived = append(archived, ArchiveEntry{Entry: entry.Name(), State: state})
+	}
+	sort.Slice(archived, func(i, j int) bool {
+		return archived[i].destroyedAt().Before(archived[j].destroyedAt())
+	})
+	return archived, nil
+}
+
+func (a ArchiveEntry) destroyedAt() time.Time {
+	if a.State.DestroyedAt != nil {
+		return *a.State.DestroyedAt
+	}
+	return a.State.CreatedAt
+}
+
+func (s *Store) archiveEntryDir(entry string) (string, error) {
+	if entry == "" || entry != filepath.Base(entry) || entry == "." || entry == ".." {
+		return "", fmt.Errorf("invalid archive entry %q", entry)
+	}
+	directory := filepath.Join(s.ArchiveDir(), entry)
+	if _, err := os.Stat(directory); err != nil {
+		return "", fmt.Errorf("archive entry %q not found: run 'goloo archive list'", entry)
+	}
+	return directory, nil
+}
+
+func (s *Store) DeleteArchive(entry string) error {
+	directory, err := s.archiveEntryDir(entry)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(directory)
+}
+
+func (s *Store) CleanArchive(olderThan time.Duration, now time.Time) ([]string, error) {
+	archived, err := s.ListArchive()
+	if err != nil {
+		return nil, err
+	}
+	cutoff := now.Add(-olderThan)
+	var removed []string
+	for _, entry := range archived {
+		if !entry.destroyedAt().Before(cutoff) {
+			continue
+		}
+		if err := s.DeleteArchive(entry.Entry); err != nil {
+			return removed, err
+		}
+		removed = append(removed, entry.Entry)
+	}
+	return removed, nil
+}
+
+func (s *Store) RestoreArchive(entry string, destinationDir string) error {
+	directory, err := s.archiveEntryDir(entry)
+	if err != nil {
+		return err
+	}
+	destinationConfig := filepath.Join(destinationDir, configFileName)
+	if _, err := os.Stat(destinationConfig); err == nil {
+		return fmt.Errorf("%s already exists: move it aside before restoring", destinationConfig)
+	}
+	if err := os.MkdirAll(destinationDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", destinationDir, err)
+	}
+	if err := copyFile(filepath.Join(directory, configFileName), destinationConfig); err != nil {
+		return err
+	}
+	cloudInitSource := filepath.Join(directory, cloudInitFileName)
+	if _, err := os.Stat(cloudInitSource); err == nil {
+		if err := copyFile(cloudInitSource, filepath.Join(destinationDir, cloudInitFileName)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) LoadArchivedState(entry string) (*State, error) {
+	directory, err := s.archiveEntryDir(entry)
+	if err != nil {
+		return nil, err
+	}
+	return readState(filepath.Join(directory, stateFileName))
+}
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+func archiveTestVM(t *testing.T, stateStore *Store, name string, destroyedAt time.Time) string {
+	t.Helper()
+	configuration := testConfig()
+	configuration.VM.Name = name
+	stateStore.SaveConfig(name, configuration)
+	stateStore.SaveState(name, NewState(name, "aws", "", configuration))
+
+	entry, err := stateStore.Archive(name)
+	if err != nil {
+		t.Fatalf("Archive() returned error: %v", err)
+	}
+
+	statePath := filepath.Join(stateStore.ArchiveDir(), entry, stateFileName)
+	state, err := readState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.DestroyedAt = &destroyedAt
+	if err := writeJSON(filepath.Dir(statePath), statePath, state); err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+func TestListArchiveEmpty(t *testing.T) {
+	stateStore := New(t.TempDir())
+	entries, err := stateStore.ListArchive()
+	if err != nil {
+		t.Fatalf("ListArchive() returned error: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no entries, got %d", len(entries))
+	}
+}
+
+func TestListArchiveSortedByDestroyedTime(t *testing.T) {
+	stateStore := New(t.TempDir())
+	now := time.Now().UTC()
+	archiveTestVM(t, stateStore, "web", now.Add(-time.Hour))
+	archiveTestVM(t, stateStore, "devbox", now.Add(-48*time.Hour))
+
+	entries, err := stateStore.ListArchive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].State.Name != "devbox" || entries[1].State.Name != "web" {
+		t.Errorf("expected [devbox web], got [%s %s]", entries[0].State.Name, entries[1].State.Name)
+	}
+	if entries[0].State.AWS == nil || entries[0].State.AWS.InstanceID != "i-0123456789abcdef0" {
+		t.Errorf("archived entry should keep instance ID, got %v", entries[0].State.AWS)
+	}
+}
+
+func TestCleanArchiveRemovesOldEntries(t *testing.T) {
+	stateStore := New(t.TempDir())
+	now := time.Now().UTC()
+	oldEntry := archiveTestVM(t, stateStore, "devbox", now.Add(-40*24*time.Hour))
+	archiveTestVM(t, stateStore, "web", now.Add(-24*time.Hour))
+
+	removed, err := stateStore.CleanArchive(30*24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("CleanArchive() returned error: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != oldEntry {
+		t.Errorf("CleanArchive() removed %v, want [%s]", removed, oldEntry)
+	}
+
+	entries, _ := stateStore.ListArchive()
+	if len(entries) != 1 || entries[0].State.Name != "web" {
+		t.Errorf("expected only web to remain, got %v", entries)
+	}
+}
+
+func TestDeleteArchive(t *testing.T) {
+	stateStore := New(t.TempDir())
+	entry := archiveTestVM(t, stateStore, "devbox", time.Now().UTC())
+
+	if err := stateStore.DeleteArchive(entry); err != nil {
+		t.Fatalf("DeleteArchive() returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(stateStore.ArchiveDir(), entry)); !os.IsNotExist(err) {
+		t.Error("archive entry should be removed")
+	}
+}
+
+func TestDeleteArchiveRejectsInvalidEntries(t *testing.T) {
+	stateStore := New(t.TempDir())
+	for _, entry := range []string{"", ".", "..", "../active", "missing-20250101T000000"} {
+		if err := stateStore.DeleteArchive(entry); err == nil {
+			t.Errorf("expected error for archive entry %q", entry)
+		}
+	}
+}
+
+func TestRestoreArchiveCopiesSnapshots(t *testing.T) {
+	stateStore := New(t.TempDir())
+	os.MkdirAll(stateStore.ActiveDir("devbox"), 0755)
+	os.WriteFile(stateStore.CloudInitPath("devbox"), []byte("#cloud-config\n"), 0644)
+	entry := archiveTestVM(t, stateStore, "devbox", time.Now().UTC())
+
+	destination := filepath.Join(t.TempDir(), "stacks", "devbox")
+	if err := stateStore.RestoreArchive(entry, destination); err != nil {
+		t.Fatalf("RestoreArchive() returned error: %v", err)
+	}
+
+	restored, _, err := config.LoadFromPath(filepath.Join(destination, "config.json"))
+	if err != nil {
+		t.Fatalf("restored config should load: %v", err)
+	}
+	if restored.VM.Name != "devbox" {
+		t.Errorf("VM.Name = %q, want %q", restored.VM.Name, "devbox")
+	}
+	if restored.AWS != nil {
+		t.Error("restored config should not contain provider state")
+	}
+	data, err := os.ReadFile(filepath.Join(destination, "cloud-init.yaml"))
+	if err != nil || string(data) != "#cloud-config\n" {
+		t.Errorf("restored cloud-init = %q, err %v", data, err)
+	}
+}
+
+func TestRestoreArchiveRefusesToOverwrite(t *testing.T) {
+	stateStore := New(t.TempDir())
+	entry := archiveTestVM(t, stateStore, "devbox", time.Now().UTC())
+
+	destination := t.TempDir()
+	os.WriteFile(filepath.Join(destination, "config.json"), []byte("{}"), 0644)
+
+	if err := stateStore.RestoreArchive(entry, destination); err == nil {
+		t.Fatal("expected error when config.json already exists")
+	}
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+const (
+	MigrationImported = "imported"
+	MigrationPending  = "would import"
+	MigrationExists   = "already migrated"
+	MigrationConflict = "conflict"
+	MigrationInvalid  = "invalid"
+)
+
+var legacyProviderDirs = []struct {
+	dir      string
+	provider string
+}{
+	{dir: "local", provider: "multipass"},
+	{dir: "aws", provider: "aws"},
+}
+
+type MigrationResult struct {
+	Name      string
+	Provider  string
+	StatePath string
+	Status    string
+	Reason    string
+}
+
+func (s *Store) Migrate(folder string, dryRun bool) ([]MigrationResult, error) {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stacks folder %s: %w", folder, err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	planned := make(map[string]string)
+	var results []MigrationResult
+	for _, name := range names {
+		for _, legacy := range legacyProviderDirs {
+			if !config.HasState(folder, name, legacy.dir) {
+				continue
+			}
+			result, err := s.importLegacy(folder, name, legacy.provider, dryRun, planned)
+			if err != nil {
+				return results, err
+			}
+			results = append(results, *result)
+		}
+	}
+	return results, nil
+}
+
+func (s *Store) ImportLegacy(folder, name, providerName string) (*MigrationResult, error) {
+	return s.importLegacy(folder, name, providerName, false, make(map[string]string))
+}
+
+func (s *Store) importLegacy(folder, name, providerName string, dryRun bool, planned map[string]string) (*MigrationResult, error) {
+	dir := legacyDirName(providerName)
+	result := &MigrationResult{
+		Name:      name,
+		Provider:  providerName,
+		StatePath: config.StatePath(folder, name, dir),
+	}
+
+	configuration, _, err := config.LoadState(folder, name, dir)
+	if err != nil {
+		result.Status = MigrationInvalid
+		result.Reason = err.Error()
+		return result, nil
+	}
+	if (providerName == "aws" && configuration.AWS == nil) || (providerName == "multipass" && configuration.Local == nil) {
+		result.Status = MigrationInvalid
+		result.Reason = fmt.Sprintf("no %s state block", dir)
+		return result, nil
+	}
+
+	if s.Exists(name) {
+		existing, err := s.LoadState(name)
+		if err != nil {
+			return nil, err
+		}
+		if sameVM(existing, providerName, configuration) {
+			result.Status = MigrationExists
+			return result, nil
+		}
+		result.Status = MigrationConflict
+		result.Reason = fmt.Sprintf("state directory already tracks %s as a %s VM", name, existing.Provider)
+		return result, nil
+	}
+	if plannedProvider, exists := planned[name]; exists {
+		result.Status = MigrationConflict
+		result.Reason = fmt.Sprintf("%s is also being imported as a %s VM", name, plannedProvider)
+		return result, nil
+	}
+	planned[name] = providerName
+
+	if dryRun {
+		result.Status = MigrationPending
+		return result, nil
+	}
+
+	if err := s.SaveConfig(name, configuration); err != nil {
+		return nil, err
+	}
+	cloudInitPath := config.CloudInitPath(folder, name)
+	if _, err := os.Stat(cloudInitPath); err != nil {
+		cloudInitPath = config.StateCloudInitPath(folder, name, dir)
+	}
+	if _, err := os.Stat(cloudInitPath); err == nil {
+		if err := s.CopyCloudInit(name, cloudInitPath); err != nil {
+			return nil, err
+		}
+	}
+
+	sourcePath := config.ResolveFolder(folder, name)
+	if absolutePath, err := filepath.Abs(sourcePath); err == nil {
+		sourcePath = absolutePath
+	}
+	state := NewState(name, providerName, sourcePath, configuration)
+	if info, err := os.Stat(result.StatePath); err == nil {
+		createdAt := info.ModTime().UTC().Truncate(time.Second)
+		if state.ExpiresAt != nil {
+			expiresAt := createdAt.Add(state.ExpiresAt.Sub(state.CreatedAt))
+			state.ExpiresAt = &expiresAt
+		}
+		state.CreatedAt = createdAt
+	}
+	if err := s.SaveState(name, state); err != nil {
+		return nil, err
+	}
+
+	result.Status = MigrationImported
+	return result, nil
+}
+
+func sameVM(existing *State, providerName string, configuration *config.Config) bool {
+	if existing.Provider != providerName {
+		return false
+	}
+	if providerName == "aws" {
+		return existing.AWS != nil && configuration.AWS != nil &&
+			existing.AWS.InstanceID == configuration.AWS.InstanceID
+	}
+	return true
+}
+
+func legacyDirName(providerName string) string {
+	for _, legacy := range legacyProviderDirs {
+		if legacy.provider == providerName {
+			return legacy.dir
+		}
+	}
+	return providerName
+}
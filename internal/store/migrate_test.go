@@ -0,0 +1,182 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+func writeLegacyState(t *testing.T, folder, name, dir string, configuration *config.Config) {
+	t.Helper()
+	if err := config.SaveState(folder, name, dir, configuration); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func legacyLocalConfig(name string) *config.Config {
+	return &config.Config{
+		VM: &config.VMConfig{
+			Name:  name,
+			Users: []config.User{{Username: "ubuntu", GitHubUsername: "gherlein"}},
+		},
+		Local: &config.LocalState{IP: "10.0.0.5"},
+	}
+}
+
+func TestMigrateImportsLegacyState(t *testing.T) {
+	folder := t.TempDir()
+	stateStore := New(t.TempDir())
+	writeLegacyState(t, folder, "devbox", "local", legacyLocalConfig("devbox"))
+	awsConfig := testConfig()
+	awsConfig.VM.Name = "web"
+	writeLegacyState(t, folder, "web", "aws", awsConfig)
+	os.WriteFile(config.CloudInitPath(folder, "web"), []byte("#cloud-config\n"), 0644)
+
+	results, err := stateStore.Migrate(folder, false)
+	if err != nil {
+		t.Fatalf("Migrate() returned error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d: %v", len(results), results)
+	}
+	for _, result := range results {
+		if result.Status != MigrationImported {
+			t.Errorf("%s: status = %q, want %q", result.Name, result.Status, MigrationImported)
+		}
+	}
+
+	configuration, state, err := stateStore.LoadConfig("web")
+	if err != nil {
+		t.Fatalf("LoadConfig() returned error: %v", err)
+	}
+	if state.Provider != "aws" {
+		t.Errorf("Provider = %q, want %q", state.Provider, "aws")
+	}
+	if configuration.AWS == nil || configuration.AWS.InstanceID != "i-0123456789abcdef0" {
+		t.Errorf("AWS state not imported: %v", configuration.AWS)
+	}
+	if !filepath.IsAbs(state.SourceConfigPath) {
+		t.Errorf("SourceConfigPath should be absolute, got %q", state.SourceConfigPath)
+	}
+	if _, err := os.Stat(stateStore.CloudInitPath("web")); err != nil {
+		t.Errorf("cloud-init snapshot missing: %v", err)
+	}
+
+	local, err := stateStore.LoadState("devbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local.Provider != "multipass" || local.Local == nil || local.Local.IP != "10.0.0.5" {
+		t.Errorf("local state not imported correctly: %+v", local)
+	}
+}
+
+func TestMigrateKeepsTTLRelativeToCreation(t *testing.T) {
+	folder := t.TempDir()
+	stateStore := New(t.TempDir())
+	configuration := legacyLocalConfig("devbox")
+	configuration.VM.TTL = "24h"
+	writeLegacyState(t, folder, "devbox", "local", configuration)
+	createdAt := time.Now().Add(-72 * time.Hour).UTC().Truncate(time.Second)
+	if err := os.Chtimes(config.StatePath(folder, "devbox", "local"), createdAt, createdAt); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := stateStore.Migrate(folder, false); err != nil {
+		t.Fatalf("Migrate() returned error: %v", err)
+	}
+	state, err := stateStore.LoadState("devbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.CreatedAt.Equal(createdAt) {
+		t.Errorf("CreatedAt = %v, want %v", state.CreatedAt, createdAt)
+	}
+	if state.ExpiresAt == nil || !state.ExpiresAt.Equal(createdAt.Add(24*time.Hour)) {
+		t.Errorf("ExpiresAt = %v, want %v", state.ExpiresAt, createdAt.Add(24*time.Hour))
+	}
+	if !state.Expired(time.Now()) {
+		t.Error("a VM created 72h ago with a 24h TTL should be expired")
+	}
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	folder := t.TempDir()
+	stateStore := New(t.TempDir())
+	writeLegacyState(t, folder, "devbox", "local", legacyLocalConfig("devbox"))
+
+	if _, err := stateStore.Migrate(folder, false); err != nil {
+		t.Fatal(err)
+	}
+	results, err := stateStore.Migrate(folder, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != MigrationExists {
+		t.Errorf("second Migrate() = %v, want one %q result", results, MigrationExists)
+	}
+}
+
+func TestMigrateDryRunWritesNothing(t *testing.T) {
+	folder := t.TempDir()
+	stateStore := New(t.TempDir())
+	writeLegacyState(t, folder, "devbox", "local", legacyLocalConfig("devbox"))
+
+	results, err := stateStore.Migrate(folder, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != MigrationPending {
+		t.Errorf("dry run = %v, want one %q result", results, MigrationPending)
+	}
+	if stateStore.Exists("devbox") {
+		t.Error("dry run should not create state")
+	}
+}
+
+func TestMigrateFlagsConflicts(t *testing.T) {
+	folder := t.TempDir()
+	stateStore := New(t.TempDir())
+	writeLegacyState(t, folder, "devbox", "local", legacyLocalConfig("devbox"))
+	awsConfig := testConfig()
+	writeLegacyState(t, folder, "devbox", "aws", awsConfig)
+
+	for _, dryRun := range []bool{true, false} {
+		results, err := stateStore.Migrate(folder, dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 2 {
+			t.Fatalf("expected 2 results, got %v", results)
+		}
+		if results[1].Provider != "aws" || results[1].Status != MigrationConflict {
+			t.Errorf("dryRun=%v: aws result = %+v, want conflict", dryRun, results[1])
+		}
+	}
+}
+
+func TestMigrateFlagsMissingStateBlock(t *testing.T) {
+	folder := t.TempDir()
+	stateStore := New(t.TempDir())
+	configuration := legacyLocalConfig("devbox")
+	configuration.Local = nil
+	writeLegacyState(t, folder, "devbox", "local", configuration)
+
+	results, err := stateStore.Migrate(folder, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != MigrationInvalid {
+		t.Errorf("Migrate() = %v, want one %q result", results, MigrationInvalid)
+	}
+}
+
+func TestMigrateMissingFolder(t *testing.T) {
+	stateStore := New(t.TempDir())
+	if _, err := stateStore.Migrate(filepath.Join(t.TempDir(), "missing"), false); err == nil {
+		t.Fatal("expected error for missing stacks folder")
+	}
+}
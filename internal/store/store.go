@@ -0,0 +1,322 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+const (
+	activeDirName     = "active"
+	archiveDirName    = "archive"
+	stateFileName     = "state.json"
+	configFileName    = "config.json"
+	cloudInitFileName = "cloud-init.yaml"
+	archiveTimeFormat = "20060102T150405"
+)
+
+type State struct {
+	Name             string             `json:"name"`
+	Provider         string             `json:"provider"`
+	CreatedAt        time.Time          `json:"created_at"`
+	DestroyedAt      *time.Time         `json:"destroyed_at,omitempty"`
+	ExpiresAt        *time.Time         `json:"expires_at,omitempty"`
+	SourceConfigPath string             `json:"source_config_path,omitempty"`
+	Local            *config.LocalState `json:"local,omitempty"`
+	AWS              *config.AWSState   `json:"aws,omitempty"`
+	Snapshots        []config.Snapshot  `json:"snapshots,omitempty"`
+	LastIdleStop     *time.Time         `json:"last_idle_stop,omitempty"`
+}
+
+type Store struct {
+	BaseDir string
+}
+
+func New(baseDir string) *Store {
+	return &Store{BaseDir: baseDir}
+}
+
+func Open() (*Store, error) {
+	baseDir, err := DefaultBaseDir()
+	if err != nil {
+		return nil, err
+	}
+	return New(baseDir), nil
+}
+
+func DefaultBaseDir() (string, error) {
+	if stateDir := os.Getenv("GOLOO_STATE_DIR"); stateDir != "" {
+		return stateDir, nil
+	}
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		return filepath.Join(dataHome, "goloo"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve state directory: set GOLOO_STATE_DIR: %w", err)
+	}
+	return filepath.Join(home, ".local", "share", "goloo"), nil
+}
+
+func (s *Store) ActiveDir(name string) string {
+	return filepath.Join(s.BaseDir, activeDirName, name)
+}
+
+func (s *Store) ArchiveDir() string {
+	return filepath.Join(s.BaseDir, archiveDirName)
+}
+
+func (s *Store) StatePath(name string) string {
+	return filepath.Join(s.ActiveDir(name), stateFileName)
+}
+
+func (s *Store) ConfigPath(name string) string {
+	return filepath.Join(s.ActiveDir(name), configFileName)
+}
+
+func (s *Store) CloudInitPath(name string) string {
+	return filepath.Join(s.ActiveDir(name), cloudInitFileName)
+}
+
+func (s *Store) Exists(name string) bool {
+	if validateName(name) != nil {
+		return false
+	}
+	_, err := os.Stat(s.StatePath(name))
+	return err == nil
+}
+
+func validateName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid VM name %q: must not contain '/' or '..' or start with '.'", name)
+	}
+	return nil
+}
+
+func NewState(name, providerName, sourceConfigPath string, configuration *config.Config) *State {
+	state := &State{
+		Name:             name,
+		Provider:         providerName,
+		CreatedAt:        time.Now().UTC(),
+		SourceConfigPath: sourceConfigPath,
+		Local:            configuration.Local,
+		AWS:              configuration.AWS,
+	}
+	if configuration.VM != nil && configuration.VM.TTL != "" {
+		if ttl, err := config.ParseDuration(configuration.VM.TTL); err == nil {
+			expiresAt := state.CreatedAt.Add(ttl)
+			state.ExpiresAt = &expiresAt
+		}
+	}
+	return state
+}
+
+func (st *State) Expired(now time.Time) bool {
+	return st.ExpiresAt != nil && !now.Before(*st.ExpiresAt)
+}
+
+func (st *State) Extend(duration time.Duration, now time.Time) {
+	base := now
+	if st.ExpiresAt != nil && st.ExpiresAt.After(now) {
+		base = *st.ExpiresAt
+	}
+	expiresAt := base.Add(duration).UTC()
+	st.ExpiresAt = &expiresAt
+}
+
+func (st *State) FindSnapshot(name string) (config.Snapshot, bool) {
+	for _, snapshot := range st.Snapshots {
+		if snapshot.Name == name {
+			return snapshot, true
+		}
+	}
+	return config.Snapshot{}, false
+}
+
+func (st *State) RemoveSnapshot(name string) {
+	kept := st.Snapshots[:0]
+	for _, snapshot := range st.Snapshots {
+		if snapshot.Name != name {
+			kept = append(kept, snapshot)
+		}
+	}
+	st.Snapshots = kept
+}
+
+func (st *State) Apply(configuration *config.Config) {
+	configuration.Local = st.Local
+	configuration.AWS = st.AWS
+}
+
+func (s *Store) SaveState(name string, state *State) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	return writeJSON(s.ActiveDir(name), s.StatePath(name), state)
+}
+
+func (s *Store) LoadState(name string) (*State, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	return readState(s.StatePath(name))
+}
+
+func (s *Store) UpdateState(name string, configuration *config.Config) error {
+	state, err := s.LoadState(name)
+	if err != nil {
+		return err
+	}
+	state.Local = configuration.Local
+	state.AWS = configuration.AWS
+	return s.SaveState(name, state)
+}
+
+func (s *Store) SaveConfig(name string, configuration *config.Config) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	activeDir := s.ActiveDir(name)
+	if err := os.MkdirAll(activeDir, 0755); err != nil {
+		return fmt.Errorf("failed to create state directory %s: %w", activeDir, err)
+	}
+	snapshot := *configuration
+	snapshot.Local = nil
+	snapshot.AWS = nil
+	return config.Save(s.ConfigPath(name), &snapshot)
+}
+
+func (s *Store) CopyCloudInit(name string, cloudInitPath string) error {
+	if cloudInitPath == "" {
+		return nil
+	}
+	if err := validateName(name); err != nil {
+		return err
+	}
+	activeDir := s.ActiveDir(name)
+	if err := os.MkdirAll(activeDir, 0755); err != nil {
+		return fmt.Errorf("failed to create state directory %s: %w", activeDir, err)
+	}
+	return copyFile(cloudInitPath, s.CloudInitPath(name))
+}
+
+func (s *Store) LoadConfig(name string) (*config.Config, *State, error) {
+	state, err := s.LoadState(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	configuration, _, err := config.LoadFromPath(s.ConfigPath(name))
+	if err != nil {
+		return nil, nil, err
+	}
+	state.Apply(configuration)
+	return configuration, state, nil
+}
+
+func (s *Store) ListActive() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.BaseDir, activeDirName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && s.Exists(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *Store) Archive(name string) (string, error) {
+	state, err := s.LoadState(name)
+	if err != nil {
+		return "", err
+	}
+	destroyedAt := time.Now().UTC()
+	state.DestroyedAt = &destroyedAt
+	if err := s.SaveState(name, state); err != nil {
+		return "", err
+	}
+
+	archiveDir := s.ArchiveDir()
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create archive directory %s: %w", archiveDir, err)
+	}
+	entry := name + "-" + destroyedAt.Format(archiveTimeFormat)
+	destination := filepath.Join(archiveDir, entry)
+	if err := os.Rename(s.ActiveDir(name), destination); err != nil {
+		return "", fmt.Errorf("failed to archive %s: %w", name, err)
+	}
+	return entry, nil
+}
+
+func readState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("state not found: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state %s: %w", path, err)
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+func writeJSON(directory, path string, value interface{}) error {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return fmt.Errorf("failed to create state directory %s: %w", directory, err)
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	data = append(data, '\n')
+
+	temporaryPath := path + ".tmp"
+	if err := os.WriteFile(temporaryPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(temporaryPath, path); err != nil {
+		os.Remove(temporaryPath)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func copyFile(sourcePath, destinationPath string) error {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", sourcePath, err)
+	}
+	defer source.Close()
+
+	destination, err := os.Create(destinationPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", destinationPath, err)
+	}
+
+	if _, err := io.Copy(destination, source); err != nil {
+		destination.Close()
+		return fmt.Errorf("failed to copy %s: %w", sourcePath, err)
+	}
+	if err := destination.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", destinationPath, err)
+	}
+	return nil
+}
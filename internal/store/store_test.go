@@ -0,0 +1,355 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emergingrobotics/goloo/internal/config"
+)
+
+func testConfig() *config.Config {
+	return &config.Config{
+		VM: &config.VMConfig{
+			Name:  "devbox",
+			Users: []config.User{{Username: "ubuntu", GitHubUsername: "gherlein"}},
+		},
+		AWS: &config.AWSState{
+			InstanceID: "i-0123456789abcdef0",
+			PublicIP:   "54.1.2.3",
+			Region:     "us-west-2",
+		},
+	}
+}
+
+func TestDefaultBaseDirFromEnv(t *testing.T) {
+	t.Setenv("GOLOO_STATE_DIR", "/tmp/goloo-state")
+	got, err := DefaultBaseDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "/tmp/goloo-state" {
+		t.Errorf("DefaultBaseDir() = %q, want %q", got, "/tmp/goloo-state")
+	}
+}
+
+func TestDefaultBaseDirFromXDG(t *testing.T) {
+	t.Setenv("GOLOO_STATE_DIR", "")
+	t.Setenv("XDG_DATA_HOME", "/home/user/.data")
+	got, err := DefaultBaseDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join("/home/user/.data", "goloo")
+	if got != want {
+		t.Errorf("DefaultBaseDir() = %q, want %q", got, want)
+	}
+}
+
+func TestDefaultBaseDirFallsBackToHome(t *testing.T) {
+	t.Setenv("GOLOO_STATE_DIR", "")
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("HOME", "/home/user")
+	got, err := DefaultBaseDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join("/home/user", ".local", "share", "goloo")
+	if got != want {
+		t.Errorf("DefaultBaseDir() = %q, want %q", got, want)
+	}
+}
+
+func TestSaveAndLoadState(t *testing.T) {
+	stateStore := New(t.TempDir())
+	state := NewState("devbox", "aws", "/projects/stacks/devbox", testConfig())
+
+	if err := stateStore.SaveState("devbox", state); err != nil {
+		t.Fatalf("SaveState() returned error: %v", err)
+	}
+	if !stateStore.Exists("devbox") {
+		t.Fatal("Exists() should return true after SaveState()")
+	}
+
+	loaded, err := stateStore.LoadState("devbox")
+	if err != nil {
+		t.Fatalf("LoadState() returned error: %v", err)
+	}
+	if loaded.Provider != "aws" {
+		t.Errorf("Provider = %q, want %q", loaded.Provider, "aws")
+	}
+	if loaded.SourceConfigPath != "/projects/stacks/devbox" {
+		t.Errorf("SourceConfigPath = %q, want %q", loaded.SourceConfigPath, "/projects/stacks/devbox")
+	}
+	if loaded.AWS == nil || loaded.AWS.InstanceID != "i-0123456789abcdef0" {
+		t.Errorf("AWS.InstanceID = %v, want i-0123456789abcdef0", loaded.AWS)
+	}
+	if loaded.CreatedAt.IsZero() {
+		t.Error("CreatedAt should be set")
+	}
+}
+
+func TestExistsFalseForUnknownVM(t *testing.T) {
+	stateStore := New(t.TempDir())
+	if stateStore.Exists("devbox") {
+		t.Error("Exists() should return false for unknown VM")
+	}
+}
+
+func TestLoadStateMissing(t *testing.T) {
+	stateStore := New(t.TempDir())
+	if _, err := stateStore.LoadState("devbox"); err == nil {
+		t.Fatal("expected error loading missing state")
+	}
+}
+
+func TestRejectsUnsafeVMNames(t *testing.T) {
+	baseDir := t.TempDir()
+	stateStore := New(filepath.Join(baseDir, "state"))
+	for _, name := range []string{"", "../escape", "a/b", "..", ".hidden", "dev..box"} {
+		if err := stateStore.SaveState(name, &State{Name: name}); err == nil {
+			t.Errorf("SaveState(%q) should return error", name)
+		}
+		if err := stateStore.SaveConfig(name, testConfig()); err == nil {
+			t.Errorf("SaveConfig(%q) should return error", name)
+		}
+		if _, err := stateStore.LoadState(name); err == nil {
+			t.Errorf("LoadState(%q) should return error", name)
+		}
+		if stateStore.Exists(name) {
+			t.Errorf("Exists(%q) should return false", name)
+		}
+	}
+	if entries, _ := os.ReadDir(baseDir); len(entries) != 0 {
+		t.Errorf("nothing should be written for unsafe names, found %v", entries)
+	}
+}
+
+func TestLoadStateCorrupt(t *testing.T) {
+	stateStore := New(t.TempDir())
+	os.MkdirAll(stateStore.ActiveDir("devbox"), 0755)
+	os.WriteFile(stateStore.StatePath("devbox"), []byte("{not json"), 0644)
+
+	_, err := stateStore.LoadState("devbox")
+	if err == nil {
+		t.Fatal("expected error loading corrupt state")
+	}
+	if strings.Contains(err.Error(), "not found") || !strings.Contains(err.Error(), "failed to parse state") {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
+
+func TestSaveConfigStripsProviderState(t *testing.T) {
+	stateStore := New(t.TempDir())
+	if err := stateStore.SaveConfig("devbox", testConfig()); err != nil {
+		t.Fatalf("SaveConfig() returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(stateStore.ConfigPath("devbox"))
+	if err != nil {
+		t.Fatalf("failed to read snapshot: %v", err)
+	}
+	if strings.Contains(string(data), `"aws"`) {
+		t.Errorf("config snapshot should not contain provider state:\n%s", data)
+	}
+}
+
+func TestLoadConfigAppliesState(t *testing.T) {
+	stateStore := New(t.TempDir())
+	configuration := testConfig()
+	stateStore.SaveConfig("devbox", configuration)
+	stateStore.SaveState("devbox", NewState("devbox", "aws", "", configuration))
+
+	loaded, state, err := stateStore.LoadConfig("devbox")
+	if err != nil {
+		t.Fatalf("LoadConfig() returned error: %v", err)
+	}
+	if state.Provider != "aws" {
+		t.Errorf("Provider = %q, want %q", state.Provider, "aws")
+	}
+	if loaded.VM.Name != "devbox" {
+		t.Errorf("VM.Name = %q, want %q", loaded.VM.Name, "devbox")
+	}
+	if loaded.AWS == nil || loaded.AWS.PublicIP != "54.1.2.3" {
+		t.Errorf("AWS.PublicIP = %v, want 54.1.2.3", loaded.AWS)
+	}
+}
+
+func TestUpdateState(t *testing.T) {
+	stateStore := New(t.TempDir())
+	configuration := testConfig()
+	stateStore.SaveState("devbox", NewState("devbox", "aws", "", configuration))
+
+	configuration.AWS.PublicIP = "54.9.9.9"
+	if err := stateStore.UpdateState("devbox", configuration); err != nil {
+		t.Fatalf("UpdateState() returned error: %v", err)
+	}
+
+	loaded, err := stateStore.LoadState("devbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.AWS.PublicIP != "54.9.9.9" {
+		t.Errorf("AWS.PublicIP = %q, want %q", loaded.AWS.PublicIP, "54.9.9.9")
+	}
+}
+
+func TestCopyCloudInit(t *testing.T) {
+	directory := t.TempDir()
+	stateStore := New(filepath.Join(directory, "state"))
+
+	content := "#cloud-config\npackages:\n  - vim\n"
+	source := filepath.Join(directory, "cloud-init.yaml")
+	os.WriteFile(source, []byte(content), 0644)
+
+	if err := stateStore.CopyCloudInit("devbox", source); err != nil {
+		t.Fatalf("CopyCloudInit() returned error: %v", err)
+	}
+	data, err := os.ReadFile(stateStore.CloudInitPath("devbox"))
+	if err != nil {
+		t.Fatalf("failed to read copied cloud-init: %v", err)
+	}
+	if string(data) != content {
+		t.Errorf("copied cloud-init = %q, want %q", string(data), content)
+	}
+}
+
+func TestCopyCloudInitEmptyPath(t *testing.T) {
+	stateStore := New(t.TempDir())
+	if err := stateStore.CopyCloudInit("devbox", ""); err != nil {
+		t.Errorf("CopyCloudInit() with empty path should return nil, got: %v", err)
+	}
+}
+
+func TestListActive(t *testing.T) {
+	stateStore := New(t.TempDir())
+
+	names, err := stateStore.ListActive()
+	if err != nil {
+		t.Fatalf("ListActive() on empty store returned error: %v", err)
+	}
+	if len(names) != 0 {
+		t.Errorf("expected no active VMs, got %v", names)
+	}
+
+	for _, name := range []string{"web", "devbox"} {
+		stateStore.SaveState(name, NewState(name, "multipass", "", &config.Config{}))
+	}
+	os.MkdirAll(stateStore.ActiveDir("incomplete"), 0755)
+
+	names, err = stateStore.ListActive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "devbox" || names[1] != "web" {
+		t.Errorf("ListActive() = %v, want [devbox web]", names)
+	}
+}
+
+func TestArchiveMovesEntry(t *testing.T) {
+	stateStore := New(t.TempDir())
+	configuration := testConfig()
+	stateStore.SaveConfig("devbox", configuration)
+	stateStore.SaveState("devbox", NewState("devbox", "aws", "", configuration))
+
+	entry, err := stateStore.Archive("devbox")
+	if err != nil {
+		t.Fatalf("Archive() returned error: %v", err)
+	}
+	if !strings.HasPrefix(entry, "devbox-") {
+		t.Errorf("archive entry %q should start with devbox-", entry)
+	}
+	if stateStore.Exists("devbox") {
+		t.Error("VM should no longer be active after Archive()")
+	}
+
+	archived, err := readState(filepath.Join(stateStore.ArchiveDir(), entry, stateFileName))
+	if err != nil {
+		t.Fatalf("failed to read archived state: %v", err)
+	}
+	if archived.DestroyedAt == nil {
+		t.Error("archived state should record DestroyedAt")
+	}
+	if archived.AWS == nil || archived.AWS.InstanceID != "i-0123456789abcdef0" {
+		t.Errorf("archived state should keep AWS state, got %v", archived.AWS)
+	}
+	if _, err := os.Stat(filepath.Join(stateStore.ArchiveDir(), entry, configFileName)); err != nil {
+		t.Errorf("archived config snapshot missing: %v", err)
+	}
+}
+
+func TestArchiveMissingVM(t *testing.T) {
+	stateStore := New(t.TempDir())
+	if _, err := stateStore.Archive("devbox"); err == nil {
+		t.Fatal("expected error archiving unknown VM")
+	}
+}
+
+func TestNewStateRecordsExpiry(t *testing.T) {
+	withoutTTL := NewState("devbox", "aws", "", &config.Config{VM: &config.VMConfig{Name: "devbox"}})
+	if withoutTTL.ExpiresAt != nil {
+		t.Errorf("expected no expiry without vm.ttl, got %v", withoutTTL.ExpiresAt)
+	}
+
+	state := NewState("devbox", "aws", "", &config.Config{VM: &config.VMConfig{Name: "devbox", TTL: "8h"}})
+	if state.ExpiresAt == nil || !state.ExpiresAt.Equal(state.CreatedAt.Add(8*time.Hour)) {
+		t.Errorf("expected expiry 8h after %v, got %v", state.CreatedAt, state.ExpiresAt)
+	}
+}
+
+func TestStateExpiredAndExtend(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	state := &State{}
+	if state.Expired(now) {
+		t.Error("a VM without a ttl should never expire")
+	}
+
+	deadline := now.Add(-time.Hour)
+	state.ExpiresAt = &deadline
+	if !state.Expired(now) {
+		t.Error("expected VM past its deadline to be expired")
+	}
+
+	state.Extend(4*time.Hour, now)
+	if !state.ExpiresAt.Equal(now.Add(4 * time.Hour)) {
+		t.Errorf("extending an expired VM should count from now, got %v", state.ExpiresAt)
+	}
+	state.Extend(2*time.Hour, now)
+	if !state.ExpiresAt.Equal(now.Add(6 * time.Hour)) {
+		t.Errorf("extending a live VM should push its deadline out, got %v", state.ExpiresAt)
+	}
+	if state.Expired(now) {
+		t.Error("extended VM should not be expired")
+	}
+}
+
+func TestStateSnapshots(t *testing.T) {
+	stateStore := New(t.TempDir())
+	state := NewState("devbox", "aws", "", &config.Config{})
+	state.Snapshots = []config.Snapshot{
+		{Name: "before", ID: "ami-1", SnapshotIDs: []string{"snap-1"}},
+		{Name: "after", ID: "ami-2"},
+	}
+	if err := stateStore.SaveState("devbox", state); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := stateStore.LoadState("devbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, exists := loaded.FindSnapshot("before")
+	if !exists || snapshot.ID != "ami-1" || len(snapshot.SnapshotIDs) != 1 {
+		t.Errorf("expected recorded snapshot, got %+v", snapshot)
+	}
+	if _, exists := loaded.FindSnapshot("missing"); exists {
+		t.Error("FindSnapshot() found a snapshot that was never taken")
+	}
+
+	loaded.RemoveSnapshot("before")
+	if len(loaded.Snapshots) != 1 || loaded.Snapshots[0].Name != "after" {
+		t.Errorf("expected only 'after' to remain, got %+v", loaded.Snapshots)
+	}
+}